@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -14,6 +15,7 @@ func main() {
 	testMode := flag.Bool("test", false, "Run in test mode")
 	testFile := flag.String("test-file", "", "Test file path for watermark operations")
 	testDir := flag.String("test-dir", "", "Test directory for batch processing")
+	traceFile := flag.String("trace", "", "Leaked file to trace back to its order")
 	flag.Parse()
 
 	cfg := config.Load()
@@ -22,6 +24,28 @@ func main() {
 	logger := services.GetGlobalLogger()
 	logger.Info("Starting Photo Processing Server...")
 	logger.Info(fmt.Sprintf("Configuration loaded: Port=%s, Environment=%s", cfg.Port, cfg.Environment))
+	services.SetWatermarkSecret(cfg.WatermarkSecret)
+	if err := services.GetWatermarkKeyring().Load(cfg.WatermarkKeysFile); err != nil {
+		logger.Error(fmt.Sprintf("Failed to load watermark keys: %v", err))
+	}
+	if err := services.GetIssuanceRegistry().Configure(cfg.IssuanceRegistryFile); err != nil {
+		logger.Error(fmt.Sprintf("Failed to load issuance registry: %v", err))
+	}
+	if err := services.GetFontLibrary().Load(cfg.FontsDir, cfg.VisibleWatermarkFont); err != nil {
+		logger.Error(fmt.Sprintf("Failed to load fonts: %v", err))
+	}
+	if err := services.LoadWatermarkLogo(cfg.WatermarkLogo); err != nil {
+		logger.Error(fmt.Sprintf("Failed to load watermark logo: %v", err))
+	}
+	
+	// Leak tracing for a single file
+	if *traceFile != "" {
+		if err := traceLeak(*traceFile); err != nil {
+			logger.Error(fmt.Sprintf("Trace failed: %v", err))
+			os.Exit(1)
+		}
+		return
+	}
 	
 	// Test mode for validating ported logic
 	if *testMode {
@@ -57,6 +81,9 @@ func runTests(testFile, testDir string) {
 		logger.Info("\n3. Testing Watermark Operations...")
 		if _, err := os.Stat(testFile); err == nil {
 			services.TestWatermarkOperations(testFile)
+			if services.IsImageFile(testFile) {
+				services.TestRobustWatermark(testFile)
+			}
 		} else {
 			logger.Error(fmt.Sprintf("Test file not found: %s", testFile))
 		}
@@ -108,6 +135,20 @@ func testBatchProcessing(testDir string) {
 	}
 }
 
+func traceLeak(filePath string) error {
+	report, err := services.TraceLeak(filePath, services.GetIssuanceRegistry())
+	if err != nil {
+		return err
+	}
+	
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
 func showUsage() {
 	logger := services.GetGlobalLogger()
 	logger.Info("\n=== Photo Processing Server ===")
@@ -117,6 +158,7 @@ func showUsage() {
 	logger.Info("  ./photo-processor --test             - Run all tests")
 	logger.Info("  ./photo-processor --test --test-file /path/to/image.jpg")
 	logger.Info("  ./photo-processor --test --test-dir /path/to/photos")
+	logger.Info("  ./photo-processor --trace /path/to/leaked.jpg")
 	logger.Info("")
 	logger.Info("Examples:")
 	logger.Info("  # Test Caesar cipher and image processing")
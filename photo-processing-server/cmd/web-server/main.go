@@ -37,6 +37,22 @@ func main() {
 	// Initialize services
 	logger := services.NewLogger()
 	logger.SetLevel(cfg.LogLevel)
+	services.SetWatermarkSecret(cfg.WatermarkSecret)
+	if err := services.GetWatermarkKeyring().Load(cfg.WatermarkKeysFile); err != nil {
+		log.Printf("Warning: failed to load watermark keys: %v", err)
+	}
+	if err := services.GetIssuanceRegistry().Configure(cfg.IssuanceRegistryFile); err != nil {
+		log.Printf("Warning: failed to load issuance registry: %v", err)
+	}
+	if err := services.GetFontLibrary().Load(cfg.FontsDir, cfg.VisibleWatermarkFont); err != nil {
+		log.Printf("Warning: failed to load fonts: %v", err)
+	}
+	if err := services.LoadWatermarkLogo(cfg.WatermarkLogo); err != nil {
+		log.Printf("Warning: failed to load watermark logo: %v", err)
+	}
+	if !services.HasWatermarkSecret() {
+		log.Println("Warning: no watermark key configured, invisible watermarks use the legacy unkeyed format")
+	}
 	processor := services.NewProcessor(logger)
 	subsService := services.NewSubscriptionService(logger, redisClient)
 	cryptoService := services.NewCryptoPaymentService(logger, subsService)
@@ -79,12 +95,18 @@ func main() {
 	subsHandler := web.NewSubscriptionHandler(subsService, cryptoService, logger)
 	wpService := services.NewWordPressService(logger, "", "", "", "", "")
 	wooHandler := web.NewWooCommerceHandler(processor, logger, wpService, notificationService)
+	keyHandler := web.NewWatermarkKeyHandler(logger)
+	issuanceHandler := web.NewIssuanceHandler(logger)
+	traceHandler := web.NewLeakTraceHandler(logger, services.GetIssuanceRegistry(), web.NewBatchJobIssuanceSource(), wooHandler)
 	
 	// Setup routes
 	web.SetupAuthRoutes(router)
 	webHandler.SetupRoutes(router)
 	subsHandler.SetupRoutes(router)
 	wooHandler.SetupRoutes(router)
+	keyHandler.SetupRoutes(router)
+	issuanceHandler.SetupRoutes(router)
+	traceHandler.SetupRoutes(router)
 	web.SetupWebSocketRoutes(router)
 
 	// Protect API and WS (skip auth endpoints and health)
@@ -133,6 +155,7 @@ func main() {
 				"Images (.jpg, .jpeg, .png)",
 				"Videos (.mp4, .avi, .mov, .mkv)",
 				"Text (.txt)",
+				"Documents (.pdf, .docx, .svg, .html, .csv)",
 			},
 			"techStack": []string{
 				"Go Backend + WebSocket",
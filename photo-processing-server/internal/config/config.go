@@ -37,6 +37,12 @@ type Config struct {
 	WatermarkEnabled       bool
 	SwapEnabled           bool
 	VisibleWatermarkEnabled bool
+	WatermarkSecret        string
+	WatermarkKeysFile      string
+	IssuanceRegistryFile   string
+	FontsDir               string
+	VisibleWatermarkFont   string
+	WatermarkLogo          string
 	
 	// Email
 	SMTPHost     string
@@ -86,6 +92,12 @@ func Load() *Config {
 		WatermarkEnabled:        getBoolEnv("WATERMARK_ENABLED", true),
 		SwapEnabled:            getBoolEnv("SWAP_ENABLED", true),
 		VisibleWatermarkEnabled: getBoolEnv("VISIBLE_WATERMARK_ENABLED", true),
+		WatermarkSecret:         getEnv("WATERMARK_SECRET", ""),
+		WatermarkKeysFile:       getEnv("WATERMARK_KEYS_FILE", "/app/data/watermark-keys.json"),
+		IssuanceRegistryFile:    getEnv("ISSUANCE_REGISTRY_FILE", "/app/data/issuance.jsonl"),
+		FontsDir:                getEnv("FONTS_DIR", "/app/data/fonts"),
+		VisibleWatermarkFont:    getEnv("VISIBLE_WATERMARK_FONT", ""),
+		WatermarkLogo:           getEnv("WATERMARK_LOGO", "/app/data/logo.png"),
 		
 		// Email
 		SMTPHost:     getEnv("SMTP_HOST", ""),
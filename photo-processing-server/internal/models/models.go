@@ -16,6 +16,9 @@ type ProcessingJob struct {
 	CreateZip    bool      `json:"create_zip" db:"create_zip"`
 	WatermarkText string   `json:"watermark_text" db:"watermark_text"`
 	PhotoNumber  *int      `json:"photo_number" db:"photo_number"`
+	AddRobustWatermark bool `json:"add_robust_watermark" db:"add_robust_watermark"`
+	StructuredPayload bool `json:"structured_payload" db:"structured_payload"`
+	TextWatermarkMode string `json:"text_watermark_mode" db:"text_watermark_mode"`
 	Status       string    `json:"status" db:"status"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// containerFormat embeds watermarks inside a file format's own structure
+// (JPEG segments, PNG chunks, MP4/MOV boxes, document metadata) instead of
+// trailing bytes, so the mark survives tools that drop data after the
+// end-of-file marker.
+// Marks are stored verbatim as WATERMARK_START + payload + WATERMARK_END,
+// one segment/chunk/box per mark, in the order they were added.
+type containerFormat interface {
+	// name identifies the format in log messages
+	name() string
+	// embed inserts mark into the file after any existing marks
+	embed(filePath string, mark []byte) error
+	// extract returns the embedded marks in file order, or nil if there are none
+	extract(filePath string) ([][]byte, error)
+	// remove strips the embedded marks for which drop(index) is true (every
+	// mark when drop is nil) and reports how many were removed
+	remove(filePath string, drop func(index int) bool) (int, error)
+}
+
+// containerFormatFor sniffs the file signature (and the extension for ZIP
+// and text-based documents) and returns a matching container format, or nil
+// if the file must use the trailer fallback
+func containerFormatFor(filePath string) containerFormat {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	header := make([]byte, 12)
+	n, _ := io.ReadFull(file, header)
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, jpegSOI):
+		return jpegContainer{}
+	case bytes.HasPrefix(header, pngSignature):
+		return pngContainer{}
+	case isMP4Header(header):
+		return mp4Container{}
+	case bytes.HasPrefix(header, pdfSignature):
+		return pdfContainer{}
+	}
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".docx":
+		if bytes.HasPrefix(header, zipSignature) {
+			return docxContainer{}
+		}
+	case ".svg":
+		return svgContainer
+	case ".html", ".htm":
+		return htmlContainer
+	case ".csv":
+		return csvContainer{}
+	}
+	return nil
+}
+
+// buildWatermark wraps a payload with the binary watermark markers
+func buildWatermark(encodedText string) []byte {
+	mark := make([]byte, 0, len(WATERMARK_START)+len(encodedText)+len(WATERMARK_END))
+	mark = append(mark, WATERMARK_START...)
+	mark = append(mark, encodedText...)
+	mark = append(mark, WATERMARK_END...)
+	return mark
+}
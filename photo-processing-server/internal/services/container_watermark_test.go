@@ -0,0 +1,111 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testImage is a small gradient for encoders to work on
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 8), uint8(y * 10), 128, 255})
+		}
+	}
+	return img
+}
+
+// writeTestFile stores data under a new temp directory
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// checkContainerRoundTrip embeds two marks into the file at path, checks they
+// extract in order, removes the first and then the rest, and expects the
+// original bytes back. valid reports whether the file still decodes.
+func checkContainerRoundTrip(t *testing.T, container containerFormat, path string, valid func([]byte) error) {
+	t.Helper()
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := buildWatermark("first-payload")
+	second := buildWatermark(string(bytes.Repeat([]byte("second-"), 40)))
+	for _, mark := range [][]byte{first, second} {
+		if err := container.embed(path, mark); err != nil {
+			t.Fatalf("embed: %v", err)
+		}
+	}
+	if detected := containerFormatFor(path); detected == nil || detected.name() != container.name() {
+		t.Fatalf("marked file detected as %v, want %s", detected, container.name())
+	}
+	marked, _ := os.ReadFile(path)
+	if valid != nil {
+		if err := valid(marked); err != nil {
+			t.Fatalf("marked file no longer decodes: %v", err)
+		}
+	}
+
+	marks, err := container.extract(path)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if len(marks) != 2 || !bytes.Equal(marks[0], first) || !bytes.Equal(marks[1], second) {
+		t.Fatalf("extracted %q, want both marks in order", marks)
+	}
+
+	removed, err := container.remove(path, func(index int) bool { return index == 0 })
+	if err != nil || removed != 1 {
+		t.Fatalf("remove first: %d, %v", removed, err)
+	}
+	marks, _ = container.extract(path)
+	if len(marks) != 1 || !bytes.Equal(marks[0], second) {
+		t.Fatalf("after removing the first mark extracted %q", marks)
+	}
+
+	removed, err = container.remove(path, nil)
+	if err != nil || removed != 1 {
+		t.Fatalf("remove rest: %d, %v", removed, err)
+	}
+	cleaned, _ := os.ReadFile(path)
+	if !bytes.Equal(cleaned, original) {
+		t.Errorf("cleaned file differs from the original (%d vs %d bytes)", len(cleaned), len(original))
+	}
+	if removed, err := container.remove(path, nil); err != nil || removed != 0 {
+		t.Errorf("remove on a clean file: %d, %v", removed, err)
+	}
+}
+
+// checkTruncations extracts from every prefix of data and only expects no panic
+func checkTruncations(t *testing.T, container containerFormat, name string, data []byte) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	step := len(data)/200 + 1
+	for n := 0; n < len(data); n += step {
+		if err := os.WriteFile(path, data[:n], 0644); err != nil {
+			t.Fatal(err)
+		}
+		container.extract(path)
+		container.remove(path, nil)
+	}
+}
+
+func readTestFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// DecryptResult is one row of a decrypt report: a single mark of a file's
+// chain, or the file itself (empty payload) when it has no mark or could not
+// be read
+type DecryptResult struct {
+	Path    string            `json:"path"`
+	Index   int               `json:"index"` // position in the chain, oldest first
+	Owner   string            `json:"owner,omitempty"`
+	Format  string            `json:"format,omitempty"`
+	Payload string            `json:"payload,omitempty"` // raw embedded payload
+	Text    string            `json:"text,omitempty"`    // decoded text; flat form for structured marks
+	Status  WatermarkStatus   `json:"status,omitempty"`
+	KeyID   string            `json:"keyId,omitempty"`
+	Fields  *WatermarkPayload `json:"fields,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// DecryptReport is the result of a decrypt job
+type DecryptReport struct {
+	Folder  string          `json:"folder"`
+	Scanned int             `json:"scanned"`
+	Found   int             `json:"found"`
+	Results []DecryptResult `json:"results"`
+}
+
+// decryptMark decodes one mark of a file into a report row
+func decryptMark(rel string, mark WatermarkMark) DecryptResult {
+	fields, text, status := DecodeStructuredPayload(mark.Payload)
+	result := DecryptResult{
+		Path:    rel,
+		Index:   mark.Index,
+		Owner:   mark.Owner,
+		Format:  mark.Format,
+		Payload: mark.Payload,
+		Status:  status,
+		KeyID:   PayloadKeyID(mark.Payload),
+		Fields:  fields,
+	}
+	switch {
+	case fields != nil:
+		result.Text = fields.Text()
+	case status == WatermarkValid || status == WatermarkLegacy:
+		result.Text = text
+	default:
+		result.Error = "watermark " + string(status)
+	}
+	return result
+}
+
+// WriteCSV writes one line per result with a header row
+func (r *DecryptReport) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	header := []string{"path", "index", "owner", "format", "payload", "text", "status", "key_id",
+		"order_id", "copy_index", "recipient_id", "issued_at", "issuer", "error"}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	for _, row := range r.Results {
+		var index, orderID, copyIndex, recipientID, issuedAt, issuer string
+		if row.Payload != "" {
+			index = strconv.Itoa(row.Index)
+		}
+		if f := row.Fields; f != nil {
+			orderID, recipientID, issuer = f.OrderID, f.RecipientID, f.Issuer
+			if f.CopyIndex > 0 {
+				copyIndex = strconv.Itoa(f.CopyIndex)
+			}
+			if !f.IssuedAt.IsZero() {
+				issuedAt = f.IssuedAt.Format(time.RFC3339)
+			}
+		}
+		record := []string{
+			row.Path,
+			index,
+			row.Owner,
+			row.Format,
+			row.Payload,
+			row.Text,
+			string(row.Status),
+			row.KeyID,
+			orderID,
+			copyIndex,
+			recipientID,
+			issuedAt,
+			issuer,
+			row.Error,
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// decryptTestPayload seals a structured payload for copy 2 of order 042
+func decryptTestPayload(t *testing.T) string {
+	t.Helper()
+	structured, err := EncodeStructuredPayload(WatermarkPayload{
+		OrderID:     "042",
+		CopyIndex:   2,
+		RecipientID: "client-7",
+		IssuedAt:    time.Date(2026, 5, 1, 12, 30, 0, 0, time.UTC),
+		Issuer:      "studio",
+		BaseText:    "Project Alpha",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return structured
+}
+
+func TestDecryptMark(t *testing.T) {
+	useWatermarkSecret(t, "test-secret")
+	structured := decryptTestPayload(t)
+
+	tests := []struct {
+		name       string
+		payload    string
+		wantText   string
+		wantStatus WatermarkStatus
+		wantKeyID  string
+		wantFields bool
+		wantError  string
+	}{
+		{"structured", structured, "Project Alpha 042", WatermarkValid, DEFAULT_KEY_ID, true, ""},
+		{"keyed flat", EncodePayload("Project Alpha 042"), "Project Alpha 042", WatermarkValid, DEFAULT_KEY_ID, false, ""},
+		{"flat legacy", "Alza 890", "Test 123", WatermarkLegacy, "", false, ""},
+		{"tampered", sealedWith(t, "other-secret", "Project Alpha 042"), "", WatermarkTampered, DEFAULT_KEY_ID, false, "watermark tampered"},
+		{"unknown key", WATERMARK_V2_TAG + "retired." + "AAAA", "", WatermarkUnknownKey, "retired", false, "watermark unknown_key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mark := WatermarkMark{Index: 1, Owner: "studio", Format: "trailer record", Payload: tt.payload}
+			result := decryptMark("photos/a.jpg", mark)
+			if result.Path != "photos/a.jpg" || result.Index != 1 || result.Owner != "studio" ||
+				result.Format != "trailer record" || result.Payload != tt.payload {
+				t.Errorf("mark fields not copied: %+v", result)
+			}
+			if result.Text != tt.wantText || result.Status != tt.wantStatus || result.KeyID != tt.wantKeyID ||
+				(result.Fields != nil) != tt.wantFields || result.Error != tt.wantError {
+				t.Errorf("decrypted %+v", result)
+			}
+		})
+	}
+}
+
+func TestDecryptReportWriteCSV(t *testing.T) {
+	useWatermarkSecret(t, "test-secret")
+	structured := decryptTestPayload(t)
+	tampered := sealedWith(t, "other-secret", "Project Alpha 042")
+	report := &DecryptReport{Results: []DecryptResult{
+		decryptMark("a.avi", WatermarkMark{Index: 0, Owner: "studio", Format: "trailer record", Payload: structured}),
+		decryptMark("a.avi", WatermarkMark{Index: 1, Format: "plain trailer", Payload: "Alza 890"}),
+		decryptMark("b.avi", WatermarkMark{Index: 0, Format: "trailer record", Payload: tampered}),
+		{Path: "c.avi"},
+	}}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"path", "index", "owner", "format", "payload", "text", "status", "key_id",
+			"order_id", "copy_index", "recipient_id", "issued_at", "issuer", "error"},
+		{"a.avi", "0", "studio", "trailer record", structured, "Project Alpha 042", "valid", "default",
+			"042", "2", "client-7", "2026-05-01T12:30:00Z", "studio", ""},
+		{"a.avi", "1", "", "plain trailer", "Alza 890", "Test 123", "legacy", "", "", "", "", "", "", ""},
+		{"b.avi", "0", "", "trailer record", tampered, "", "tampered", "default", "", "", "", "", "", "watermark tampered"},
+		{"c.avi", "", "", "", "", "", "", "", "", "", "", "", "", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("CSV rows\n%q\nwant\n%q", rows, want)
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"regexp"
+)
+
+// Text-based documents carry each mark as a base64 line the format itself
+// ignores: an XML/HTML comment or a "#" comment row. Base64 keeps the owner
+// separator and any "--" in payloads out of the markup. The raw <<== ==>>
+// mark is what gets encoded, so extraction returns the same bytes as every
+// other container.
+const DOCUMENT_WATERMARK_TAG = "endc-watermark"
+
+// markupContainer embeds marks as comments in SVG and HTML files
+type markupContainer struct {
+	format string
+	// closers are the tags to insert before, in order of preference; the
+	// mark is appended at the end when none of them is present
+	closers []string
+}
+
+var (
+	svgContainer  = markupContainer{format: "SVG comment", closers: []string{"</svg>"}}
+	htmlContainer = markupContainer{format: "HTML comment", closers: []string{"</head>", "</body>", "</html>"}}
+
+	markupMarkPattern = regexp.MustCompile(`<!-- ` + DOCUMENT_WATERMARK_TAG + ` ([A-Za-z0-9+/=]*) -->\n`)
+	csvMarkPattern    = regexp.MustCompile(`\n# ` + DOCUMENT_WATERMARK_TAG + ` ([A-Za-z0-9+/=]*)`)
+)
+
+func (c markupContainer) name() string { return c.format }
+
+func (c markupContainer) embed(filePath string, mark []byte) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	comment := []byte("<!-- " + DOCUMENT_WATERMARK_TAG + " " + base64.StdEncoding.EncodeToString(mark) + " -->\n")
+
+	insertAt := len(data)
+	lower := bytes.ToLower(data)
+	for _, closer := range c.closers {
+		if i := bytes.LastIndex(lower, []byte(closer)); i >= 0 {
+			insertAt = i
+			break
+		}
+	}
+	// Later marks go after earlier ones even when the closer moved
+	if matches := markupMarkPattern.FindAllIndex(data, -1); len(matches) > 0 {
+		if last := matches[len(matches)-1][1]; last > insertAt {
+			insertAt = last
+		}
+	}
+
+	out := make([]byte, 0, len(data)+len(comment))
+	out = append(out, data[:insertAt]...)
+	out = append(out, comment...)
+	out = append(out, data[insertAt:]...)
+	return WriteFileAtomic(filePath, out)
+}
+
+func (c markupContainer) extract(filePath string) ([][]byte, error) {
+	return extractDocumentMarks(filePath, markupMarkPattern)
+}
+
+func (c markupContainer) remove(filePath string, drop func(index int) bool) (int, error) {
+	return removeDocumentMarks(filePath, markupMarkPattern, drop)
+}
+
+// csvContainer appends each mark as a trailing "# endc-watermark" comment row
+type csvContainer struct{}
+
+func (csvContainer) name() string { return "CSV comment row" }
+
+func (csvContainer) embed(filePath string, mark []byte) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// The row starts with its own line break, so cutting it restores the file exactly
+	_, err = file.WriteString("\n# " + DOCUMENT_WATERMARK_TAG + " " + base64.StdEncoding.EncodeToString(mark))
+	return err
+}
+
+func (csvContainer) extract(filePath string) ([][]byte, error) {
+	return extractDocumentMarks(filePath, csvMarkPattern)
+}
+
+func (csvContainer) remove(filePath string, drop func(index int) bool) (int, error) {
+	return removeDocumentMarks(filePath, csvMarkPattern, drop)
+}
+
+// extractDocumentMarks decodes every base64 mark matched by pattern
+func extractDocumentMarks(filePath string, pattern *regexp.Regexp) ([][]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var marks [][]byte
+	for _, match := range pattern.FindAllSubmatch(data, -1) {
+		mark, err := base64.StdEncoding.DecodeString(string(match[1]))
+		if err != nil {
+			continue
+		}
+		marks = append(marks, mark)
+	}
+	return marks, nil
+}
+
+// removeDocumentMarks cuts the marks matched by pattern for which drop(index) is true
+func removeDocumentMarks(filePath string, pattern *regexp.Regexp, drop func(index int) bool) (int, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	out := make([]byte, 0, len(data))
+	last, index, removed := 0, 0, 0
+	for _, match := range pattern.FindAllSubmatchIndex(data, -1) {
+		// Same indexing as extractDocumentMarks, which skips undecodable marks
+		if _, err := base64.StdEncoding.DecodeString(string(data[match[2]:match[3]])); err != nil {
+			continue
+		}
+		if drop == nil || drop(index) {
+			out = append(out, data[last:match[0]]...)
+			last = match[1]
+			removed++
+		}
+		index++
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	out = append(out, data[last:]...)
+	return removed, WriteFileAtomic(filePath, out)
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// markBefore reports an error unless every mark comment comes before closer
+func markBefore(closer string) func([]byte) error {
+	return func(data []byte) error {
+		matches := markupMarkPattern.FindAllIndex(data, -1)
+		at := bytes.LastIndex(bytes.ToLower(data), []byte(closer))
+		if len(matches) == 0 || at < 0 || matches[len(matches)-1][1] > at {
+			return fmt.Errorf("mark comments are not before %s", closer)
+		}
+		return nil
+	}
+}
+
+func TestDocumentWatermarkRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		content   string
+		container containerFormat
+		valid     func([]byte) error
+	}{
+		{"SVG", "logo.svg", `<svg xmlns="http://www.w3.org/2000/svg"><rect width="1" height="1"/></svg>` + "\n", svgContainer, markBefore("</svg>")},
+		{"HTML head", "page.html", "<html><head><title>T</title></head><body><p>x</p></body></html>", htmlContainer, markBefore("</head>")},
+		{"HTML upper case", "page.htm", "<HTML><HEAD></HEAD><BODY></BODY></HTML>", htmlContainer, markBefore("</head>")},
+		{"HTML body only", "page.html", "<body><p>x</p></body>", htmlContainer, markBefore("</body>")},
+		{"HTML fragment", "page.html", "<p>no closing tags", htmlContainer, nil},
+		{"CSV", "table.csv", "a,b\n1,2\n", csvContainer{}, nil},
+		{"CSV without final newline", "table.csv", "a,b\n1,2", csvContainer{}, nil},
+		{"empty CSV", "table.csv", "", csvContainer{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, tt.file, []byte(tt.content))
+			checkContainerRoundTrip(t, tt.container, path, tt.valid)
+		})
+	}
+}
+
+func TestDocumentWatermarkMalformed(t *testing.T) {
+	valid := buildWatermark("payload")
+	tests := []struct {
+		name      string
+		file      string
+		content   string
+		container containerFormat
+	}{
+		{"HTML bad base64", "page.html", "<!-- " + DOCUMENT_WATERMARK_TAG + " ==== -->\n", htmlContainer},
+		{"HTML comment without newline", "page.html", "<!-- " + DOCUMENT_WATERMARK_TAG + " PDw9PXg9PT4+ -->", htmlContainer},
+		{"HTML other tag", "page.html", "<!-- other-tag PDw9PXg9PT4+ -->\n", htmlContainer},
+		{"SVG unterminated comment", "logo.svg", "<svg><!-- " + DOCUMENT_WATERMARK_TAG + " PDw9PXg9PT4+</svg>", svgContainer},
+		{"CSV bad base64", "table.csv", "a,b\n# " + DOCUMENT_WATERMARK_TAG + " ====", csvContainer{}},
+		{"CSV mark on first line", "table.csv", "# " + DOCUMENT_WATERMARK_TAG + " PDw9PXg9PT4+", csvContainer{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, tt.file, []byte(tt.content))
+			if marks, err := tt.container.extract(path); err != nil || len(marks) != 0 {
+				t.Errorf("extract = %q, %v; want no marks", marks, err)
+			}
+			if removed, err := tt.container.remove(path, nil); err != nil || removed != 0 {
+				t.Errorf("remove = %d, %v", removed, err)
+			}
+
+			// A later valid mark is still found, indexed and removed on its own
+			if err := tt.container.embed(path, valid); err != nil {
+				t.Fatal(err)
+			}
+			if marks, _ := tt.container.extract(path); len(marks) != 1 || !bytes.Equal(marks[0], valid) {
+				t.Fatalf("extracted %q, want the valid mark", marks)
+			}
+			if removed, err := tt.container.remove(path, func(index int) bool { return index == 0 }); err != nil || removed != 1 {
+				t.Fatalf("remove = %d, %v", removed, err)
+			}
+			if got := string(readTestFile(t, path)); got != tt.content {
+				t.Errorf("content after removal %q, want %q", got, tt.content)
+			}
+		})
+	}
+}
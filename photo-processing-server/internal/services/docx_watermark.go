@@ -0,0 +1,247 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DOCX marks are custom document properties in docProps/custom.xml, one
+// property per mark named "endc-watermark-<pid>", so Word keeps them on save
+// and shows them under File > Properties > Custom. The part, its content type
+// and its package relationship are created when the document has none.
+const (
+	docxCustomPart      = "docProps/custom.xml"
+	docxContentTypes    = "[Content_Types].xml"
+	docxPackageRels     = "_rels/.rels"
+	docxCustomFMTID     = "{D5CDD505-2E9C-101B-9397-08002B2CF9AE}"
+	docxCustomNamespace = "http://schemas.openxmlformats.org/officeDocument/2006/custom-properties"
+	docxVTNamespace     = "http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes"
+	docxCustomType      = "application/vnd.openxmlformats-officedocument.custom-properties+xml"
+	docxCustomRelType   = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/custom-properties"
+	MAX_DOCX_PART_SIZE  = 8 << 20
+)
+
+var (
+	zipSignature = []byte("PK\x03\x04")
+
+	docxMarkPattern = regexp.MustCompile(`<property\b[^>]*\bname="` + DOCUMENT_WATERMARK_TAG +
+		`-\d+"[^>]*>\s*<vt:lpwstr[^>]*>([A-Za-z0-9+/=]*)</vt:lpwstr>\s*</property>`)
+	docxPIDPattern       = regexp.MustCompile(`\bpid="(\d+)"`)
+	docxPropertiesCloser = regexp.MustCompile(`</(\w+:)?Properties>`)
+)
+
+type docxContainer struct{}
+
+func (docxContainer) name() string { return "DOCX custom property" }
+
+// readZipEntry returns the content of name, or nil if the archive has no such
+// entry. Parts over MAX_DOCX_PART_SIZE are refused rather than inflated.
+func readZipEntry(archive *zip.Reader, name string) ([]byte, error) {
+	for _, file := range archive.File {
+		if file.Name != name {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(io.LimitReader(rc, MAX_DOCX_PART_SIZE+1))
+		if err == nil && len(data) > MAX_DOCX_PART_SIZE {
+			return nil, fmt.Errorf("%s is larger than %d bytes", name, MAX_DOCX_PART_SIZE)
+		}
+		return data, err
+	}
+	return nil, nil
+}
+
+// rewriteZip copies the archive, replacing entries in replace and appending
+// those not present yet (in the order of added). Untouched entries are
+// copied without recompression.
+func rewriteZip(archive *zip.Reader, replace map[string][]byte, added []string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	write := func(header zip.FileHeader, data []byte) error {
+		header.CompressedSize64, header.UncompressedSize64, header.CRC32 = 0, 0, 0
+		w, err := writer.CreateHeader(&header)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	for _, file := range archive.File {
+		if data, ok := replace[file.Name]; ok {
+			if err := write(file.FileHeader, data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := writer.Copy(file); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range added {
+		if err := write(zip.FileHeader{Name: name, Method: zip.Deflate}, replace[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// insertBefore inserts addition before the last occurrence of closer
+func insertBefore(document []byte, closer string, addition string) ([]byte, error) {
+	i := bytes.LastIndex(document, []byte(closer))
+	if i < 0 {
+		return nil, fmt.Errorf("missing %s", closer)
+	}
+	out := make([]byte, 0, len(document)+len(addition))
+	out = append(out, document[:i]...)
+	out = append(out, addition...)
+	return append(out, document[i:]...), nil
+}
+
+func (docxContainer) embed(filePath string, mark []byte) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	custom, err := readZipEntry(archive, docxCustomPart)
+	if err != nil {
+		return err
+	}
+
+	replace := map[string][]byte{}
+	var added []string
+	if custom == nil {
+		custom = []byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+			`<Properties xmlns="` + docxCustomNamespace + `" xmlns:vt="` + docxVTNamespace + `"></Properties>`)
+		added = append(added, docxCustomPart)
+
+		contentTypes, err := readZipEntry(archive, docxContentTypes)
+		if err != nil {
+			return err
+		}
+		if contentTypes == nil {
+			return fmt.Errorf("not an Office Open XML document")
+		}
+		if !bytes.Contains(contentTypes, []byte(`PartName="/`+docxCustomPart+`"`)) {
+			override := `<Override PartName="/` + docxCustomPart + `" ContentType="` + docxCustomType + `"/>`
+			if replace[docxContentTypes], err = insertBefore(contentTypes, "</Types>", override); err != nil {
+				return err
+			}
+		}
+
+		rels, err := readZipEntry(archive, docxPackageRels)
+		if err != nil {
+			return err
+		}
+		if rels != nil && !bytes.Contains(rels, []byte(docxCustomRelType)) {
+			relation := `<Relationship Id="rIdEndc1" Type="` + docxCustomRelType + `" Target="` + docxCustomPart + `"/>`
+			if replace[docxPackageRels], err = insertBefore(rels, "</Relationships>", relation); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Property IDs start at 2 and must be unique within the part
+	pid := 2
+	for _, match := range docxPIDPattern.FindAllSubmatch(custom, -1) {
+		if n, err := strconv.Atoi(string(match[1])); err == nil && n >= pid {
+			pid = n + 1
+		}
+	}
+	vt := ""
+	if !bytes.Contains(custom, []byte(`xmlns:vt=`)) {
+		vt = ` xmlns:vt="` + docxVTNamespace + `"`
+	}
+	property := fmt.Sprintf(`<property fmtid="%s" pid="%d" name="%s-%d"><vt:lpwstr%s>%s</vt:lpwstr></property>`,
+		docxCustomFMTID, pid, DOCUMENT_WATERMARK_TAG, pid, vt, base64.StdEncoding.EncodeToString(mark))
+
+	closer := docxPropertiesCloser.FindAllIndex(custom, -1)
+	if len(closer) == 0 {
+		return fmt.Errorf("%s has no Properties element", docxCustomPart)
+	}
+	at := closer[len(closer)-1][0]
+	replace[docxCustomPart] = []byte(string(custom[:at]) + property + string(custom[at:]))
+
+	out, err := rewriteZip(archive, replace, added)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(filePath, out)
+}
+
+func (docxContainer) extract(filePath string) ([][]byte, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, nil
+	}
+	defer archive.Close()
+	custom, err := readZipEntry(&archive.Reader, docxCustomPart)
+	if err != nil || custom == nil {
+		return nil, err
+	}
+
+	var marks [][]byte
+	for _, match := range docxMarkPattern.FindAllSubmatch(custom, -1) {
+		if mark, err := base64.StdEncoding.DecodeString(string(match[1])); err == nil {
+			marks = append(marks, mark)
+		}
+	}
+	return marks, nil
+}
+
+func (docxContainer) remove(filePath string, drop func(index int) bool) (int, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 0, nil
+	}
+	custom, err := readZipEntry(archive, docxCustomPart)
+	if err != nil || custom == nil {
+		return 0, err
+	}
+
+	var kept strings.Builder
+	last, index, removed := 0, 0, 0
+	for _, match := range docxMarkPattern.FindAllSubmatchIndex(custom, -1) {
+		if _, err := base64.StdEncoding.DecodeString(string(custom[match[2]:match[3]])); err != nil {
+			continue
+		}
+		if drop == nil || drop(index) {
+			kept.Write(custom[last:match[0]])
+			last = match[1]
+			removed++
+		}
+		index++
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	kept.Write(custom[last:])
+
+	out, err := rewriteZip(archive, map[string][]byte{docxCustomPart: []byte(kept.String())}, nil)
+	if err != nil {
+		return removed, err
+	}
+	return removed, WriteFileAtomic(filePath, out)
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const (
+	testDocxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="xml" ContentType="application/xml"/></Types>`
+	testDocxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/></Relationships>`
+	testDocxBody   = `<w:document><w:body><w:p><w:r><w:t>Hello</w:t></w:r></w:p></w:body></w:document>`
+	testDocxCustom = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Properties xmlns="` + docxCustomNamespace + `" xmlns:vt="` + docxVTNamespace + `"><property fmtid="` + docxCustomFMTID + `" pid="5" name="Client"><vt:lpwstr>ACME</vt:lpwstr></property></Properties>`
+)
+
+// buildTestDocx zips entries (name, content pairs) in order
+func buildTestDocx(t *testing.T, entries ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(entries); i += 2 {
+		w, err := writer.Create(entries[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entries[i+1]))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readTestDocx returns every entry of the archive by name
+func readTestDocx(data []byte) (map[string]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	entries := map[string]string{}
+	for _, file := range archive.File {
+		content, err := readZipEntry(archive, file.Name)
+		if err != nil {
+			return nil, err
+		}
+		entries[file.Name] = string(content)
+	}
+	return entries, nil
+}
+
+func TestDocxWatermarkRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		custom bool
+	}{
+		{"without custom properties", false},
+		{"with custom properties", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := []string{docxContentTypes, testDocxContentTypes, docxPackageRels, testDocxRels, "word/document.xml", testDocxBody}
+			if tt.custom {
+				entries = append(entries, docxCustomPart, testDocxCustom)
+			}
+			path := writeTestFile(t, "report.docx", buildTestDocx(t, entries...))
+
+			first := buildWatermark("first-payload")
+			second := buildWatermark(strings.Repeat("second-", 40))
+			for _, mark := range [][]byte{first, second} {
+				if err := (docxContainer{}).embed(path, mark); err != nil {
+					t.Fatalf("embed: %v", err)
+				}
+			}
+			if detected := containerFormatFor(path); detected == nil || detected.name() != (docxContainer{}).name() {
+				t.Fatalf("marked file detected as %v", detected)
+			}
+
+			files, err := readTestDocx(readTestFile(t, path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if files["word/document.xml"] != testDocxBody {
+				t.Error("document body changed")
+			}
+			if tt.custom {
+				if !strings.Contains(files[docxCustomPart], `name="Client"`) || !strings.Contains(files[docxCustomPart], `pid="6"`) {
+					t.Errorf("existing property lost or its pid reused: %s", files[docxCustomPart])
+				}
+			} else {
+				// The part is declared once, however many marks it holds
+				if n := strings.Count(files[docxContentTypes], `PartName="/`+docxCustomPart+`"`); n != 1 {
+					t.Errorf("%d content type overrides for the custom part, want 1", n)
+				}
+				if n := strings.Count(files[docxPackageRels], docxCustomRelType); n != 1 {
+					t.Errorf("%d relationships to the custom part, want 1", n)
+				}
+			}
+
+			marks, err := (docxContainer{}).extract(path)
+			if err != nil || len(marks) != 2 || !bytes.Equal(marks[0], first) || !bytes.Equal(marks[1], second) {
+				t.Fatalf("extracted %q, %v; want both marks in order", marks, err)
+			}
+			if removed, err := (docxContainer{}).remove(path, func(index int) bool { return index == 0 }); err != nil || removed != 1 {
+				t.Fatalf("remove first: %d, %v", removed, err)
+			}
+			if marks, _ := (docxContainer{}).extract(path); len(marks) != 1 || !bytes.Equal(marks[0], second) {
+				t.Fatalf("after removing the first mark extracted %q", marks)
+			}
+			if removed, err := (docxContainer{}).remove(path, nil); err != nil || removed != 1 {
+				t.Fatalf("remove rest: %d, %v", removed, err)
+			}
+
+			files, err = readTestDocx(readTestFile(t, path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.custom && files[docxCustomPart] != testDocxCustom {
+				t.Errorf("custom properties not restored: %s", files[docxCustomPart])
+			}
+			if strings.Contains(files[docxCustomPart], DOCUMENT_WATERMARK_TAG) {
+				t.Error("watermark property left behind")
+			}
+		})
+	}
+}
+
+func TestDocxWatermarkMalformed(t *testing.T) {
+	noCloser := strings.Replace(testDocxCustom, "</Properties>", "", 1)
+	badBase64 := strings.Replace(testDocxCustom, "</Properties>",
+		`<property fmtid="`+docxCustomFMTID+`" pid="6" name="`+DOCUMENT_WATERMARK_TAG+`-6"><vt:lpwstr>@@@</vt:lpwstr></property>`+
+			`<property fmtid="`+docxCustomFMTID+`" pid="7" name="`+DOCUMENT_WATERMARK_TAG+`-7"><vt:lpwstr>====</vt:lpwstr></property></Properties>`, 1)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		wantEmbed bool
+	}{
+		{"not a zip", []byte("PK\x03\x04 not really"), false},
+		{"zip without content types", buildTestDocx(t, "word/document.xml", testDocxBody), false},
+		{"content types without closer", buildTestDocx(t, docxContentTypes, "<Types>"), false},
+		{"custom part without Properties", buildTestDocx(t, docxContentTypes, testDocxContentTypes, docxCustomPart, noCloser), false},
+		{"undecodable property", buildTestDocx(t, docxContentTypes, testDocxContentTypes, docxCustomPart, badBase64), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, "report.docx", tt.data)
+			if marks, err := (docxContainer{}).extract(path); err != nil || len(marks) != 0 {
+				t.Errorf("extract = %q, %v; want no marks", marks, err)
+			}
+			if removed, err := (docxContainer{}).remove(path, nil); err != nil || removed != 0 {
+				t.Errorf("remove = %d, %v", removed, err)
+			}
+			if err := (docxContainer{}).embed(path, buildWatermark("x")); (err == nil) != tt.wantEmbed {
+				t.Errorf("embed error %v, want success %v", err, tt.wantEmbed)
+			}
+		})
+	}
+}
+
+func TestDocxWatermarkOversizedPart(t *testing.T) {
+	huge := "<Properties>" + strings.Repeat(" ", MAX_DOCX_PART_SIZE) + "</Properties>"
+	path := writeTestFile(t, "report.docx", buildTestDocx(t, docxContentTypes, testDocxContentTypes, docxCustomPart, huge))
+	if _, err := (docxContainer{}).extract(path); err == nil {
+		t.Error("oversized custom part was read")
+	}
+	if err := (docxContainer{}).embed(path, buildWatermark("x")); err == nil {
+		t.Error("embedded into an oversized custom part")
+	}
+}
+
+func TestDocxWatermarkTruncated(t *testing.T) {
+	path := writeTestFile(t, "report.docx", buildTestDocx(t, docxContentTypes, testDocxContentTypes, docxPackageRels, testDocxRels))
+	if err := (docxContainer{}).embed(path, buildWatermark("payload")); err != nil {
+		t.Fatal(err)
+	}
+	checkTruncations(t, docxContainer{}, "report.docx", readTestFile(t, path))
+}
@@ -1,10 +1,13 @@
 package services
 
 import (
+	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"os"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 const (
@@ -14,27 +17,48 @@ const (
 	OLD_WATERMARK_PREFIX = "*/"
 )
 
-// EncodeText applies Caesar cipher with shift=7 (exact port from Kotlin)
+// Text watermark modes, selectable per job
+const (
+	TEXT_MARK_VISIBLE    = "visible"    // <<==payload==>> appended to the end
+	TEXT_MARK_ZERO_WIDTH = "zero-width" // payload hidden as zero-width characters in the body
+)
+
+// Zero-width frames: WORD JOINER starts a frame, ZERO WIDTH SPACE and
+// ZERO WIDTH NON-JOINER carry 0 and 1 bits of uvarint(length) + payload +
+// CRC-32. A frame follows every ZERO_WIDTH_FRAME_INTERVAL-th word, so any
+// excerpt of that many words still carries a whole frame.
+const (
+	ZW_FRAME_START            = '\u2060'
+	ZW_BIT_0                  = '\u200B'
+	ZW_BIT_1                  = '\u200C'
+	ZERO_WIDTH_FRAME_INTERVAL = 32
+	MAX_ZERO_WIDTH_FRAMES     = 256
+	MAX_ZERO_WIDTH_PAYLOAD    = 64 << 10
+)
+
+// EncodeText applies Caesar cipher with shift=7 (exact port from Kotlin).
+// Only ASCII letters and digits shift; other UTF-8 characters pass through
+// unchanged so non-English names survive the round trip.
 func EncodeText(text string) string {
 	var result strings.Builder
 	
 	for _, char := range text {
 		switch {
-		case unicode.IsUpper(char):
+		case char >= 'A' && char <= 'Z':
 			// Uppercase letters: (char - 'A' + SHIFT) % 26 + 'A'
 			index := int(char - 'A')
 			shifted := (index + SHIFT) % 26
 			newChar := rune('A' + shifted)
 			result.WriteRune(newChar)
 			
-		case unicode.IsLower(char):
+		case char >= 'a' && char <= 'z':
 			// Lowercase letters: (char - 'a' + SHIFT) % 26 + 'a'  
 			index := int(char - 'a')
 			shifted := (index + SHIFT) % 26
 			newChar := rune('a' + shifted)
 			result.WriteRune(newChar)
 			
-		case unicode.IsDigit(char):
+		case char >= '0' && char <= '9':
 			// Digits: (digit + SHIFT) % 10
 			digit := int(char - '0')
 			shifted := (digit + SHIFT) % 10
@@ -55,21 +79,21 @@ func DecodeText(text string) string {
 	
 	for _, char := range text {
 		switch {
-		case unicode.IsUpper(char):
+		case char >= 'A' && char <= 'Z':
 			// Uppercase letters: (char - 'A' - SHIFT + 26) % 26 + 'A'
 			index := int(char - 'A')
 			shifted := (index - SHIFT + 26) % 26
 			newChar := rune('A' + shifted)
 			result.WriteRune(newChar)
 			
-		case unicode.IsLower(char):
+		case char >= 'a' && char <= 'z':
 			// Lowercase letters: (char - 'a' - SHIFT + 26) % 26 + 'a'
 			index := int(char - 'a')
 			shifted := (index - SHIFT + 26) % 26
 			newChar := rune('a' + shifted)
 			result.WriteRune(newChar)
 			
-		case unicode.IsDigit(char):
+		case char >= '0' && char <= '9':
 			// Digits: (digit - SHIFT + 10) % 10
 			digit := int(char - '0')
 			shifted := (digit - SHIFT + 10) % 10
@@ -84,9 +108,10 @@ func DecodeText(text string) string {
 	return result.String()
 }
 
-// AddWatermark creates watermark in format <<==[encoded text]==>> (exact port from Kotlin)
+// AddWatermark creates watermark in format <<==[encoded text]==>>.
+// Uses the keyed v2 payload when a secret is configured, Caesar otherwise.
 func AddWatermark(text string) string {
-	encoded := EncodeText(text)
+	encoded := EncodePayload(text)
 	return fmt.Sprintf("%s%s%s", WATERMARK_PREFIX, encoded, WATERMARK_SUFFIX)
 }
 
@@ -157,6 +182,170 @@ func ProcessFile(filePath string, watermark string) (bool, error) {
 	return true, nil
 }
 
+// CheckTextMarkMode rejects unknown text watermark modes; empty means visible
+func CheckTextMarkMode(mode string) error {
+	switch mode {
+	case "", TEXT_MARK_VISIBLE, TEXT_MARK_ZERO_WIDTH:
+		return nil
+	}
+	return fmt.Errorf("unknown text watermark mode %q", mode)
+}
+
+// zeroWidthFrame encodes payload as one zero-width frame
+func zeroWidthFrame(payload string) string {
+	data := binary.AppendUvarint(nil, uint64(len(payload)))
+	data = append(data, payload...)
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE([]byte(payload)))
+
+	var frame strings.Builder
+	frame.WriteRune(ZW_FRAME_START)
+	for _, b := range data {
+		for bit := 7; bit >= 0; bit-- {
+			if b&(1<<bit) != 0 {
+				frame.WriteRune(ZW_BIT_1)
+			} else {
+				frame.WriteRune(ZW_BIT_0)
+			}
+		}
+	}
+	return frame.String()
+}
+
+// EmbedZeroWidth hides payload in content, one frame after the first word
+// and then after every ZERO_WIDTH_FRAME_INTERVAL-th word. Text without word
+// breaks gets a single frame at the end. Frames of earlier marks stay in place.
+func EmbedZeroWidth(content string, payload string) string {
+	frame := zeroWidthFrame(payload)
+
+	var out strings.Builder
+	out.Grow(len(content) + len(frame)*4)
+	words, frames := 0, 0
+	inWord := false
+	for i := 0; i < len(content); {
+		r, size := utf8.DecodeRuneInString(content[i:])
+		isSpace := unicode.IsSpace(r)
+		if isSpace && inWord {
+			// Word ended: append after any zero-width runs already attached to it
+			if words%ZERO_WIDTH_FRAME_INTERVAL == 0 && frames < MAX_ZERO_WIDTH_FRAMES {
+				out.WriteString(frame)
+				frames++
+			}
+			words++
+		}
+		if !isZeroWidthRune(r) {
+			inWord = !isSpace
+		}
+		out.WriteString(content[i : i+size])
+		i += size
+	}
+	if frames == 0 {
+		out.WriteString(frame)
+	}
+	return out.String()
+}
+
+func isZeroWidthRune(r rune) bool {
+	return r == ZW_FRAME_START || r == ZW_BIT_0 || r == ZW_BIT_1
+}
+
+// zeroWidthSpan is a decoded frame and its byte range in the content
+type zeroWidthSpan struct {
+	payload    string
+	start, end int
+}
+
+// findZeroWidthFrames decodes every intact frame. Frames cut by a partial
+// copy or damaged by editing fail the length or CRC check and are skipped.
+func findZeroWidthFrames(content string) []zeroWidthSpan {
+	var spans []zeroWidthSpan
+	for pos := 0; pos < len(content); {
+		i := strings.IndexRune(content[pos:], ZW_FRAME_START)
+		if i < 0 {
+			break
+		}
+		start := pos + i
+		end := start + utf8.RuneLen(ZW_FRAME_START)
+
+		// Collect the bit run up to the next non-bit rune
+		var data []byte
+		var cur byte
+		bits := 0
+		for end < len(content) {
+			r, size := utf8.DecodeRuneInString(content[end:])
+			if r != ZW_BIT_0 && r != ZW_BIT_1 {
+				break
+			}
+			cur <<= 1
+			if r == ZW_BIT_1 {
+				cur |= 1
+			}
+			if bits++; bits%8 == 0 {
+				data = append(data, cur)
+				cur = 0
+			}
+			end += size
+		}
+		pos = end
+
+		// The length is untrusted; compare it without arithmetic that could wrap
+		length, n := binary.Uvarint(data)
+		if n <= 0 || len(data)-n < 4 || length > MAX_ZERO_WIDTH_PAYLOAD || length > uint64(len(data)-n-4) {
+			continue
+		}
+		payload := data[n : n+int(length)]
+		sum := binary.BigEndian.Uint32(data[n+int(length):])
+		if crc32.ChecksumIEEE(payload) != sum {
+			continue
+		}
+		// Use the exact frame extent, ignoring stray bits after it
+		frameEnd := start + len(zeroWidthFrame(string(payload)))
+		spans = append(spans, zeroWidthSpan{payload: string(payload), start: start, end: frameEnd})
+	}
+	return spans
+}
+
+// ExtractZeroWidth returns the distinct zero-width payloads of content in
+// order of first appearance
+func ExtractZeroWidth(content string) []string {
+	var payloads []string
+	seen := map[string]bool{}
+	for _, span := range findZeroWidthFrames(content) {
+		if !seen[span.payload] {
+			seen[span.payload] = true
+			payloads = append(payloads, span.payload)
+		}
+	}
+	return payloads
+}
+
+// AddZeroWidthWatermark hides the owner-labelled mark in a text file's body
+func AddZeroWidthWatermark(filePath string, owner string, encodedText string) error {
+	logger := GetGlobalLogger()
+	if strings.Contains(owner, WATERMARK_OWNER_SEPARATOR) {
+		return fmt.Errorf("watermark owner must not contain the separator character")
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error processing file %s: %v", filePath, err))
+		return err
+	}
+	payload := ownedPayload(owner, encodedText)
+	for _, existing := range ExtractZeroWidth(string(content)) {
+		if existing == payload {
+			logger.Log(fmt.Sprintf("%s: Encrypted text already present", filePath))
+			return nil
+		}
+	}
+
+	if err := WriteFileAtomic(filePath, []byte(EmbedZeroWidth(string(content), payload))); err != nil {
+		logger.Error(fmt.Sprintf("Error writing watermark to %s: %v", filePath, err))
+		return err
+	}
+	logger.Success(getFileName(filePath))
+	return nil
+}
+
 // Helper function to get filename from path
 func getFileName(filePath string) string {
 	parts := strings.Split(filePath, "/")
@@ -177,6 +366,7 @@ func TestCaesarCipher() {
 		{"ABC", "HIJ"},
 		{"xyz", "efg"},
 		{"987", "654"},
+		{"Müller 001", "Tüssly 778"},
 	}
 	
 	logger := GetGlobalLogger()
@@ -208,9 +398,15 @@ func CreateEncodedWatermark(baseText string, orderNumber string) string {
 
 // ExtractAndDecodeWatermark extracts and decodes watermark from content
 func ExtractAndDecodeWatermark(content string) string {
+	decoded, _ := ExtractAndVerifyWatermark(content)
+	return decoded
+}
+
+// ExtractAndVerifyWatermark extracts, decodes and authenticates watermark from content
+func ExtractAndVerifyWatermark(content string) (string, WatermarkStatus) {
 	extracted := ExtractWatermark(content)
 	if extracted == "" {
-		return ""
+		return "", ""
 	}
-	return DecodeText(extracted)
+	return DecodePayload(extracted)
 }
\ No newline at end of file
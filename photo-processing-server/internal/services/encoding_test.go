@@ -0,0 +1,159 @@
+package services
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// zeroWidthBits spells data as a frame start and raw bits, without the
+// length prefix and CRC zeroWidthFrame adds
+func zeroWidthBits(data []byte) string {
+	var frame strings.Builder
+	frame.WriteRune(ZW_FRAME_START)
+	for _, b := range data {
+		for bit := 7; bit >= 0; bit-- {
+			if b&(1<<bit) != 0 {
+				frame.WriteRune(ZW_BIT_1)
+			} else {
+				frame.WriteRune(ZW_BIT_0)
+			}
+		}
+	}
+	return frame.String()
+}
+
+// testWords returns n short words separated by single spaces
+func testWords(n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = "word" + strings.Repeat("x", i%5)
+	}
+	return strings.Join(words, " ")
+}
+
+func stripZeroWidth(content string) string {
+	return strings.Map(func(r rune) rune {
+		if isZeroWidthRune(r) {
+			return -1
+		}
+		return r
+	}, content)
+}
+
+func TestZeroWidthRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		payload string
+	}{
+		{"empty content", "", "owner|Alzk 890"},
+		{"single word", "hello", "owner|Alzk 890"},
+		{"sentence", "The quick brown fox\njumps over\tthe lazy dog.\n", "owner|Alzk 890"},
+		{"many words", testWords(300), "owner|Alzk 890"},
+		{"non-ASCII content", "Grüße aus Köln — 東京 へようこそ", "owner|Tüssly 778"},
+		{"empty payload", "some words here", ""},
+		{"long payload", testWords(10), strings.Repeat("payload-", 500)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marked := EmbedZeroWidth(tt.content, tt.payload)
+			if !utf8.ValidString(marked) {
+				t.Fatal("marked text is not valid UTF-8")
+			}
+			if got := stripZeroWidth(marked); got != tt.content {
+				t.Fatalf("visible text changed: %q", got)
+			}
+			if got := ExtractZeroWidth(marked); !reflect.DeepEqual(got, []string{tt.payload}) {
+				t.Errorf("extracted %q, want %q", got, tt.payload)
+			}
+		})
+	}
+}
+
+func TestZeroWidthFrameInterval(t *testing.T) {
+	marked := EmbedZeroWidth(testWords(200), "payload")
+	if frames := len(findZeroWidthFrames(marked)); frames != 7 {
+		t.Errorf("%d frames in 200 words, want one per %d words (7)", frames, ZERO_WIDTH_FRAME_INTERVAL)
+	}
+
+	// Any run of ZERO_WIDTH_FRAME_INTERVAL words still carries the mark
+	words := strings.Fields(marked)
+	for start := 0; start+ZERO_WIDTH_FRAME_INTERVAL <= len(words); start++ {
+		excerpt := strings.Join(words[start:start+ZERO_WIDTH_FRAME_INTERVAL], " ")
+		if got := ExtractZeroWidth(excerpt); len(got) != 1 || got[0] != "payload" {
+			t.Fatalf("excerpt from word %d extracted %q", start, got)
+		}
+	}
+}
+
+func TestZeroWidthFrameLimit(t *testing.T) {
+	words := (MAX_ZERO_WIDTH_FRAMES + 10) * ZERO_WIDTH_FRAME_INTERVAL
+	if frames := len(findZeroWidthFrames(EmbedZeroWidth(testWords(words), "p"))); frames != MAX_ZERO_WIDTH_FRAMES {
+		t.Errorf("%d frames, want at most %d", frames, MAX_ZERO_WIDTH_FRAMES)
+	}
+}
+
+func TestZeroWidthSeveralMarks(t *testing.T) {
+	marked := EmbedZeroWidth(testWords(100), "first")
+	marked = EmbedZeroWidth(marked, "second")
+	if got := ExtractZeroWidth(marked); !reflect.DeepEqual(got, []string{"first", "second"}) {
+		t.Errorf("extracted %q, want first and second", got)
+	}
+	if got := stripZeroWidth(marked); got != testWords(100) {
+		t.Error("second mark changed the visible text")
+	}
+}
+
+func TestFindZeroWidthFramesMalformed(t *testing.T) {
+	frame := zeroWidthFrame("payload")
+	valid := []byte("\x07payload")
+	valid = binary.BigEndian.AppendUint32(valid, crc32.ChecksumIEEE([]byte("payload")))
+	badCRC := append([]byte(nil), valid...)
+	badCRC[len(badCRC)-1] ^= 1
+	tooLong := binary.AppendUvarint(nil, MAX_ZERO_WIDTH_PAYLOAD+1)
+	tooLong = append(tooLong, make([]byte, 8)...)
+	wrapping := binary.AppendUvarint(nil, math.MaxUint64-2)
+	wrapping = append(wrapping, make([]byte, 8)...)
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"frame start only", string(ZW_FRAME_START)},
+		{"bad CRC", zeroWidthBits(badCRC)},
+		{"truncated frame", frame[:len(frame)-utf8.RuneLen(ZW_BIT_0)*9]},
+		{"length past data", zeroWidthBits([]byte{0x7F, 'a', 0, 0, 0, 0})},
+		{"length over limit", zeroWidthBits(tooLong)},
+		{"length near 2^64", zeroWidthBits(wrapping)},
+		{"unterminated uvarint", zeroWidthBits([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF})},
+		{"bit split by text", frame[:40] + "x" + frame[40:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractZeroWidth("text " + tt.content + " more"); got != nil {
+				t.Errorf("extracted %q from a damaged frame", got)
+			}
+		})
+	}
+
+	// A damaged frame does not hide an intact one after it
+	content := zeroWidthBits(badCRC) + " " + frame
+	if got := ExtractZeroWidth(content); !reflect.DeepEqual(got, []string{"payload"}) {
+		t.Errorf("extracted %q, want the intact frame", got)
+	}
+}
+
+func TestZeroWidthFrameExtent(t *testing.T) {
+	// Stray bits after a frame are not part of it
+	frame := zeroWidthFrame("payload")
+	content := "a" + frame + string([]rune{ZW_BIT_1, ZW_BIT_0, ZW_BIT_1}) + " b"
+	spans := findZeroWidthFrames(content)
+	if len(spans) != 1 || spans[0].payload != "payload" || content[spans[0].start:spans[0].end] != frame {
+		t.Errorf("spans %+v, want the frame alone", spans)
+	}
+}
@@ -35,6 +35,18 @@ var imageExtensions = map[string]bool{
 	"png":  true,
 }
 
+// Document file extensions, marked inside their own metadata or markup. They
+// are not supportedExtensions: only jobs that embed or read document marks
+// list them, through GetMarkableFiles.
+var documentExtensions = map[string]bool{
+	"pdf":  true,
+	"docx": true,
+	"svg":  true,
+	"html": true,
+	"htm":  true,
+	"csv":  true,
+}
+
 // CopyDirectory copies source directory to destination (exact port from Kotlin)
 func CopyDirectory(source, destination string) error {
 	logger := GetGlobalLogger()
@@ -138,6 +150,29 @@ func GetSupportedFiles(directory string) ([]string, error) {
 	return supportedFiles, nil
 }
 
+// GetMarkableFiles returns the supported files of directory plus its
+// documents (PDF, DOCX, SVG, HTML, CSV)
+func GetMarkableFiles(directory string) ([]string, error) {
+	logger := GetGlobalLogger()
+	var files []string
+
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			logger.Error(fmt.Sprintf("Error accessing path %s: %v", path, err))
+			return nil // Continue walking despite errors
+		}
+		if !info.IsDir() && (IsSupportedFile(path) || IsDocumentFile(path)) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error getting files from directory %s: %v", directory, err))
+		return nil, err
+	}
+	return files, nil
+}
+
 // CountFiles counts supported files in directory (exact port from Kotlin)
 func CountFiles(directory string) (int, error) {
 	logger := GetGlobalLogger()
@@ -202,6 +237,16 @@ func IsTextFile(filePath string) bool {
 	return ext == "txt"
 }
 
+// IsDocumentFile checks if file is a PDF, DOCX, SVG, HTML or CSV document
+func IsDocumentFile(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	// Remove the dot from extension
+	if len(ext) > 1 {
+		ext = ext[1:]
+	}
+	return documentExtensions[ext]
+}
+
 // IsSupportedFile checks if file has supported extension
 func IsSupportedFile(filePath string) bool {
 	ext := strings.ToLower(filepath.Ext(filePath))
@@ -278,4 +323,34 @@ func CleanupTempFiles(tempDir string) error {
 	
 	logger.Log("Temp files cleaned up")
 	return nil
-}
\ No newline at end of file
+}
+
+// WriteFileAtomic replaces file contents via a temp file and rename,
+// preserving the original file mode
+func WriteFileAtomic(filePath string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filePath); err == nil {
+		mode = info.Mode()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".tmp_"+filepath.Base(filePath))
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
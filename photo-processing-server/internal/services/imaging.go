@@ -1,12 +1,20 @@
 package services
 
 import (
+    "errors"
     "fmt"
     "image"
     "image/color"
+    "image/draw"
+    _ "image/png"
+    "math"
+    "os"
     "path/filepath"
+    "strings"
+    "sync"
 
     "gocv.io/x/gocv"
+    xdraw "golang.org/x/image/draw"
 )
 
 // TextPosition represents position for visible watermarks (exact port from Kotlin enum)
@@ -18,6 +26,8 @@ const (
 	Center
 	BottomLeft
 	BottomRight
+	// Tiled repeats the text diagonally across the whole image (see tiled_watermark.go)
+	Tiled
 )
 
 // OpenCV parameters (exact port from Kotlin constants)
@@ -27,6 +37,10 @@ const (
 	THICKNESS    = 1
 	ALPHA        = 0.5
 	PADDING      = 5
+	
+	// VISIBLE_TEXT_MIN_CONTRAST is the brightness gain (0-255) of text pixels
+	// over their surroundings above which a visible watermark counts as present
+	VISIBLE_TEXT_MIN_CONTRAST = 25.0
 )
 
 var (
@@ -57,8 +71,18 @@ func initializeOpenCV() error {
 
 // AddTextToImage adds semi-transparent visible watermark to image (exact port from Kotlin)
 func AddTextToImage(imagePath string, text string, position TextPosition) error {
+	return AddStyledTextToImage(imagePath, text, position, nil)
+}
+
+// AddStyledTextToImage adds a visible watermark drawn with style; a nil
+// style draws exactly what AddTextToImage always has
+func AddStyledTextToImage(imagePath string, text string, position TextPosition, style *VisibleWatermarkStyle) error {
 	logger := GetGlobalLogger()
 	
+	if err := style.Validate(); err != nil {
+		return err
+	}
+	
 	// Initialize OpenCV if needed
 	err := initializeOpenCV()
 	if err != nil {
@@ -75,52 +99,33 @@ func AddTextToImage(imagePath string, text string, position TextPosition) error
 	defer img.Close()
 	
 	// Get text size for positioning
-	textSize := gocv.GetTextSize(text, FONT_FACE, FONT_SCALE, THICKNESS)
-	
-	// Calculate text position based on enum value (exact port from Kotlin when expression)
-	var textPoint image.Point
 	imgSize := img.Size()
+	layout := layoutVisibleText(style, text, imgSize[1], imgSize[0], position)
 	
-	switch position {
-	case BottomRight:
-		textPoint = image.Point{
-			X: imgSize[1] - textSize.X - PADDING,
-			Y: imgSize[0] - PADDING,
-		}
-	case BottomLeft:
-		textPoint = image.Point{
-			X: PADDING,
-			Y: imgSize[0] - PADDING,
+	if position == Tiled {
+		if err := drawTiledText(&img, text, layout, style); err != nil {
+			return err
 		}
-	case TopRight:
-		textPoint = image.Point{
-			X: imgSize[1] - textSize.X - PADDING,
-			Y: textSize.Y + PADDING,
-		}
-	case TopLeft:
-		textPoint = image.Point{
-			X: PADDING,
-			Y: textSize.Y + PADDING,
-		}
-	case Center:
-		textPoint = image.Point{
-			X: (imgSize[1] - textSize.X) / 2,
-			Y: (imgSize[0] + textSize.Y) / 2,
+	} else if layout.trueType != nil {
+		if err := drawTextLayer(&img, text, layout, style); err != nil {
+			return err
 		}
+	} else if style.isDefault() {
+		// Create overlay Mat for alpha blending (draw only the text)
+		overlay := gocv.NewMatWithSize(imgSize[0], imgSize[1], gocv.MatTypeCV8UC3)
+		defer overlay.Close()
+		// Fill overlay with zeros (no darkening outside text)
+		overlay.SetTo(gocv.NewScalar(0, 0, 0, 0))
+		
+		// Draw text on overlay in white
+		gocv.PutText(&overlay, text, layout.origin, layout.font, layout.scale, WHITE_COLOR, layout.thickness)
+		
+		// Blend: keep base image weight 1.0, add only overlay with ALPHA
+		gocv.AddWeighted(img, 1.0, overlay, ALPHA, 0.0, &img)
+	} else {
+		drawStyledText(&img, text, layout, style)
 	}
 	
-	// Create overlay Mat for alpha blending (draw only the text)
-	overlay := gocv.NewMatWithSize(imgSize[0], imgSize[1], gocv.MatTypeCV8UC3)
-	defer overlay.Close()
-	// Fill overlay with zeros (no darkening outside text)
-	overlay.SetTo(gocv.NewScalar(0, 0, 0, 0))
-	
-	// Draw text on overlay in white
-	gocv.PutText(&overlay, text, textPoint, FONT_FACE, FONT_SCALE, WHITE_COLOR, THICKNESS)
-	
-	// Blend: keep base image weight 1.0, add only overlay with ALPHA
-	gocv.AddWeighted(img, 1.0, overlay, ALPHA, 0.0, &img)
-	
 	// Save image
 	success := gocv.IMWrite(imagePath, img)
 	if success {
@@ -134,11 +139,282 @@ func AddTextToImage(imagePath string, text string, position TextPosition) error
 	return nil
 }
 
+// textOrigin calculates the text baseline origin for a position (exact port from Kotlin when expression)
+func textOrigin(width int, height int, textSize image.Point, padding int, position TextPosition) image.Point {
+	switch position {
+	case BottomRight:
+		return image.Point{X: width - textSize.X - padding, Y: height - padding}
+	case BottomLeft:
+		return image.Point{X: padding, Y: height - padding}
+	case TopRight:
+		return image.Point{X: width - textSize.X - padding, Y: textSize.Y + padding}
+	case TopLeft:
+		return image.Point{X: padding, Y: textSize.Y + padding}
+	case Center:
+		return image.Point{X: (width - textSize.X) / 2, Y: (height + textSize.Y) / 2}
+	}
+	return image.Point{}
+}
+
+// DetectVisibleText checks whether text was stamped at position by
+// AddStyledTextToImage with style. The text is re-rendered as a mask and the
+// brightness of masked pixels is compared with the unmasked pixels around
+// them; the additive white overlay leaves them VISIBLE_TEXT_MIN_CONTRAST or
+// more brighter. Dark styled text is expected to be that much darker instead.
+func DetectVisibleText(imagePath string, text string, position TextPosition, style *VisibleWatermarkStyle) (bool, float64, error) {
+	if err := initializeOpenCV(); err != nil {
+		return false, 0, err
+	}
+	
+	gray := gocv.IMRead(imagePath, gocv.IMReadGrayScale)
+	if gray.Empty() {
+		return false, 0, fmt.Errorf("failed to load image: %s", filepath.Base(imagePath))
+	}
+	defer gray.Close()
+	
+	// Dark styled text lowers the brightness of text pixels instead
+	sign := 1.0
+	if style.expectsDarkText() {
+		sign = -1
+	}
+	
+	height, width := gray.Rows(), gray.Cols()
+	layout := layoutVisibleText(style, text, width, height, position)
+	if position == Tiled {
+		contrast, err := tiledTextContrast(gray, text, layout, style)
+		if err != nil {
+			return false, 0, err
+		}
+		return sign*contrast >= VISIBLE_TEXT_MIN_CONTRAST, contrast, nil
+	}
+	origin, textSize := layout.origin, layout.size
+	
+	var covered func(x, y int) bool
+	if layout.trueType != nil {
+		glyphs, err := layout.trueType.mask(text, layout.pixelSize, origin)
+		if err != nil {
+			return false, 0, err
+		}
+		covered = func(x, y int) bool { return glyphs.AlphaAt(x, y).A >= 128 }
+	} else {
+		mask := gocv.NewMatWithSize(height, width, gocv.MatTypeCV8U)
+		defer mask.Close()
+		mask.SetTo(gocv.NewScalar(0, 0, 0, 0))
+		gocv.PutText(&mask, text, origin, layout.font, layout.scale, WHITE_COLOR, layout.thickness)
+		covered = func(x, y int) bool { return mask.GetUCharAt(y, x) > 0 }
+	}
+	
+	// Text box plus a margin for descenders, stroke width, outline and
+	// shadow, which count as surroundings
+	margin := PADDING + layout.thickness - THICKNESS
+	if style != nil {
+		margin += style.Outline + style.Shadow
+	}
+	box := image.Rect(origin.X-margin, origin.Y-textSize.Y-margin, origin.X+textSize.X+margin, origin.Y+margin).
+		Intersect(image.Rect(0, 0, width, height))
+	var pix []uint8
+	var inText []bool
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			pix = append(pix, gray.GetUCharAt(y, x))
+			inText = append(inText, covered(x, y))
+		}
+	}
+	
+	contrast := visibleTextContrast(pix, inText)
+	return sign*contrast >= VISIBLE_TEXT_MIN_CONTRAST, contrast, nil
+}
+
+// visibleTextContrast is the mean brightness of text pixels minus that of
+// the surrounding pixels
+func visibleTextContrast(pix []uint8, inText []bool) float64 {
+	var textSum, bgSum, textCount, bgCount float64
+	for i, v := range pix {
+		if inText[i] {
+			textSum += float64(v)
+			textCount++
+		} else {
+			bgSum += float64(v)
+			bgCount++
+		}
+	}
+	if textCount == 0 || bgCount == 0 {
+		return 0
+	}
+	return textSum/textCount - bgSum/bgCount
+}
+
 // AddTextToImageAtPosition is a convenience function with default position
 func AddTextToImageAtPosition(imagePath string, text string) error {
 	return AddTextToImage(imagePath, text, BottomRight)
 }
 
+// LogoWatermark stamps the configured logo (WATERMARK_LOGO) onto photos,
+// keeping the logo's per-pixel alpha
+type LogoWatermark struct {
+	// Scale is the logo's longer side as a fraction of the shorter image
+	// side, so the logo looks the same on any resolution; 0 means LOGO_DEFAULT_SCALE
+	Scale float64 `json:"scale,omitempty"`
+	// Position is a VISIBLE_POSITIONS name other than "tiled", "bottom-right" by default
+	Position string `json:"position,omitempty"`
+	// OffsetX and OffsetY move the logo from its anchor, in pixels; positive is right and down
+	OffsetX int     `json:"offsetX,omitempty"`
+	OffsetY int     `json:"offsetY,omitempty"`
+	Opacity float64 `json:"opacity,omitempty"` // 0-1, multiplied by the logo's alpha; 0 means opaque
+}
+
+// Logo overlay defaults and limits
+const (
+	LOGO_DEFAULT_SCALE = 0.15
+	MAX_LOGO_SCALE     = 1.0
+)
+
+var (
+	watermarkLogo      *image.RGBA // premultiplied, nil when no logo is configured
+	watermarkLogoMutex sync.RWMutex
+)
+
+// LoadWatermarkLogo decodes the PNG logo used by LogoWatermark. An empty
+// path or a missing file leaves logo watermarks unavailable.
+func LoadWatermarkLogo(path string) error {
+    var logo *image.RGBA
+    if path != "" {
+        file, err := os.Open(path)
+        if err != nil && !os.IsNotExist(err) {
+            return err
+        }
+        if err == nil {
+            defer file.Close()
+            decoded, _, err := image.Decode(file)
+            if err != nil {
+                return fmt.Errorf("failed to decode watermark logo %s: %v", filepath.Base(path), err)
+            }
+            // Drawing into RGBA premultiplies the alpha, as blendLayer expects
+            logo = image.NewRGBA(image.Rect(0, 0, decoded.Bounds().Dx(), decoded.Bounds().Dy()))
+            draw.Draw(logo, logo.Rect, decoded, decoded.Bounds().Min, draw.Src)
+            GetGlobalLogger().Log(fmt.Sprintf("Loaded watermark logo %s (%dx%d)", filepath.Base(path), logo.Rect.Dx(), logo.Rect.Dy()))
+        }
+    }
+    watermarkLogoMutex.Lock()
+    watermarkLogo = logo
+    watermarkLogoMutex.Unlock()
+    return nil
+}
+
+// HasWatermarkLogo reports whether a logo is configured
+func HasWatermarkLogo() bool {
+	watermarkLogoMutex.RLock()
+	defer watermarkLogoMutex.RUnlock()
+	return watermarkLogo != nil
+}
+
+// Validate checks the placement and that a logo is configured; nil is valid
+func (l *LogoWatermark) Validate() error {
+	if l == nil {
+		return nil
+	}
+	if !HasWatermarkLogo() {
+		return fmt.Errorf("no watermark logo configured, set WATERMARK_LOGO to a PNG file")
+	}
+	if l.Scale < 0 || l.Scale > MAX_LOGO_SCALE {
+		return fmt.Errorf("logo scale must be between 0 and %g", MAX_LOGO_SCALE)
+	}
+	if position, ok := VISIBLE_POSITIONS[l.positionName()]; !ok || position == Tiled {
+		return fmt.Errorf("unknown logo position %q", l.Position)
+	}
+	if l.OffsetX < -MAX_VISIBLE_PADDING || l.OffsetX > MAX_VISIBLE_PADDING || l.OffsetY < -MAX_VISIBLE_PADDING || l.OffsetY > MAX_VISIBLE_PADDING {
+		return fmt.Errorf("logo offsets must be between -%d and %d pixels", MAX_VISIBLE_PADDING, MAX_VISIBLE_PADDING)
+	}
+	if l.Opacity < 0 || l.Opacity > 1 {
+		return fmt.Errorf("logo opacity must be between 0 and 1")
+	}
+	return nil
+}
+
+func (l *LogoWatermark) positionName() string {
+	if l.Position == "" {
+		return "bottom-right"
+	}
+	return strings.ToLower(l.Position)
+}
+
+// AddLogoToImage alpha-composites the configured logo onto the image
+func AddLogoToImage(imagePath string, logo *LogoWatermark) error {
+    logger := GetGlobalLogger()
+    if logo == nil {
+        logo = &LogoWatermark{}
+    }
+    if err := logo.Validate(); err != nil {
+        return err
+    }
+    if err := initializeOpenCV(); err != nil {
+        return err
+    }
+
+    img := gocv.IMRead(imagePath, gocv.IMReadColor)
+    if img.Empty() {
+        return fmt.Errorf("failed to load image: %s", filepath.Base(imagePath))
+    }
+    defer img.Close()
+
+    watermarkLogoMutex.RLock()
+    source := watermarkLogo
+    watermarkLogoMutex.RUnlock()
+
+    layer := scaleLogo(source, logo.Scale, img.Cols(), img.Rows())
+    size := layer.Rect.Size()
+    origin := logoOrigin(img.Cols(), img.Rows(), size, VISIBLE_POSITIONS[logo.positionName()])
+    layer.Rect = layer.Rect.Add(origin.Add(image.Point{X: logo.OffsetX, Y: logo.OffsetY}))
+
+    opacity := logo.Opacity
+    if opacity == 0 {
+        opacity = 1
+    }
+    blendLayer(&img, layer, opacity, false)
+
+    if !gocv.IMWrite(imagePath, img) {
+        errMsg := fmt.Sprintf("Failed to save image %s", filepath.Base(imagePath))
+        logger.Error(errMsg)
+        return errors.New(errMsg)
+    }
+    logger.Log(fmt.Sprintf("Added logo to %s", filepath.Base(imagePath)))
+    return nil
+}
+
+// scaleLogo resizes the logo so its longer side is scale times the shorter
+// side of a width×height image
+func scaleLogo(logo *image.RGBA, scale float64, width int, height int) *image.RGBA {
+	if scale == 0 {
+		scale = LOGO_DEFAULT_SCALE
+	}
+	logoWidth, logoHeight := float64(logo.Rect.Dx()), float64(logo.Rect.Dy())
+	factor := scale * math.Min(float64(width), float64(height)) / math.Max(logoWidth, logoHeight)
+	size := image.Point{
+		X: int(math.Max(1, math.Round(logoWidth*factor))),
+		Y: int(math.Max(1, math.Round(logoHeight*factor))),
+	}
+	scaled := image.NewRGBA(image.Rectangle{Max: size})
+	// Premultiplied pixels interpolate without dark fringes at transparent edges
+	xdraw.CatmullRom.Scale(scaled, scaled.Rect, logo, logo.Rect, xdraw.Src, nil)
+	return scaled
+}
+
+// logoOrigin returns the top-left corner of a logo of size at position,
+// PADDING away from the image edges like visible text
+func logoOrigin(width int, height int, size image.Point, position TextPosition) image.Point {
+	switch position {
+	case TopLeft:
+		return image.Point{X: PADDING, Y: PADDING}
+	case TopRight:
+		return image.Point{X: width - size.X - PADDING, Y: PADDING}
+	case BottomLeft:
+		return image.Point{X: PADDING, Y: height - size.Y - PADDING}
+	case Center:
+		return image.Point{X: (width - size.X) / 2, Y: (height - size.Y) / 2}
+	}
+	return image.Point{X: width - size.X - PADDING, Y: height - size.Y - PADDING}
+}
+
 // ProcessImageWithVisibleWatermark processes image file with visible watermark
 func ProcessImageWithVisibleWatermark(filePath string, watermarkText string, photoNumber int) error {
 	if !IsImageFile(filePath) {
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// useWatermarkLogo configures a half-transparent width×height PNG logo for
+// the duration of the test
+func useWatermarkLogo(t *testing.T, width int, height int) {
+	t.Helper()
+	logo := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			logo.SetNRGBA(x, y, color.NRGBA{R: 200, G: 100, B: 50, A: 128})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, logo); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadWatermarkLogo(writeTestFile(t, "logo.png", buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { LoadWatermarkLogo("") })
+}
+
+func TestLoadWatermarkLogo(t *testing.T) {
+	useWatermarkLogo(t, 4, 2)
+	watermarkLogoMutex.RLock()
+	logo := watermarkLogo
+	watermarkLogoMutex.RUnlock()
+	if logo == nil || logo.Rect != image.Rect(0, 0, 4, 2) {
+		t.Fatalf("loaded logo %v", logo)
+	}
+	// Stored premultiplied: 200·128/255 ≈ 100
+	if got := logo.RGBAAt(1, 1); got.A != 128 || got.R < 99 || got.R > 101 {
+		t.Errorf("logo pixel %v, want premultiplied alpha", got)
+	}
+
+	if err := LoadWatermarkLogo(writeTestFile(t, "logo.png", []byte("not a PNG"))); err == nil {
+		t.Error("invalid logo was loaded")
+	}
+	if err := LoadWatermarkLogo(writeTestFile(t, "logo.png", nil) + ".missing"); err != nil || HasWatermarkLogo() {
+		t.Errorf("missing logo: error %v, configured %v", err, HasWatermarkLogo())
+	}
+}
+
+func TestScaleLogo(t *testing.T) {
+	tests := []struct {
+		name          string
+		logo          image.Point
+		scale         float64
+		width, height int
+		want          image.Point
+	}{
+		{"wide logo", image.Point{X: 200, Y: 100}, 0.5, 800, 600, image.Point{X: 300, Y: 150}},
+		{"default scale", image.Point{X: 200, Y: 100}, 0, 800, 600, image.Point{X: 90, Y: 45}},
+		{"tall logo", image.Point{X: 50, Y: 200}, 0.25, 400, 1000, image.Point{X: 25, Y: 100}},
+		{"upscaled", image.Point{X: 10, Y: 10}, 1, 300, 200, image.Point{X: 200, Y: 200}},
+		{"rounded", image.Point{X: 300, Y: 200}, 0.1, 1000, 1000, image.Point{X: 100, Y: 67}},
+		{"at least one pixel", image.Point{X: 1000, Y: 10}, 0.01, 100, 100, image.Point{X: 1, Y: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scaled := scaleLogo(image.NewRGBA(image.Rectangle{Max: tt.logo}), tt.scale, tt.width, tt.height)
+			if scaled.Rect != (image.Rectangle{Max: tt.want}) {
+				t.Errorf("scaled to %v, want %v", scaled.Rect, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogoOrigin(t *testing.T) {
+	size := image.Point{X: 100, Y: 50}
+	tests := []struct {
+		position TextPosition
+		want     image.Point
+	}{
+		{TopLeft, image.Point{X: PADDING, Y: PADDING}},
+		{TopRight, image.Point{X: 800 - 100 - PADDING, Y: PADDING}},
+		{BottomLeft, image.Point{X: PADDING, Y: 600 - 50 - PADDING}},
+		{BottomRight, image.Point{X: 800 - 100 - PADDING, Y: 600 - 50 - PADDING}},
+		{Center, image.Point{X: 350, Y: 275}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.position), func(t *testing.T) {
+			if got := logoOrigin(800, 600, size, tt.position); got != tt.want {
+				t.Errorf("origin %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogoWatermarkValidate(t *testing.T) {
+	if err := (&LogoWatermark{}).Validate(); err == nil {
+		t.Error("logo placement accepted without a configured logo")
+	}
+	useWatermarkLogo(t, 4, 2)
+
+	tests := []struct {
+		name    string
+		logo    *LogoWatermark
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"zero", &LogoWatermark{}, false},
+		{"largest scale", &LogoWatermark{Scale: MAX_LOGO_SCALE}, false},
+		{"scale too large", &LogoWatermark{Scale: MAX_LOGO_SCALE + 0.1}, true},
+		{"negative scale", &LogoWatermark{Scale: -0.1}, true},
+		{"top-left", &LogoWatermark{Position: "top-left"}, false},
+		{"position any case", &LogoWatermark{Position: "Center"}, false},
+		{"tiled", &LogoWatermark{Position: "tiled"}, true},
+		{"unknown position", &LogoWatermark{Position: "middle"}, true},
+		{"offsets at limits", &LogoWatermark{OffsetX: -MAX_VISIBLE_PADDING, OffsetY: MAX_VISIBLE_PADDING}, false},
+		{"offset X too large", &LogoWatermark{OffsetX: MAX_VISIBLE_PADDING + 1}, true},
+		{"offset Y too small", &LogoWatermark{OffsetY: -MAX_VISIBLE_PADDING - 1}, true},
+		{"full opacity", &LogoWatermark{Opacity: 1}, false},
+		{"opacity too high", &LogoWatermark{Opacity: 1.5}, true},
+		{"negative opacity", &LogoWatermark{Opacity: -0.5}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.logo.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
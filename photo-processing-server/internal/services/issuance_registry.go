@@ -0,0 +1,550 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"photo-processing-server/internal/models"
+)
+
+// IssuedFile is a delivered file with its content hash
+type IssuedFile struct {
+	Path   string `json:"path"` // relative to the copy folder
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	PHash  string `json:"phash,omitempty"` // images only
+	DHash  string `json:"dhash,omitempty"`
+	// VisibleText is the visible watermark stamped on this photo, if any
+	VisibleText string `json:"visible_text,omitempty"`
+}
+
+// SimilarCopy is a delivered image close to a queried perceptual hash
+type SimilarCopy struct {
+	IssuanceID    string    `json:"issuance_id"`
+	JobID         string    `json:"job_id,omitempty"`
+	Recipient     string    `json:"recipient,omitempty"`
+	OrderNumber   string    `json:"order_number"`
+	CopyNumber    int       `json:"copy_number"`
+	IssuedAt      time.Time `json:"issued_at"`
+	Path          string    `json:"path"`
+	PHashDistance int       `json:"phash_distance"`
+	DHashDistance int       `json:"dhash_distance"`
+	NameMatch     bool      `json:"name_match"` // same file name as the query
+}
+
+// IssuedWatermark records one watermarked copy produced by a batch
+type IssuedWatermark struct {
+	ID           string                 `json:"id"`
+	JobID        string                 `json:"job_id,omitempty"`
+	UserID       string                 `json:"user_id,omitempty"`
+	Recipient    string                 `json:"recipient,omitempty"`
+	Owner        string                 `json:"owner,omitempty"` // owner label of the mark in the file's chain
+	SourceFolder string                 `json:"source_folder"`
+	CopyFolder   string                 `json:"copy_folder"`
+	OrderNumber  string                 `json:"order_number"`
+	CopyNumber   int                    `json:"copy_number"`
+	Text         string                 `json:"text"`
+	Payload      string                 `json:"payload"`
+	KeyID        string                 `json:"key_id,omitempty"`
+	VisibleStyle *VisibleWatermarkStyle `json:"visible_style,omitempty"`
+	Swaps        []models.SwapOperation `json:"swaps,omitempty"` // file swaps of the copy, in order
+	Files        []IssuedFile           `json:"files"`
+	IssuedAt     time.Time              `json:"issued_at"`
+	DuplicateOf  []string               `json:"duplicate_of,omitempty"`
+}
+
+// IssuanceFilter narrows registry queries; empty fields match everything
+type IssuanceFilter struct {
+	OrderNumber  string
+	JobID        string
+	UserID       string
+	Recipient    string
+	Text         string
+	SHA256       string
+	SourceFolder string
+}
+
+// IssuanceRegistry persists every issued watermark in an append-only JSON
+// lines file, so the web server and the CLI share one history. Records are
+// held in memory and indexed by text, file hash, order, job and source folder.
+type IssuanceRegistry struct {
+	mutex    sync.Mutex
+	path     string
+	records  []IssuedWatermark
+	byID     map[string]int
+	byText   map[string][]int // lower-cased watermark text
+	bySHA256 map[string][]int // lower-cased file hash
+	byOrder  map[string][]int
+	byJob    map[string][]int
+	bySource map[string][]int // cleaned source folder
+	images   []indexedImage
+}
+
+// indexedImage is the parsed perceptual hash of one delivered image
+type indexedImage struct {
+	record int
+	file   int
+	hash   PerceptualHash
+}
+
+var (
+	globalIssuanceRegistry *IssuanceRegistry
+	issuanceRegistryOnce   sync.Once
+)
+
+// GetIssuanceRegistry returns the global issuance registry
+func GetIssuanceRegistry() *IssuanceRegistry {
+	issuanceRegistryOnce.Do(func() {
+		globalIssuanceRegistry = &IssuanceRegistry{}
+		globalIssuanceRegistry.resetLocked()
+	})
+	return globalIssuanceRegistry
+}
+
+// Configure loads the registry file at path; an empty path keeps records in
+// memory only
+func (r *IssuanceRegistry) Configure(path string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.path = path
+	r.resetLocked()
+	if path == "" {
+		return nil
+	}
+	return r.loadFileLocked()
+}
+
+func (r *IssuanceRegistry) resetLocked() {
+	r.records = nil
+	r.byID = map[string]int{}
+	r.byText = map[string][]int{}
+	r.bySHA256 = map[string][]int{}
+	r.byOrder = map[string][]int{}
+	r.byJob = map[string][]int{}
+	r.bySource = map[string][]int{}
+	r.images = nil
+}
+
+// loadFileLocked indexes the records of the registry file. Lines that do not
+// parse, such as one cut short by a crash mid-append, are logged and skipped;
+// a final line without its newline is terminated so the next record starts
+// on a line of its own.
+func (r *IssuanceRegistry) loadFileLocked() error {
+	file, err := os.Open(r.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var record IssuedWatermark
+		if err := json.Unmarshal([]byte(line), &record); err != nil || record.ID == "" {
+			GetGlobalLogger().Error(fmt.Sprintf("Skipping invalid issuance record on line %d of %s: %v", lineNumber, r.path, err))
+			continue
+		}
+		r.indexLocked(record)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return terminateLastLine(file, r.path)
+}
+
+// terminateLastLine appends a newline to path unless it is empty or ends with one
+func terminateLastLine(file *os.File, path string) error {
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+	out, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = out.Write([]byte{'\n'})
+	return err
+}
+
+// Record stores a new issuance. Earlier records carrying the same watermark
+// text are listed in DuplicateOf and a warning is logged.
+func (r *IssuanceRegistry) Record(record *IssuedWatermark) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if record.ID == "" {
+		record.ID = uuid.New().String()
+	}
+	if record.IssuedAt.IsZero() {
+		record.IssuedAt = time.Now()
+	}
+
+	record.DuplicateOf = nil
+	for _, i := range r.byText[strings.ToLower(record.Text)] {
+		if strings.EqualFold(r.records[i].Text, record.Text) {
+			record.DuplicateOf = append(record.DuplicateOf, r.records[i].ID)
+		}
+	}
+	if len(record.DuplicateOf) > 0 {
+		GetGlobalLogger().Error(fmt.Sprintf("Duplicate issuance: watermark %q was already issued %d time(s)",
+			record.Text, len(record.DuplicateOf)))
+	}
+	return r.appendLocked(*record)
+}
+
+// appendLocked writes a record to the file and indexes it
+func (r *IssuanceRegistry) appendLocked(record IssuedWatermark) error {
+	if r.path != "" {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if err := EnsureDirectoryExists(filepath.Dir(r.path)); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if _, err := file.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	r.indexLocked(record)
+	return nil
+}
+
+func (r *IssuanceRegistry) indexLocked(record IssuedWatermark) {
+	i := len(r.records)
+	r.records = append(r.records, record)
+	r.byID[record.ID] = i
+	r.byText[strings.ToLower(record.Text)] = append(r.byText[strings.ToLower(record.Text)], i)
+	r.byOrder[record.OrderNumber] = append(r.byOrder[record.OrderNumber], i)
+	if record.JobID != "" {
+		r.byJob[record.JobID] = append(r.byJob[record.JobID], i)
+	}
+	source := filepath.Clean(record.SourceFolder)
+	r.bySource[source] = append(r.bySource[source], i)
+
+	hashed := map[string]bool{}
+	for j, file := range record.Files {
+		sum := strings.ToLower(file.SHA256)
+		if sum != "" && !hashed[sum] {
+			hashed[sum] = true
+			r.bySHA256[sum] = append(r.bySHA256[sum], i)
+		}
+		if file.PHash == "" {
+			continue
+		}
+		pHash, errP := ParseHash(file.PHash)
+		dHash, errD := ParseHash(file.DHash)
+		if errP == nil && errD == nil {
+			r.images = append(r.images, indexedImage{record: i, file: j, hash: PerceptualHash{PHash: pHash, DHash: dHash}})
+		}
+	}
+}
+
+// candidatesLocked returns the indexes of records that may match filter,
+// narrowed by the most selective indexed field; nil means every record
+func (r *IssuanceRegistry) candidatesLocked(filter IssuanceFilter) ([]int, bool) {
+	switch {
+	case filter.SHA256 != "":
+		return r.bySHA256[strings.ToLower(filter.SHA256)], true
+	case filter.Text != "":
+		return r.byText[strings.ToLower(filter.Text)], true
+	case filter.OrderNumber != "":
+		return r.byOrder[filter.OrderNumber], true
+	case filter.JobID != "":
+		return r.byJob[filter.JobID], true
+	case filter.SourceFolder != "":
+		return r.bySource[filepath.Clean(filter.SourceFolder)], true
+	}
+	return nil, false
+}
+
+// List returns records matching filter, newest first
+func (r *IssuanceRegistry) List(filter IssuanceFilter) ([]IssuedWatermark, error) {
+	r.mutex.Lock()
+	matches := []IssuedWatermark{}
+	if indexes, narrowed := r.candidatesLocked(filter); narrowed {
+		for _, i := range indexes {
+			if filter.matches(r.records[i]) {
+				matches = append(matches, r.records[i])
+			}
+		}
+	} else {
+		for _, record := range r.records {
+			if filter.matches(record) {
+				matches = append(matches, record)
+			}
+		}
+	}
+	r.mutex.Unlock()
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].IssuedAt.After(matches[j].IssuedAt)
+	})
+	return matches, nil
+}
+
+// Get returns a record by ID
+func (r *IssuanceRegistry) Get(id string) (*IssuedWatermark, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	i, ok := r.byID[id]
+	if !ok {
+		return nil, false
+	}
+	record := r.records[i]
+	return &record, true
+}
+
+// Duplicates returns records whose watermark text was issued more than once
+func (r *IssuanceRegistry) Duplicates() ([]IssuedWatermark, error) {
+	r.mutex.Lock()
+	duplicates := []IssuedWatermark{}
+	for _, indexes := range r.byText {
+		if len(indexes) > 1 {
+			for _, i := range indexes {
+				duplicates = append(duplicates, r.records[i])
+			}
+		}
+	}
+	r.mutex.Unlock()
+
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].IssuedAt.After(duplicates[j].IssuedAt)
+	})
+	return duplicates, nil
+}
+
+func (f IssuanceFilter) matches(record IssuedWatermark) bool {
+	if f.OrderNumber != "" && record.OrderNumber != f.OrderNumber {
+		return false
+	}
+	if f.JobID != "" && record.JobID != f.JobID {
+		return false
+	}
+	if f.UserID != "" && record.UserID != f.UserID {
+		return false
+	}
+	if f.Recipient != "" && !strings.EqualFold(record.Recipient, f.Recipient) {
+		return false
+	}
+	if f.Text != "" && !strings.EqualFold(record.Text, f.Text) {
+		return false
+	}
+	if f.SourceFolder != "" && filepath.Clean(record.SourceFolder) != filepath.Clean(f.SourceFolder) {
+		return false
+	}
+	if f.SHA256 != "" {
+		found := false
+		for _, file := range record.Files {
+			if strings.EqualFold(file.SHA256, f.SHA256) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// FindSimilar returns up to limit delivered images nearest to hash.
+// Copies within PHASH_MATCH_DISTANCE whose delivered file name equals
+// fileName rank first: swapping makes the name/content pairing unique per copy.
+func (r *IssuanceRegistry) FindSimilar(hash PerceptualHash, fileName string, limit int) ([]SimilarCopy, error) {
+	r.mutex.Lock()
+	results := make([]SimilarCopy, 0, len(r.images))
+	for _, image := range r.images {
+		record := &r.records[image.record]
+		file := record.Files[image.file]
+		pDist, dDist := hash.Distance(image.hash)
+		results = append(results, SimilarCopy{
+			IssuanceID:    record.ID,
+			JobID:         record.JobID,
+			Recipient:     record.Recipient,
+			OrderNumber:   record.OrderNumber,
+			CopyNumber:    record.CopyNumber,
+			IssuedAt:      record.IssuedAt,
+			Path:          file.Path,
+			PHashDistance: pDist,
+			DHashDistance: dDist,
+			NameMatch:     fileName != "" && strings.EqualFold(filepath.Base(file.Path), fileName),
+		})
+	}
+	r.mutex.Unlock()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		aClose, bClose := a.PHashDistance <= PHASH_MATCH_DISTANCE, b.PHashDistance <= PHASH_MATCH_DISTANCE
+		if aClose != bClose {
+			return aClose
+		}
+		if aClose && a.NameMatch != b.NameMatch {
+			return a.NameMatch
+		}
+		return a.PHashDistance+a.DHashDistance < b.PHashDistance+b.DHashDistance
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// FindIssuance matches leak evidence against the registry
+func (r *IssuanceRegistry) FindIssuance(evidence LeakEvidence) []IssuanceMatch {
+	if evidence.Extractor == ExtractorPerceptual {
+		return r.findPerceptualIssuance(evidence)
+	}
+
+	var filter IssuanceFilter
+	switch {
+	case evidence.Extractor == ExtractorHash:
+		filter.SHA256 = evidence.Text
+	case evidence.Extractor == ExtractorPixel:
+		filter.OrderNumber = evidence.OrderNumber
+	case evidence.OrderNumber != "":
+		filter.Text = evidence.Text
+	default:
+		return nil
+	}
+
+	records, err := r.List(filter)
+	if err != nil {
+		GetGlobalLogger().Error(fmt.Sprintf("Issuance lookup failed: %v", err))
+		return nil
+	}
+
+	matches := make([]IssuanceMatch, 0, len(records))
+	for _, record := range records {
+		matches = append(matches, IssuanceMatch{
+			Source:        "registry",
+			JobID:         record.JobID,
+			UserID:        record.UserID,
+			CustomerEmail: record.Recipient,
+			OrderNumber:   record.OrderNumber,
+			CopyNumber:    record.CopyNumber,
+			IssuedAt:      record.IssuedAt,
+			Extractor:     evidence.Extractor,
+		})
+	}
+	return matches
+}
+
+// findPerceptualIssuance matches a perceptual hash within PHASH_MATCH_DISTANCE
+func (r *IssuanceRegistry) findPerceptualIssuance(evidence LeakEvidence) []IssuanceMatch {
+	pHash, errP := ParseHash(evidence.PHash)
+	dHash, errD := ParseHash(evidence.DHash)
+	if errP != nil || errD != nil {
+		return nil
+	}
+
+	similar, err := r.FindSimilar(PerceptualHash{PHash: pHash, DHash: dHash}, evidence.FileName, 0)
+	if err != nil {
+		GetGlobalLogger().Error(fmt.Sprintf("Perceptual hash lookup failed: %v", err))
+		return nil
+	}
+
+	var matches []IssuanceMatch
+	for _, similarCopy := range similar {
+		if similarCopy.PHashDistance > PHASH_MATCH_DISTANCE {
+			break
+		}
+		matches = append(matches, IssuanceMatch{
+			Source:        "registry",
+			JobID:         similarCopy.JobID,
+			CustomerEmail: similarCopy.Recipient,
+			OrderNumber:   similarCopy.OrderNumber,
+			CopyNumber:    similarCopy.CopyNumber,
+			IssuedAt:      similarCopy.IssuedAt,
+			Extractor:     evidence.Extractor,
+			File:          similarCopy.Path,
+			Distance:      similarCopy.PHashDistance,
+			NameMatch:     similarCopy.NameMatch,
+		})
+	}
+	return matches
+}
+
+// hashCopyFiles computes SHA-256 hashes for every file in a copy folder,
+// plus perceptual hashes for images
+func hashCopyFiles(folder string) ([]IssuedFile, error) {
+	files := []IssuedFile{}
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(folder, path)
+		if err != nil {
+			return err
+		}
+		file := IssuedFile{Path: filepath.ToSlash(rel), SHA256: sum, Size: info.Size()}
+		if IsImageFile(path) {
+			if hash, err := ComputePerceptualHash(path); err == nil {
+				file.PHash = FormatHash(hash.PHash)
+				file.DHash = FormatHash(hash.DHash)
+			} else {
+				GetGlobalLogger().Error(fmt.Sprintf("Perceptual hash failed for %s: %v", filepath.Base(path), err))
+			}
+		}
+		files = append(files, file)
+		return nil
+	})
+	return files, err
+}
+
+// fileSHA256 returns the hex SHA-256 of a file
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestRegistry returns a registry backed by a file in a temporary folder
+func newTestRegistry(t *testing.T) (*IssuanceRegistry, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "issuance.jsonl")
+	registry := &IssuanceRegistry{}
+	if err := registry.Configure(path); err != nil {
+		t.Fatal(err)
+	}
+	return registry, path
+}
+
+// issuedIDs returns the IDs of records in order
+func issuedIDs(records []IssuedWatermark) []string {
+	ids := []string{}
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	return ids
+}
+
+// recordTestIssuances records three copies of two orders; "b" repeats the
+// text of "a" in another case
+func recordTestIssuances(t *testing.T, registry *IssuanceRegistry) {
+	t.Helper()
+	issuedAt := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	records := []IssuedWatermark{
+		{ID: "a", JobID: "job-1", OrderNumber: "042", CopyNumber: 1, Text: "Project 042", SourceFolder: "/src/a",
+			Files: []IssuedFile{{Path: "1.jpg", SHA256: "AAAA"}, {Path: "2.jpg", SHA256: "bbbb"}}},
+		{ID: "b", JobID: "job-1", OrderNumber: "042", CopyNumber: 2, Text: "project 042", SourceFolder: "/src/a/",
+			Files: []IssuedFile{{Path: "1.jpg", SHA256: "cccc"}}},
+		{ID: "c", JobID: "job-2", OrderNumber: "043", CopyNumber: 1, Text: "Project 043", SourceFolder: "/src/b",
+			Files: []IssuedFile{{Path: "1.jpg", SHA256: "bbbb"}}},
+	}
+	for i := range records {
+		records[i].IssuedAt = issuedAt.Add(time.Duration(i) * time.Hour)
+		if err := registry.Record(&records[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIssuanceRegistryReload(t *testing.T) {
+	registry, path := newTestRegistry(t)
+	recordTestIssuances(t, registry)
+
+	reloaded := &IssuanceRegistry{}
+	if err := reloaded.Configure(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, filter := range []IssuanceFilter{{}, {SHA256: "bbbb"}, {Text: "PROJECT 042"}, {OrderNumber: "042"}, {JobID: "job-2"}, {SourceFolder: "/src/a"}} {
+		want, _ := registry.List(filter)
+		got, _ := reloaded.List(filter)
+		if !reflect.DeepEqual(issuedIDs(got), issuedIDs(want)) {
+			t.Errorf("filter %+v lists %v after reload, want %v", filter, issuedIDs(got), issuedIDs(want))
+		}
+	}
+	record, ok := reloaded.Get("b")
+	if !ok || !reflect.DeepEqual(record.DuplicateOf, []string{"a"}) || len(record.Files) != 1 {
+		t.Errorf("reloaded record %+v", record)
+	}
+
+	// Records appended after a reload land in the same file
+	if err := reloaded.Record(&IssuedWatermark{ID: "d", OrderNumber: "044", Text: "Project 044"}); err != nil {
+		t.Fatal(err)
+	}
+	again := &IssuanceRegistry{}
+	if err := again.Configure(path); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := again.List(IssuanceFilter{}); len(all) != 4 {
+		t.Errorf("%d records after a second reload, want 4", len(all))
+	}
+}
+
+func TestIssuanceRegistryDuplicates(t *testing.T) {
+	registry, _ := newTestRegistry(t)
+	recordTestIssuances(t, registry)
+
+	if record, _ := registry.Get("a"); len(record.DuplicateOf) != 0 {
+		t.Errorf("first issuance lists duplicates %v", record.DuplicateOf)
+	}
+	if record, _ := registry.Get("b"); !reflect.DeepEqual(record.DuplicateOf, []string{"a"}) {
+		t.Errorf("repeated text lists duplicates %v, want [a]", record.DuplicateOf)
+	}
+	duplicates, err := registry.Duplicates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := issuedIDs(duplicates); !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Errorf("duplicates %v, want [b a]", got)
+	}
+
+	// An ID and issue time are filled in when missing
+	record := &IssuedWatermark{OrderNumber: "042", Text: "Project 042"}
+	if err := registry.Record(record); err != nil {
+		t.Fatal(err)
+	}
+	if record.ID == "" || record.IssuedAt.IsZero() || len(record.DuplicateOf) != 2 {
+		t.Errorf("recorded %+v", record)
+	}
+}
+
+func TestIssuanceRegistryList(t *testing.T) {
+	registry, _ := newTestRegistry(t)
+	recordTestIssuances(t, registry)
+
+	tests := []struct {
+		name   string
+		filter IssuanceFilter
+		want   []string
+	}{
+		{"all newest first", IssuanceFilter{}, []string{"c", "b", "a"}},
+		{"SHA256", IssuanceFilter{SHA256: "bbbb"}, []string{"c", "a"}},
+		{"SHA256 any case", IssuanceFilter{SHA256: "aaaa"}, []string{"a"}},
+		{"SHA256 unknown", IssuanceFilter{SHA256: "dddd"}, []string{}},
+		{"text any case", IssuanceFilter{Text: "PROJECT 042"}, []string{"b", "a"}},
+		{"text unknown", IssuanceFilter{Text: "Project 04"}, []string{}},
+		{"order", IssuanceFilter{OrderNumber: "043"}, []string{"c"}},
+		{"order and text", IssuanceFilter{OrderNumber: "043", Text: "Project 042"}, []string{}},
+		{"SHA256 and order", IssuanceFilter{SHA256: "bbbb", OrderNumber: "042"}, []string{"a"}},
+		{"job", IssuanceFilter{JobID: "job-1"}, []string{"b", "a"}},
+		{"source folder cleaned", IssuanceFilter{SourceFolder: "/src/a/"}, []string{"b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := registry.List(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := issuedIDs(records); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIssuanceRegistryInvalidLines(t *testing.T) {
+	registry, path := newTestRegistry(t)
+	recordTestIssuances(t, registry)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"garbage line", lines[0] + "not json\n" + lines[1] + lines[2] + "\n", []string{"c", "b", "a"}},
+		{"record without ID", lines[0] + "{\"text\":\"x\"}\n" + lines[1], []string{"b", "a"}},
+		{"blank lines", "\n" + lines[0] + "\n\n" + lines[1], []string{"b", "a"}},
+		{"truncated last line", lines[0] + lines[1] + lines[2][:len(lines[2])/2], []string{"b", "a"}},
+		{"empty file", "", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "issuance.jsonl")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			loaded := &IssuanceRegistry{}
+			if err := loaded.Configure(path); err != nil {
+				t.Fatalf("load failed: %v", err)
+			}
+			records, _ := loaded.List(IssuanceFilter{})
+			if got := issuedIDs(records); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("loaded %v, want %v", got, tt.want)
+			}
+
+			// A new record still reloads after the invalid line
+			if err := loaded.Record(&IssuedWatermark{ID: "new", OrderNumber: "050", Text: "Project 050"}); err != nil {
+				t.Fatal(err)
+			}
+			reloaded := &IssuanceRegistry{}
+			if err := reloaded.Configure(path); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := reloaded.Get("new"); !ok {
+				t.Error("record appended after the invalid line was lost")
+			}
+		})
+	}
+}
+
+func TestIssuanceRegistryFindSimilar(t *testing.T) {
+	registry, _ := newTestRegistry(t)
+	// pHash and dHash distances from the zero query hash are the bit counts
+	images := []struct {
+		id, path     string
+		pHash, dHash uint64
+	}{
+		{"near", "copy/a.jpg", 0x7, 0},                // 3 + 0
+		{"named", "copy/photo.jpg", 0xff, 0xf},        // 8 + 4, same name as the leak
+		{"cutoff", "copy/b.jpg", 0x3ff, 0},            // 10 + 0, exactly PHASH_MATCH_DISTANCE
+		{"beyond", "copy/c.jpg", 0x7ff, 0},            // 11 + 0, closer in sum than "named"
+		{"far named", "copy/PHOTO.jpg", 0xfffff, 0x1}, // 20 + 1
+	}
+	for i, image := range images {
+		record := &IssuedWatermark{ID: image.id, OrderNumber: fmt.Sprintf("%03d", i+1), Text: image.id,
+			Files: []IssuedFile{{Path: image.path, PHash: FormatHash(image.pHash), DHash: FormatHash(image.dHash)}}}
+		if err := registry.Record(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files without a valid perceptual hash are not indexed
+	unhashed := &IssuedWatermark{ID: "unhashed", Text: "unhashed", Files: []IssuedFile{
+		{Path: "notes.txt", SHA256: "aaaa"}, {Path: "bad.jpg", PHash: "zz", DHash: "00"}}}
+	if err := registry.Record(unhashed); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		fileName string
+		limit    int
+		want     []string
+	}{
+		{"by name then distance", "photo.jpg", 0, []string{"named", "near", "cutoff", "beyond", "far named"}},
+		{"within the cutoff first", "", 0, []string{"near", "cutoff", "named", "beyond", "far named"}},
+		{"limited", "photo.jpg", 2, []string{"named", "near"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			similar, err := registry.FindSimilar(PerceptualHash{}, tt.fileName, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, similarCopy := range similar {
+				got = append(got, similarCopy.IssuanceID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ranked %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	matches := registry.FindIssuance(LeakEvidence{Extractor: ExtractorPerceptual, PHash: FormatHash(0), DHash: FormatHash(0), FileName: "photo.jpg"})
+	got := []string{}
+	for _, match := range matches {
+		got = append(got, match.File)
+	}
+	if want := []string{"copy/photo.jpg", "copy/a.jpg", "copy/b.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("perceptual matches %v, want %v within the cutoff", got, want)
+	}
+	if len(matches) > 0 && (!matches[0].NameMatch || matches[0].Distance != 8) {
+		t.Errorf("first match %+v", matches[0])
+	}
+}
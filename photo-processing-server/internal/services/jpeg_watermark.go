@@ -0,0 +1,175 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// JPEG watermark segment: APP15 carrying "ENDECODE\0" + mark.
+// It is written right after the leading APPn segments (JFIF/EXIF stay first),
+// so the file remains spec-compliant and the mark precedes the scan data.
+const (
+	JPEG_WATERMARK_MARKER = 0xEF // APP15
+	jpegMarkerSOS         = 0xDA
+	jpegMarkerEOI         = 0xD9
+	jpegMaxSegmentLength  = 0xFFFF
+)
+
+var (
+	jpegSOI              = []byte{0xFF, 0xD8, 0xFF}
+	JPEG_WATERMARK_IDENT = []byte("ENDECODE\x00")
+)
+
+// jpegSegment is a marker segment located before the scan data
+type jpegSegment struct {
+	marker byte
+	start  int // offset of the 0xFF marker prefix
+	end    int // offset just past the segment
+	body   []byte
+}
+
+type jpegContainer struct{}
+
+func (jpegContainer) name() string { return "JPEG APP15" }
+
+// parseJPEGSegments walks marker segments from SOI up to SOS/EOI
+func parseJPEGSegments(data []byte) ([]jpegSegment, error) {
+	if !bytes.HasPrefix(data, jpegSOI[:2]) {
+		return nil, fmt.Errorf("not a JPEG file")
+	}
+
+	var segments []jpegSegment
+	pos := 2
+	for pos+1 < len(data) {
+		if data[pos] != 0xFF {
+			return nil, fmt.Errorf("invalid JPEG marker at offset %d", pos)
+		}
+		start := pos
+		// Skip fill bytes
+		for pos < len(data) && data[pos] == 0xFF {
+			pos++
+		}
+		if pos >= len(data) {
+			break
+		}
+		marker := data[pos]
+		pos++
+
+		// Standalone markers carry no length
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue
+		}
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			segments = append(segments, jpegSegment{marker: marker, start: start, end: start})
+			break
+		}
+		if pos+2 > len(data) {
+			return nil, fmt.Errorf("truncated JPEG segment at offset %d", start)
+		}
+		length := int(binary.BigEndian.Uint16(data[pos : pos+2]))
+		if length < 2 || pos+length > len(data) {
+			return nil, fmt.Errorf("invalid JPEG segment length at offset %d", start)
+		}
+		segments = append(segments, jpegSegment{
+			marker: marker,
+			start:  start,
+			end:    pos + length,
+			body:   data[pos+2 : pos+length],
+		})
+		pos += length
+	}
+	return segments, nil
+}
+
+// isWatermarkSegment checks whether segment is our APP15 watermark
+func (s jpegSegment) isWatermarkSegment() bool {
+	return s.marker == JPEG_WATERMARK_MARKER && bytes.HasPrefix(s.body, JPEG_WATERMARK_IDENT)
+}
+
+func (jpegContainer) embed(filePath string, mark []byte) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	segments, err := parseJPEGSegments(data)
+	if err != nil {
+		return err
+	}
+
+	length := 2 + len(JPEG_WATERMARK_IDENT) + len(mark)
+	if length > jpegMaxSegmentLength {
+		return fmt.Errorf("watermark too large for a JPEG segment (%d bytes)", len(mark))
+	}
+
+	// Insert after the leading run of APPn segments
+	insertAt := 2
+	for _, seg := range segments {
+		if seg.marker < 0xE0 || seg.marker > 0xEF {
+			break
+		}
+		insertAt = seg.end
+	}
+
+	segment := make([]byte, 0, 2+length)
+	segment = append(segment, 0xFF, JPEG_WATERMARK_MARKER, byte(length>>8), byte(length))
+	segment = append(segment, JPEG_WATERMARK_IDENT...)
+	segment = append(segment, mark...)
+
+	out := make([]byte, 0, len(data)+len(segment))
+	out = append(out, data[:insertAt]...)
+	out = append(out, segment...)
+	out = append(out, data[insertAt:]...)
+	return WriteFileAtomic(filePath, out)
+}
+
+func (jpegContainer) extract(filePath string) ([][]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	segments, err := parseJPEGSegments(data)
+	if err != nil {
+		return nil, nil
+	}
+
+	var marks [][]byte
+	for _, seg := range segments {
+		if seg.isWatermarkSegment() {
+			marks = append(marks, seg.body[len(JPEG_WATERMARK_IDENT):])
+		}
+	}
+	return marks, nil
+}
+
+func (jpegContainer) remove(filePath string, drop func(index int) bool) (int, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+	segments, err := parseJPEGSegments(data)
+	if err != nil {
+		return 0, nil
+	}
+
+	out := make([]byte, 0, len(data))
+	last := 0
+	index, removed := 0, 0
+	for _, seg := range segments {
+		if !seg.isWatermarkSegment() {
+			continue
+		}
+		if drop == nil || drop(index) {
+			out = append(out, data[last:seg.start]...)
+			last = seg.end
+			removed++
+		}
+		index++
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	out = append(out, data[last:]...)
+	return removed, WriteFileAtomic(filePath, out)
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"bytes"
+	"image/jpeg"
+	"testing"
+)
+
+func encodeTestJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestJPEGWatermarkRoundTrip(t *testing.T) {
+	path := writeTestFile(t, "photo.jpg", encodeTestJPEG(t))
+	checkContainerRoundTrip(t, jpegContainer{}, path, func(data []byte) error {
+		_, err := jpeg.Decode(bytes.NewReader(data))
+		return err
+	})
+}
+
+func TestJPEGWatermarkAfterAPPSegments(t *testing.T) {
+	data := encodeTestJPEG(t)
+	// SOI, then a JFIF-style APP0 and an EXIF-style APP1 before the rest
+	app0 := []byte{0xFF, 0xE0, 0x00, 0x07, 'J', 'F', 'I', 'F', 0x00}
+	app1 := []byte{0xFF, 0xE1, 0x00, 0x06, 'E', 'x', 'i', 'f'}
+	withApp := append(append(append([]byte{0xFF, 0xD8}, app0...), app1...), data[2:]...)
+	path := writeTestFile(t, "photo.jpg", withApp)
+
+	if err := (jpegContainer{}).embed(path, buildWatermark("payload")); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := parseJPEGSegments(readTestFile(t, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) < 3 || segments[0].marker != 0xE0 || segments[1].marker != 0xE1 || !segments[2].isWatermarkSegment() {
+		t.Errorf("watermark segment is not right after APP0 and APP1")
+	}
+}
+
+func TestJPEGWatermarkTooLarge(t *testing.T) {
+	path := writeTestFile(t, "photo.jpg", encodeTestJPEG(t))
+	if err := (jpegContainer{}).embed(path, make([]byte, jpegMaxSegmentLength)); err == nil {
+		t.Error("mark larger than a segment was embedded")
+	}
+}
+
+func TestParseJPEGSegmentsMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not a JPEG", []byte("GIF89a")},
+		{"missing marker", []byte{0xFF, 0xD8, 0x00, 0x01}},
+		{"truncated length", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00}},
+		{"length below two", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x01}},
+		{"length past end", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0xFF, 0xFF, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseJPEGSegments(tt.data); err == nil {
+				t.Error("malformed JPEG parsed without error")
+			}
+			path := writeTestFile(t, "photo.jpg", tt.data)
+			if marks, err := (jpegContainer{}).extract(path); err != nil || marks != nil {
+				t.Errorf("extract = %q, %v; want no marks", marks, err)
+			}
+			if err := (jpegContainer{}).embed(path, buildWatermark("x")); err == nil {
+				t.Error("embedded into a malformed JPEG")
+			}
+		})
+	}
+}
+
+func TestJPEGWatermarkTruncated(t *testing.T) {
+	path := writeTestFile(t, "photo.jpg", encodeTestJPEG(t))
+	if err := (jpegContainer{}).embed(path, buildWatermark("payload")); err != nil {
+		t.Fatal(err)
+	}
+	checkTruncations(t, jpegContainer{}, "photo.jpg", readTestFile(t, path))
+}
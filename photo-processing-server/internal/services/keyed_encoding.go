@@ -0,0 +1,169 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Keyed payload format: v2:<keyID>.<base64url(nonce | ciphertext | tag)>
+// The order text is sealed with AES-256-GCM under a key derived from a
+// server-side secret, so payloads can neither be read nor forged without it.
+// Payloads without "<keyID>." were sealed with the default key.
+const (
+	WATERMARK_V2_TAG = "v2:"
+	KEY_ID_SEPARATOR = "."
+	v2NonceSize      = 12
+	v2TagSize        = 16
+)
+
+// WatermarkStatus describes how trustworthy a decoded payload is
+type WatermarkStatus string
+
+const (
+	WatermarkValid      WatermarkStatus = "valid"       // keyed payload, MAC verified
+	WatermarkTampered   WatermarkStatus = "tampered"    // keyed payload, MAC mismatch
+	WatermarkForged     WatermarkStatus = "forged"      // claims to be keyed but is malformed
+	WatermarkLegacy     WatermarkStatus = "legacy"      // Caesar payload, cannot be authenticated
+	WatermarkNoKey      WatermarkStatus = "no_key"      // keyed payload but no secret configured
+	WatermarkUnknownKey WatermarkStatus = "unknown_key" // keyed payload sealed with a key we don't hold
+)
+
+// SetWatermarkSecret configures the default key (WATERMARK_SECRET)
+func SetWatermarkSecret(secret string) {
+	GetWatermarkKeyring().SetDefaultSecret(secret)
+}
+
+// HasWatermarkSecret reports whether keyed payloads can be produced
+func HasWatermarkSecret() bool {
+	return GetWatermarkKeyring().Active() != nil
+}
+
+// deriveKey derives a purpose-bound 32-byte key from the secret
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("endecode-watermark-" + purpose))
+	return mac.Sum(nil)
+}
+
+// newPayloadCipher creates the AES-GCM AEAD for the given secret
+func newPayloadCipher(secret []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveKey(secret, "enc"))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// syntheticNonce derives the nonce from the plaintext so that the same text
+// always yields the same payload (ProcessFile relies on this for dedup)
+func syntheticNonce(secret []byte, text string) []byte {
+	mac := hmac.New(sha256.New, deriveKey(secret, "nonce"))
+	mac.Write([]byte(text))
+	return mac.Sum(nil)[:v2NonceSize]
+}
+
+// sealPayload encrypts and authenticates text with the given key
+func sealPayload(key *WatermarkKey, text string) (string, error) {
+	secret := []byte(key.Secret)
+	aead, err := newPayloadCipher(secret)
+	if err != nil {
+		return "", err
+	}
+	header := WATERMARK_V2_TAG + key.ID + KEY_ID_SEPARATOR
+	nonce := syntheticNonce(secret, text)
+	sealed := aead.Seal(nil, nonce, []byte(text), []byte(header))
+	raw := append(append([]byte{}, nonce...), sealed...)
+	return header + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// openPayload verifies and decrypts a v2 payload body with the given key
+func openPayload(key *WatermarkKey, header string, body string) (string, WatermarkStatus) {
+	raw, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil || len(raw) < v2NonceSize+v2TagSize {
+		return "", WatermarkForged
+	}
+
+	aead, err := newPayloadCipher([]byte(key.Secret))
+	if err != nil {
+		return "", WatermarkForged
+	}
+	plain, err := aead.Open(nil, raw[:v2NonceSize], raw[v2NonceSize:], []byte(header))
+	if err != nil {
+		return "", WatermarkTampered
+	}
+	return string(plain), WatermarkValid
+}
+
+// splitKeyedPayload returns the authenticated header, key ID and body of a v2 payload
+func splitKeyedPayload(payload string) (header string, keyID string, body string) {
+	rest := strings.TrimPrefix(payload, WATERMARK_V2_TAG)
+	if i := strings.Index(rest, KEY_ID_SEPARATOR); i >= 0 {
+		return payload[:len(WATERMARK_V2_TAG)+i+1], rest[:i], rest[i+1:]
+	}
+	return WATERMARK_V2_TAG, DEFAULT_KEY_ID, rest
+}
+
+// PayloadKeyID returns the key ID a keyed payload was sealed with ("" for legacy)
+func PayloadKeyID(payload string) string {
+	if !IsKeyedPayload(payload) {
+		return ""
+	}
+	_, keyID, _ := splitKeyedPayload(payload)
+	return keyID
+}
+
+// EncodeKeyedText seals text into a v2 payload using the active key
+func EncodeKeyedText(text string) (string, error) {
+	key := GetWatermarkKeyring().Active()
+	if key == nil {
+		return "", fmt.Errorf("watermark secret is not configured")
+	}
+	return sealPayload(key, text)
+}
+
+// DecodeKeyedText opens a v2 payload with the key named in it and reports
+// whether its MAC is valid
+func DecodeKeyedText(payload string) (string, WatermarkStatus) {
+	keyring := GetWatermarkKeyring()
+	header, keyID, body := splitKeyedPayload(payload)
+
+	key, ok := keyring.Get(keyID)
+	if !ok {
+		if keyring.Active() == nil {
+			return "", WatermarkNoKey
+		}
+		return "", WatermarkUnknownKey
+	}
+	return openPayload(key, header, body)
+}
+
+// IsKeyedPayload checks whether payload uses the keyed v2 format
+func IsKeyedPayload(payload string) bool {
+	return strings.HasPrefix(payload, WATERMARK_V2_TAG)
+}
+
+// EncodePayload produces the payload embedded between watermark markers.
+// Falls back to the legacy Caesar cipher when no secret is configured.
+func EncodePayload(text string) string {
+	if HasWatermarkSecret() {
+		payload, err := EncodeKeyedText(text)
+		if err == nil {
+			return payload
+		}
+		GetGlobalLogger().Error(fmt.Sprintf("Keyed encoding failed, using legacy format: %v", err))
+	}
+	return EncodeText(text)
+}
+
+// DecodePayload decodes any supported payload format and reports its status
+func DecodePayload(payload string) (string, WatermarkStatus) {
+	if IsKeyedPayload(payload) {
+		return DecodeKeyedText(payload)
+	}
+	return DecodeText(payload), WatermarkLegacy
+}
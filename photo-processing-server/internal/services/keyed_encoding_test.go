@@ -0,0 +1,88 @@
+package services
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// useWatermarkSecret configures the default key for the duration of the test
+func useWatermarkSecret(t *testing.T, secret string) {
+	t.Helper()
+	SetWatermarkSecret(secret)
+	t.Cleanup(func() { SetWatermarkSecret("") })
+}
+
+func TestKeyedPayloadRoundTrip(t *testing.T) {
+	useWatermarkSecret(t, "test-secret")
+	for _, text := range []string{"Test 123", "Müller 001 — 東京", "", strings.Repeat("long ", 500)} {
+		payload := EncodePayload(text)
+		if !IsKeyedPayload(payload) || PayloadKeyID(payload) != DEFAULT_KEY_ID {
+			t.Fatalf("payload %q is not keyed with the default key", payload)
+		}
+		if strings.Contains(payload, WATERMARK_OWNER_SEPARATOR) || strings.Contains(payload, string(WATERMARK_END)) {
+			t.Errorf("payload %q contains a separator or marker", payload)
+		}
+		if got, status := DecodePayload(payload); got != text || status != WatermarkValid {
+			t.Errorf("decoded %q (%s), want %q (valid)", got, status, text)
+		}
+		if again := EncodePayload(text); again != payload {
+			t.Errorf("same text sealed to %q and %q", payload, again)
+		}
+	}
+}
+
+func TestDecodeKeyedPayloadMalformed(t *testing.T) {
+	useWatermarkSecret(t, "test-secret")
+	payload := EncodePayload("Test 123")
+	header, _, body := splitKeyedPayload(payload)
+	raw, _ := base64.RawURLEncoding.DecodeString(body)
+	flipped := append([]byte(nil), raw...)
+	flipped[len(flipped)-1] ^= 1
+
+	tests := []struct {
+		name    string
+		payload string
+		want    WatermarkStatus
+	}{
+		{"tag flipped", header + base64.RawURLEncoding.EncodeToString(flipped), WatermarkTampered},
+		{"body truncated", payload[:len(payload)-4], WatermarkTampered},
+		{"sealed by another secret", sealedWith(t, "other-secret", "Test 123"), WatermarkTampered},
+		{"key ID dropped", WATERMARK_V2_TAG + body, WatermarkTampered},
+		{"unknown key ID", WATERMARK_V2_TAG + "retired." + body, WatermarkUnknownKey},
+		{"bad base64", header + "!!!!", WatermarkForged},
+		{"shorter than nonce and tag", header + base64.RawURLEncoding.EncodeToString(raw[:v2NonceSize+v2TagSize-1]), WatermarkForged},
+		{"empty body", header, WatermarkForged},
+		{"tag only", WATERMARK_V2_TAG, WatermarkForged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if text, status := DecodePayload(tt.payload); status != tt.want || text != "" {
+				t.Errorf("decoded %q (%s), want %s", text, status, tt.want)
+			}
+		})
+	}
+}
+
+// sealedWith seals text under a default key with another secret
+func sealedWith(t *testing.T, secret string, text string) string {
+	t.Helper()
+	payload, err := sealPayload(&WatermarkKey{ID: DEFAULT_KEY_ID, Secret: secret}, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+func TestDecodeKeyedPayloadWithoutSecret(t *testing.T) {
+	payload := sealedWith(t, "test-secret", "Test 123")
+	if _, status := DecodePayload(payload); status != WatermarkNoKey {
+		t.Errorf("status %s without a configured secret, want %s", status, WatermarkNoKey)
+	}
+	if got := EncodePayload("Test 123"); got != "Alza 890" {
+		t.Errorf("payload %q without a secret, want the Caesar text", got)
+	}
+	if got, status := DecodePayload("Alza 890"); got != "Test 123" || status != WatermarkLegacy {
+		t.Errorf("decoded %q (%s), want legacy Test 123", got, status)
+	}
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DEFAULT_KEY_ID identifies the key configured through WATERMARK_SECRET.
+// Keyed payloads without an embedded key ID were sealed with it.
+const DEFAULT_KEY_ID = "default"
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// WatermarkKey is a secret used to seal keyed payloads
+type WatermarkKey struct {
+	ID        string     `json:"id"`
+	Secret    string     `json:"secret"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+// WatermarkKeyInfo is the public view of a key (never includes the secret)
+type WatermarkKeyInfo struct {
+	ID        string     `json:"id"`
+	Source    string     `json:"source"` // "config" or "file"
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+// WatermarkKeyring holds all known watermark keys. New payloads are sealed
+// with the newest non-retired key; retired keys are kept for decoding only.
+type WatermarkKeyring struct {
+	mutex      sync.RWMutex
+	path       string
+	keys       []*WatermarkKey
+	defaultKey *WatermarkKey
+}
+
+var (
+	globalKeyring *WatermarkKeyring
+	keyringOnce   sync.Once
+)
+
+// GetWatermarkKeyring returns the global keyring instance
+func GetWatermarkKeyring() *WatermarkKeyring {
+	keyringOnce.Do(func() {
+		globalKeyring = &WatermarkKeyring{}
+	})
+	return globalKeyring
+}
+
+// Load reads file-backed keys from path. A missing file is not an error;
+// it will be created on the first Add.
+func (k *WatermarkKeyring) Load(path string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.path = path
+	k.keys = nil
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var keys []*WatermarkKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("invalid watermark key file %s: %v", path, err)
+	}
+	k.keys = keys
+	return nil
+}
+
+// SetDefaultSecret configures the key sourced from WATERMARK_SECRET
+func (k *WatermarkKeyring) SetDefaultSecret(secret string) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if secret == "" {
+		k.defaultKey = nil
+		return
+	}
+	k.defaultKey = &WatermarkKey{ID: DEFAULT_KEY_ID, Secret: secret}
+}
+
+// Get returns the key with the given ID, retired or not
+func (k *WatermarkKeyring) Get(id string) (*WatermarkKey, bool) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	if id == DEFAULT_KEY_ID {
+		return k.defaultKey, k.defaultKey != nil
+	}
+	for _, key := range k.keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// Active returns the key used for new payloads, or nil if none is configured
+func (k *WatermarkKeyring) Active() *WatermarkKey {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.activeLocked()
+}
+
+func (k *WatermarkKeyring) activeLocked() *WatermarkKey {
+	for i := len(k.keys) - 1; i >= 0; i-- {
+		if k.keys[i].RetiredAt == nil {
+			return k.keys[i]
+		}
+	}
+	return k.defaultKey
+}
+
+// List returns all keys without their secrets
+func (k *WatermarkKeyring) List() []WatermarkKeyInfo {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	active := k.activeLocked()
+	items := make([]WatermarkKeyInfo, 0, len(k.keys)+1)
+	if k.defaultKey != nil {
+		items = append(items, WatermarkKeyInfo{
+			ID:     DEFAULT_KEY_ID,
+			Source: "config",
+			Active: active == k.defaultKey,
+		})
+	}
+	for _, key := range k.keys {
+		items = append(items, WatermarkKeyInfo{
+			ID:        key.ID,
+			Source:    "file",
+			Active:    active == key,
+			CreatedAt: key.CreatedAt,
+			RetiredAt: key.RetiredAt,
+		})
+	}
+	return items
+}
+
+// Add registers a new key and makes it active. Empty id or secret are generated.
+func (k *WatermarkKeyring) Add(id string, secret string) (*WatermarkKey, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if id == "" {
+		id = "k" + randomHex(4)
+	}
+	if !keyIDPattern.MatchString(id) || id == DEFAULT_KEY_ID {
+		return nil, fmt.Errorf("invalid key id %q", id)
+	}
+	for _, key := range k.keys {
+		if key.ID == id {
+			return nil, fmt.Errorf("key %s already exists", id)
+		}
+	}
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		secret = base64.RawStdEncoding.EncodeToString(buf)
+	}
+
+	key := &WatermarkKey{ID: id, Secret: secret, CreatedAt: time.Now()}
+	k.keys = append(k.keys, key)
+	if err := k.saveLocked(); err != nil {
+		k.keys = k.keys[:len(k.keys)-1]
+		return nil, err
+	}
+	return key, nil
+}
+
+// Retire stops a key from sealing new payloads; it still decodes old ones
+func (k *WatermarkKeyring) Retire(id string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if id == DEFAULT_KEY_ID {
+		return fmt.Errorf("key %s is configured via WATERMARK_SECRET and cannot be retired here", id)
+	}
+	for _, key := range k.keys {
+		if key.ID != id {
+			continue
+		}
+		if key.RetiredAt != nil {
+			return nil
+		}
+		now := time.Now()
+		key.RetiredAt = &now
+		if err := k.saveLocked(); err != nil {
+			key.RetiredAt = nil
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("key %s not found", id)
+}
+
+// saveLocked persists file-backed keys atomically
+func (k *WatermarkKeyring) saveLocked() error {
+	if k.path == "" {
+		return nil
+	}
+	if err := EnsureDirectoryExists(filepath.Dir(k.path)); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(k.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
+
+// randomHex returns n random bytes hex-encoded
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useKeyFile loads the global keyring from a key file in a temporary folder
+// and empties it again when the test ends
+func useKeyFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys", "watermark_keys.json")
+	if err := GetWatermarkKeyring().Load(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { GetWatermarkKeyring().Load("") })
+	return path
+}
+
+func TestKeyringRotation(t *testing.T) {
+	useWatermarkSecret(t, "test-secret")
+	path := useKeyFile(t)
+	keyring := GetWatermarkKeyring()
+
+	old := EncodePayload("Test 123")
+	if PayloadKeyID(old) != DEFAULT_KEY_ID {
+		t.Fatalf("payload sealed with key %q before rotation", PayloadKeyID(old))
+	}
+
+	if _, err := keyring.Add("k2", ""); err != nil {
+		t.Fatal(err)
+	}
+	rotated := EncodePayload("Test 456")
+	if PayloadKeyID(rotated) != "k2" {
+		t.Fatalf("payload sealed with key %q after Add, want k2", PayloadKeyID(rotated))
+	}
+	for _, payload := range []string{old, rotated} {
+		if _, status := DecodePayload(payload); status != WatermarkValid {
+			t.Errorf("payload of key %s decodes as %s after Add", PayloadKeyID(payload), status)
+		}
+	}
+
+	// A retired key still decodes its payloads but no longer seals new ones
+	if err := keyring.Retire("k2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, status := DecodePayload(rotated); got != "Test 456" || status != WatermarkValid {
+		t.Errorf("retired key decoded %q (%s), want valid", got, status)
+	}
+	if id := PayloadKeyID(EncodePayload("Test 789")); id != DEFAULT_KEY_ID {
+		t.Errorf("payload sealed with key %q after Retire, want %s", id, DEFAULT_KEY_ID)
+	}
+
+	// A key missing from the key file is unknown
+	if err := keyring.Load(filepath.Join(filepath.Dir(path), "other.json")); err != nil {
+		t.Fatal(err)
+	}
+	if got, status := DecodePayload(rotated); got != "" || status != WatermarkUnknownKey {
+		t.Errorf("dropped key decoded %q (%s), want %s", got, status, WatermarkUnknownKey)
+	}
+}
+
+func TestKeyringKeyFile(t *testing.T) {
+	path := useKeyFile(t)
+	keyring := GetWatermarkKeyring()
+
+	first, err := keyring.Add("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !keyIDPattern.MatchString(first.ID) || first.Secret == "" {
+		t.Errorf("generated key %q with secret %q", first.ID, first.Secret)
+	}
+	if _, err := keyring.Add("k2", "second-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Retire(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"k2", DEFAULT_KEY_ID, "bad id", "way-too-long-key-id-0123456789abcdef"} {
+		if _, err := keyring.Add(id, "x"); err == nil {
+			t.Errorf("key %q was added", id)
+		}
+	}
+	if err := keyring.Retire("missing"); err == nil {
+		t.Error("missing key was retired")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("key file mode %o, want 600", mode)
+	}
+
+	want := keyring.List()
+	if err := keyring.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	got := keyring.List()
+	if len(got) != len(want) {
+		t.Fatalf("reloaded %d keys, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].ID != want[i].ID || got[i].Active != want[i].Active || (got[i].RetiredAt == nil) != (want[i].RetiredAt == nil) {
+			t.Errorf("reloaded key %+v, want %+v", got[i], want[i])
+		}
+	}
+	if key, ok := keyring.Get("k2"); !ok || key.Secret != "second-secret" || keyring.Active() != key {
+		t.Errorf("reloaded k2 %+v is not the active key", key)
+	}
+
+	if err := os.WriteFile(path, []byte("[{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Load(path); err == nil {
+		t.Error("invalid key file was loaded")
+	}
+}
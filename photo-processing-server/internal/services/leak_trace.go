@@ -0,0 +1,203 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Extractor names reported in LeakEvidence
+const (
+	ExtractorContainer  = "container"
+	ExtractorTrailer    = "trailer"
+	ExtractorText       = "text"
+	ExtractorPixel      = "pixel"
+	ExtractorHash       = "hash"       // exact SHA-256 of the file
+	ExtractorPerceptual = "perceptual" // pHash/dHash of image content
+)
+
+var watermarkTextPattern = regexp.MustCompile(`^(.*?)\s*(\d+)$`)
+
+// LeakEvidence is a watermark found in a leaked file by one extractor
+type LeakEvidence struct {
+	Extractor   string            `json:"extractor"`
+	Payload     string            `json:"payload,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	ChainIndex  int               `json:"chainIndex,omitempty"` // position in the file's watermark chain
+	Text        string            `json:"text"`
+	Status      WatermarkStatus   `json:"status,omitempty"`
+	KeyID       string            `json:"keyId,omitempty"`
+	Fields      *WatermarkPayload `json:"fields,omitempty"` // structured payloads only
+	BaseText    string            `json:"baseText,omitempty"`
+	OrderNumber string            `json:"orderNumber,omitempty"`
+	Confidence  float64           `json:"confidence,omitempty"`
+	PHash       string            `json:"phash,omitempty"`
+	DHash       string            `json:"dhash,omitempty"`
+	FileName    string            `json:"-"` // leaked file name, for swap-aware matching
+}
+
+// IssuanceMatch links evidence to a recorded delivery
+type IssuanceMatch struct {
+	Source        string    `json:"source"`
+	JobID         string    `json:"jobId,omitempty"`
+	OrderID       string    `json:"orderId,omitempty"`
+	CustomerEmail string    `json:"customerEmail,omitempty"`
+	UserID        string    `json:"userId,omitempty"`
+	OrderNumber   string    `json:"orderNumber"`
+	CopyNumber    int       `json:"copyNumber"`
+	IssuedAt      time.Time `json:"issuedAt"`
+	DownloadToken string    `json:"downloadToken,omitempty"`
+	Extractor     string    `json:"extractor"`
+	File          string    `json:"file,omitempty"`
+	Distance      int       `json:"distance,omitempty"`
+	NameMatch     bool      `json:"nameMatch,omitempty"`
+}
+
+// IssuanceSource looks up recorded deliveries matching a piece of evidence
+type IssuanceSource interface {
+	FindIssuance(evidence LeakEvidence) []IssuanceMatch
+}
+
+// LeakTraceReport is the result of tracing a single leaked file
+type LeakTraceReport struct {
+	File     string          `json:"file"`
+	Evidence []LeakEvidence  `json:"evidence"`
+	Matches  []IssuanceMatch `json:"matches"`
+}
+
+// TraceLeak runs every watermark extractor on filePath and matches the
+// decoded payloads against the given issuance sources
+func TraceLeak(filePath string, sources ...IssuanceSource) (*LeakTraceReport, error) {
+	logger := GetGlobalLogger()
+
+	if _, err := os.Stat(filePath); err != nil {
+		return nil, err
+	}
+
+	report := &LeakTraceReport{
+		File:     filepath.Base(filePath),
+		Evidence: []LeakEvidence{},
+		Matches:  []IssuanceMatch{},
+	}
+
+	// Unmodified copies match a delivered file hash directly
+	if sum, err := fileSHA256(filePath); err == nil {
+		report.Evidence = append(report.Evidence, LeakEvidence{Extractor: ExtractorHash, Text: sum})
+	}
+
+	// Every mark of the chain (studio, reseller, customer...) is evidence
+	marks, err := ExtractWatermarks(filePath)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Watermark extraction failed for %s: %v", report.File, err))
+	}
+	for _, mark := range marks {
+		evidence := payloadEvidence(mark.Location, mark.Payload)
+		evidence.Owner = mark.Owner
+		evidence.ChainIndex = mark.Index
+		report.Evidence = append(report.Evidence, evidence)
+	}
+	// Old "*/" text marks are not part of the chain format
+	if len(marks) == 0 && IsTextFile(filePath) {
+		if content, err := os.ReadFile(filePath); err == nil {
+			if payload := ExtractWatermark(string(content)); payload != "" {
+				report.Evidence = append(report.Evidence, payloadEvidence(ExtractorText, payload))
+			}
+		}
+	}
+
+	// Pixel-domain mark
+	if IsImageFile(filePath) {
+		orderID, score, found, err := DetectRobustWatermark(filePath)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Robust watermark detection failed for %s: %v", report.File, err))
+		} else if found {
+			orderNumber := fmt.Sprintf("%03d", orderID)
+			report.Evidence = append(report.Evidence, LeakEvidence{
+				Extractor:   ExtractorPixel,
+				Text:        orderNumber,
+				OrderNumber: orderNumber,
+				Confidence:  score,
+			})
+		}
+
+		// Content fingerprint, used when every embedded mark is gone
+		if hash, err := ComputePerceptualHash(filePath); err == nil {
+			report.Evidence = append(report.Evidence, LeakEvidence{
+				Extractor: ExtractorPerceptual,
+				Text:      FormatHash(hash.PHash),
+				PHash:     FormatHash(hash.PHash),
+				DHash:     FormatHash(hash.DHash),
+				FileName:  report.File,
+			})
+		}
+	}
+
+	for _, evidence := range report.Evidence {
+		for _, source := range sources {
+			report.Matches = append(report.Matches, source.FindIssuance(evidence)...)
+		}
+	}
+
+	logger.Log(fmt.Sprintf("Traced %s: %d evidence item(s), %d issuance match(es)",
+		report.File, len(report.Evidence), len(report.Matches)))
+	return report, nil
+}
+
+// payloadEvidence decodes an embedded payload into evidence
+func payloadEvidence(extractor string, payload string) LeakEvidence {
+	fields, text, status := DecodeStructuredPayload(payload)
+	evidence := LeakEvidence{
+		Extractor: extractor,
+		Payload:   payload,
+		Text:      text,
+		Status:    status,
+		KeyID:     PayloadKeyID(payload),
+		Fields:    fields,
+	}
+	switch {
+	case fields != nil:
+		// Flat text form, so registry and batch matching work unchanged
+		evidence.Text = fields.Text()
+		evidence.BaseText, evidence.OrderNumber = fields.BaseText, fields.OrderID
+	case status == WatermarkValid || status == WatermarkLegacy:
+		evidence.BaseText, evidence.OrderNumber = splitWatermarkText(text)
+	}
+	return evidence
+}
+
+// splitWatermarkText splits "ORDER 003" into its base text and order number
+func splitWatermarkText(text string) (string, string) {
+	match := watermarkTextPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return text, ""
+	}
+	return match[1], match[2]
+}
+
+// MatchBatchCopy reports which copy of a batch (baseText, numCopies) the
+// evidence belongs to, mirroring the numbering of PerformBatchCopyAndEncode
+func MatchBatchCopy(baseText string, numCopies int, evidence LeakEvidence) (string, int, bool) {
+	if evidence.OrderNumber == "" {
+		return "", 0, false
+	}
+	number, err := strconv.Atoi(evidence.OrderNumber)
+	if err != nil {
+		return "", 0, false
+	}
+
+	// Pixel marks carry only the number; byte marks must also match the base text
+	batchBase, _ := splitWatermarkText(baseText)
+	if evidence.Extractor != ExtractorPixel && !strings.EqualFold(strings.TrimSpace(batchBase), strings.TrimSpace(evidence.BaseText)) {
+		return "", 0, false
+	}
+
+	startNumber := extractStartNumber(baseText)
+	if number < startNumber || number >= startNumber+numCopies {
+		return "", 0, false
+	}
+	return fmt.Sprintf("%03d", number), number - startNumber + 1, true
+}
@@ -0,0 +1,129 @@
+package services
+
+import "testing"
+
+func TestSplitWatermarkText(t *testing.T) {
+	tests := []struct {
+		text, base, number string
+	}{
+		{"base text 042", "base text", "042"},
+		{"  Project Alpha   7 ", "Project Alpha", "7"},
+		{"Order42", "Order", "42"},
+		{"042", "", "042"},
+		{"base text", "base text", ""},
+		{"042 base", "042 base", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if base, number := splitWatermarkText(tt.text); base != tt.base || number != tt.number {
+				t.Errorf("split %q, %q; want %q, %q", base, number, tt.base, tt.number)
+			}
+		})
+	}
+}
+
+func TestMatchBatchCopy(t *testing.T) {
+	useWatermarkSecret(t, "test-secret")
+	tests := []struct {
+		name       string
+		evidence   LeakEvidence
+		wantNumber string
+		wantCopy   int
+		wantOK     bool
+	}{
+		{"first copy", payloadEvidence(ExtractorTrailer, EncodePayload("Project Alpha 041")), "041", 1, true},
+		{"last copy", payloadEvidence(ExtractorTrailer, EncodePayload("project alpha 043")), "043", 3, true},
+		{"after the batch", payloadEvidence(ExtractorTrailer, EncodePayload("Project Alpha 044")), "", 0, false},
+		{"before the batch", payloadEvidence(ExtractorTrailer, EncodePayload("Project Alpha 040")), "", 0, false},
+		{"other base text", payloadEvidence(ExtractorTrailer, EncodePayload("Project Beta 042")), "", 0, false},
+		{"legacy mark", payloadEvidence(ExtractorTrailer, EncodeText("Project Alpha 042")), "042", 2, true},
+		{"tampered mark", payloadEvidence(ExtractorTrailer, sealedWith(t, "other-secret", "Project Alpha 042")), "", 0, false},
+		{"no number", payloadEvidence(ExtractorTrailer, EncodePayload("Project Alpha")), "", 0, false},
+		{"pixel number only", LeakEvidence{Extractor: ExtractorPixel, OrderNumber: "042"}, "042", 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			number, copyNumber, ok := MatchBatchCopy("Project Alpha 041", 3, tt.evidence)
+			if number != tt.wantNumber || copyNumber != tt.wantCopy || ok != tt.wantOK {
+				t.Errorf("matched %q copy %d (%v), want %q copy %d (%v)", number, copyNumber, ok, tt.wantNumber, tt.wantCopy, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTraceLeakRegistry(t *testing.T) {
+	useWatermarkSecret(t, "test-secret")
+	registry, _ := newTestRegistry(t)
+
+	valid := writeTestFile(t, "valid.avi", testTrailerMedia)
+	if err := addWatermarkToChain(valid, "studio", EncodePayload("Project Alpha 042")); err != nil {
+		t.Fatal(err)
+	}
+	delivered, err := fileSHA256(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, text := range []string{"Project Alpha 041", "Project Alpha 042"} {
+		record := &IssuedWatermark{ID: text, OrderNumber: text[len(text)-3:], CopyNumber: i + 1, Text: text}
+		if i == 1 {
+			record.Files = []IssuedFile{{Path: "valid.avi", SHA256: delivered}}
+		}
+		if err := registry.Record(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tampered := writeTestFile(t, "tampered.avi", testTrailerMedia)
+	if err := addWatermarkToChain(tampered, "studio", sealedWith(t, "other-secret", "Project Alpha 042")); err != nil {
+		t.Fatal(err)
+	}
+	unmarked := writeTestFile(t, "unmarked.avi", testTrailerMedia)
+
+	tests := []struct {
+		name         string
+		path         string
+		wantStatus   WatermarkStatus // of the chain mark, "" for none
+		wantMatches  []string        // extractor of each match
+		wantEvidence int
+	}{
+		{"valid mark", valid, WatermarkValid, []string{ExtractorHash, ExtractorTrailer}, 2},
+		{"tampered mark", tampered, WatermarkTampered, []string{}, 2},
+		{"no mark", unmarked, "", []string{}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := TraceLeak(tt.path, registry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Evidence) != tt.wantEvidence || report.Evidence[0].Extractor != ExtractorHash {
+				t.Fatalf("evidence %+v", report.Evidence)
+			}
+			if tt.wantStatus != "" {
+				if mark := report.Evidence[1]; mark.Status != tt.wantStatus || mark.Owner != "studio" {
+					t.Errorf("mark evidence %+v, want status %s", mark, tt.wantStatus)
+				}
+			}
+			extractors := []string{}
+			for _, match := range report.Matches {
+				extractors = append(extractors, match.Extractor)
+				if match.OrderNumber != "042" || match.CopyNumber != 2 || match.Source != "registry" {
+					t.Errorf("matched %+v, want copy 2 of order 042", match)
+				}
+			}
+			if len(extractors) != len(tt.wantMatches) {
+				t.Fatalf("matches by %v, want %v", extractors, tt.wantMatches)
+			}
+			for i := range extractors {
+				if extractors[i] != tt.wantMatches[i] {
+					t.Errorf("matches by %v, want %v", extractors, tt.wantMatches)
+				}
+			}
+		})
+	}
+
+	if _, err := TraceLeak(unmarked+".missing", registry); err == nil {
+		t.Error("traced a missing file")
+	}
+}
@@ -0,0 +1,401 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// MP4/MOV watermark box: moov/udta/uuid carrying MP4_WATERMARK_UUID + mark.
+// udta is user data that remuxers carry along with the movie header, and
+// the parent box sizes (and chunk offsets, when moov precedes mdat) are
+// rewritten so the file stays a valid ISO-BMFF stream.
+var MP4_WATERMARK_UUID = []byte{
+	0xE7, 0x0D, 0xEC, 0x0D, 0xE5, 0x1A, 0x4B, 0x57,
+	0x8A, 0x11, 0x7E, 0x3A, 0x9C, 0x5B, 0x2D, 0x01,
+}
+
+// Top-level box types that identify an ISO-BMFF/QuickTime file
+var mp4TopLevelTypes = map[string]bool{
+	"ftyp": true,
+	"moov": true,
+	"mdat": true,
+	"wide": true,
+	"free": true,
+	"skip": true,
+}
+
+// Boxes whose payload is a plain list of child boxes and may hold chunk offset tables
+var mp4ContainerTypes = map[string]bool{
+	"trak": true,
+	"mdia": true,
+	"minf": true,
+	"stbl": true,
+}
+
+// mp4Box describes a box located at start within its reader
+type mp4Box struct {
+	boxType    string
+	start      int64
+	headerSize int64
+	size       int64
+}
+
+func (b mp4Box) end() int64 { return b.start + b.size }
+
+type mp4Container struct{}
+
+func (mp4Container) name() string { return "MP4 udta box" }
+
+// isMP4Header checks whether the first bytes look like an ISO-BMFF box header
+func isMP4Header(header []byte) bool {
+	return len(header) >= 8 && mp4TopLevelTypes[string(header[4:8])]
+}
+
+// readMP4Box reads the box header at offset; limit bounds boxes that extend to EOF
+func readMP4Box(r io.ReaderAt, offset int64, limit int64) (mp4Box, error) {
+	header := make([]byte, 16)
+	if _, err := r.ReadAt(header[:8], offset); err != nil {
+		return mp4Box{}, err
+	}
+	box := mp4Box{
+		boxType:    string(header[4:8]),
+		start:      offset,
+		headerSize: 8,
+		size:       int64(binary.BigEndian.Uint32(header[0:4])),
+	}
+	switch box.size {
+	case 0:
+		box.size = limit - offset
+	case 1:
+		if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+			return mp4Box{}, err
+		}
+		box.headerSize = 16
+		box.size = int64(binary.BigEndian.Uint64(header[8:16]))
+	}
+	// Compare against the room left, so a huge 64-bit size cannot wrap the sum
+	if box.size < box.headerSize || box.size > limit-offset {
+		return mp4Box{}, fmt.Errorf("invalid %q box size at offset %d", box.boxType, offset)
+	}
+	return box, nil
+}
+
+// listMP4Boxes lists sibling boxes in [start, end)
+func listMP4Boxes(r io.ReaderAt, start int64, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for offset := start; offset+8 <= end; {
+		box, err := readMP4Box(r, offset, end)
+		if err != nil {
+			return nil, err
+		}
+		boxes = append(boxes, box)
+		offset = box.end()
+	}
+	return boxes, nil
+}
+
+// findMP4Box returns the first box of the given type
+func findMP4Box(boxes []mp4Box, boxType string) (mp4Box, bool) {
+	for _, box := range boxes {
+		if box.boxType == boxType {
+			return box, true
+		}
+	}
+	return mp4Box{}, false
+}
+
+// setMP4BoxSize rewrites the size field of a serialized box
+func setMP4BoxSize(box []byte, headerSize int64) error {
+	size := uint64(len(box))
+	if headerSize == 16 {
+		binary.BigEndian.PutUint64(box[8:16], size)
+		return nil
+	}
+	if size > 0xFFFFFFFF {
+		return fmt.Errorf("box too large for 32-bit size field")
+	}
+	binary.BigEndian.PutUint32(box[0:4], uint32(size))
+	return nil
+}
+
+// buildMP4Box serializes a box with a 32-bit size
+func buildMP4Box(boxType string, payload ...[]byte) []byte {
+	box := make([]byte, 8)
+	copy(box[4:8], boxType)
+	for _, p := range payload {
+		box = append(box, p...)
+	}
+	binary.BigEndian.PutUint32(box[0:4], uint32(len(box)))
+	return box
+}
+
+// isWatermarkBox checks whether box (within data) is our uuid watermark box
+func isWatermarkBox(data []byte, box mp4Box) bool {
+	if box.boxType != "uuid" || box.size < box.headerSize+16 {
+		return false
+	}
+	payload := data[box.start+box.headerSize : box.end()]
+	return bytes.HasPrefix(payload, MP4_WATERMARK_UUID)
+}
+
+// readMoov locates and loads the moov box of an MP4 file
+func readMoov(file *os.File) (mp4Box, []byte, []mp4Box, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return mp4Box{}, nil, nil, err
+	}
+	top, err := listMP4Boxes(file, 0, info.Size())
+	if err != nil {
+		return mp4Box{}, nil, nil, err
+	}
+	moov, ok := findMP4Box(top, "moov")
+	if !ok {
+		return mp4Box{}, nil, nil, fmt.Errorf("MP4 has no moov box")
+	}
+	data := make([]byte, moov.size)
+	if _, err := file.ReadAt(data, moov.start); err != nil {
+		return mp4Box{}, nil, nil, err
+	}
+	return moov, data, top, nil
+}
+
+// rebuildMoov applies edit to the children of moov/udta and returns the new
+// moov bytes. edit receives the current udta payload (nil if absent) and
+// returns the new one; a nil result drops udta entirely. A QuickTime
+// 32-bit zero terminator is kept at the end of udta.
+func rebuildMoov(moovData []byte, moov mp4Box, edit func(udta []byte, children []mp4Box) []byte) ([]byte, error) {
+	r := bytes.NewReader(moovData)
+	children, err := listMP4Boxes(r, moov.headerSize, int64(len(moovData)))
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, moovData[:moov.headerSize]...)
+	var udtaPayload, terminator []byte
+	var udtaChildren []mp4Box
+	udta, hasUdta := findMP4Box(children, "udta")
+	if hasUdta {
+		udtaPayload = moovData[udta.start+udta.headerSize : udta.end()]
+		udtaChildren, err = listMP4Boxes(bytes.NewReader(udtaPayload), 0, int64(len(udtaPayload)))
+		if err != nil {
+			return nil, err
+		}
+		// Bytes too short to be a box (the terminator) trail the children
+		if n := len(udtaChildren); n > 0 {
+			udtaPayload, terminator = udtaPayload[:udtaChildren[n-1].end()], udtaPayload[udtaChildren[n-1].end():]
+		} else {
+			udtaPayload, terminator = udtaPayload[:0], udtaPayload
+		}
+		if len(terminator) == 0 {
+			terminator = nil
+		}
+	}
+	newUdta := edit(udtaPayload, udtaChildren)
+	if newUdta != nil && terminator != nil {
+		newUdta = append(append([]byte{}, newUdta...), terminator...)
+	}
+
+	for _, child := range children {
+		if hasUdta && child.start == udta.start {
+			if newUdta != nil {
+				out = append(out, buildMP4Box("udta", newUdta)...)
+			}
+			continue
+		}
+		out = append(out, moovData[child.start:child.end()]...)
+	}
+	if !hasUdta && newUdta != nil {
+		out = append(out, buildMP4Box("udta", newUdta)...)
+	}
+
+	if err := setMP4BoxSize(out, moov.headerSize); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// adjustChunkOffsets shifts stco/co64 entries pointing at or past threshold by delta
+func adjustChunkOffsets(data []byte, start int64, end int64, threshold int64, delta int64) error {
+	boxes, err := listMP4Boxes(bytes.NewReader(data), start, end)
+	if err != nil {
+		return err
+	}
+	for _, box := range boxes {
+		payload := data[box.start+box.headerSize : box.end()]
+		switch {
+		case mp4ContainerTypes[box.boxType]:
+			if err := adjustChunkOffsets(data, box.start+box.headerSize, box.end(), threshold, delta); err != nil {
+				return err
+			}
+		case box.boxType == "stco" && len(payload) >= 8:
+			count := int(binary.BigEndian.Uint32(payload[4:8]))
+			for i := 0; i < count && 8+i*4+4 <= len(payload); i++ {
+				entry := payload[8+i*4 : 8+i*4+4]
+				offset := int64(binary.BigEndian.Uint32(entry))
+				if offset < threshold {
+					continue
+				}
+				if offset+delta > 0xFFFFFFFF || offset+delta < 0 {
+					return fmt.Errorf("chunk offset overflow in stco")
+				}
+				binary.BigEndian.PutUint32(entry, uint32(offset+delta))
+			}
+		case box.boxType == "co64" && len(payload) >= 8:
+			count := int(binary.BigEndian.Uint32(payload[4:8]))
+			for i := 0; i < count && 8+i*8+8 <= len(payload); i++ {
+				entry := payload[8+i*8 : 8+i*8+8]
+				offset := int64(binary.BigEndian.Uint64(entry))
+				if offset >= threshold {
+					binary.BigEndian.PutUint64(entry, uint64(offset+delta))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeMoov replaces the moov box on disk, fixing chunk offsets if media data follows it
+func writeMoov(filePath string, file *os.File, moov mp4Box, top []mp4Box, newMoov []byte) error {
+	delta := int64(len(newMoov)) - moov.size
+	if delta != 0 {
+		for _, box := range top {
+			if box.boxType == "mdat" && box.start > moov.start {
+				if err := adjustChunkOffsets(newMoov, moov.headerSize, int64(len(newMoov)), moov.end(), delta); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".tmp_"+filepath.Base(filePath))
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := io.Copy(tmp, io.NewSectionReader(file, 0, moov.start)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(newMoov); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := io.Copy(tmp, io.NewSectionReader(file, moov.end(), info.Size()-moov.end())); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, info.Mode()); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
+
+func (mp4Container) embed(filePath string, mark []byte) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	moov, moovData, top, err := readMoov(file)
+	if err != nil {
+		return err
+	}
+
+	wmBox := buildMP4Box("uuid", MP4_WATERMARK_UUID, mark)
+	newMoov, err := rebuildMoov(moovData, moov, func(udta []byte, children []mp4Box) []byte {
+		kept := make([]byte, 0, len(udta)+len(wmBox))
+		for _, child := range children {
+			kept = append(kept, udta[child.start:child.end()]...)
+		}
+		return append(kept, wmBox...)
+	})
+	if err != nil {
+		return err
+	}
+	return writeMoov(filePath, file, moov, top, newMoov)
+}
+
+func (mp4Container) extract(filePath string) ([][]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	moov, moovData, _, err := readMoov(file)
+	if err != nil {
+		return nil, nil
+	}
+
+	var marks [][]byte
+	_, err = rebuildMoov(moovData, moov, func(udta []byte, children []mp4Box) []byte {
+		for _, child := range children {
+			if isWatermarkBox(udta, child) {
+				marks = append(marks, udta[child.start+child.headerSize+16:child.end()])
+			}
+		}
+		return udta
+	})
+	if err != nil {
+		return nil, nil
+	}
+	return marks, nil
+}
+
+func (mp4Container) remove(filePath string, drop func(index int) bool) (int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	moov, moovData, top, err := readMoov(file)
+	if err != nil {
+		return 0, nil
+	}
+
+	index, removed := 0, 0
+	newMoov, err := rebuildMoov(moovData, moov, func(udta []byte, children []mp4Box) []byte {
+		if udta == nil {
+			return nil
+		}
+		kept := make([]byte, 0, len(udta))
+		for _, child := range children {
+			if isWatermarkBox(udta, child) {
+				dropped := drop == nil || drop(index)
+				index++
+				if dropped {
+					removed++
+					continue
+				}
+			}
+			kept = append(kept, udta[child.start:child.end()]...)
+		}
+		if len(kept) == 0 {
+			return nil
+		}
+		return kept
+	})
+	if err != nil {
+		return 0, err
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, writeMoov(filePath, file, moov, top, newMoov)
+}
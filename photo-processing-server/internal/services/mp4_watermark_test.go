@@ -0,0 +1,210 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// Media chunks stored in mdat; the offset tables must keep pointing at them
+var testMP4Chunks = [][]byte{[]byte("CHUNK-ONE"), []byte("CHUNK-TWO")}
+
+// buildTestMP4 assembles ftyp, moov (with one track whose stco or co64 table
+// points into mdat) and mdat, with moov before or after the media data.
+// udta, if not nil, is added to moov as is.
+func buildTestMP4(t *testing.T, co64 bool, moovFirst bool, udta []byte) []byte {
+	t.Helper()
+	ftyp := buildMP4Box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2"))
+	mdatPayload := bytes.Join(testMP4Chunks, nil)
+	mdat := buildMP4Box("mdat", mdatPayload)
+
+	buildMoov := func(mdatStart int) []byte {
+		table := make([]byte, 8)
+		binary.BigEndian.PutUint32(table[4:8], uint32(len(testMP4Chunks)))
+		offset := mdatStart + 8
+		for _, chunk := range testMP4Chunks {
+			if co64 {
+				table = binary.BigEndian.AppendUint64(table, uint64(offset))
+			} else {
+				table = binary.BigEndian.AppendUint32(table, uint32(offset))
+			}
+			offset += len(chunk)
+		}
+		tableType := "stco"
+		if co64 {
+			tableType = "co64"
+		}
+		stbl := buildMP4Box("stbl", buildMP4Box(tableType, table))
+		trak := buildMP4Box("trak", buildMP4Box("mdia", buildMP4Box("minf", stbl)))
+		children := [][]byte{buildMP4Box("mvhd", make([]byte, 100)), trak}
+		if udta != nil {
+			children = append(children, buildMP4Box("udta", udta))
+		}
+		return buildMP4Box("moov", children...)
+	}
+
+	if moovFirst {
+		moovSize := len(buildMoov(0))
+		return bytes.Join([][]byte{ftyp, buildMoov(len(ftyp) + moovSize), mdat}, nil)
+	}
+	return bytes.Join([][]byte{ftyp, mdat, buildMoov(len(ftyp))}, nil)
+}
+
+// checkChunkOffsets reads every chunk through the offset table
+func checkChunkOffsets(data []byte) error {
+	file := bytes.NewReader(data)
+	top, err := listMP4Boxes(file, 0, int64(len(data)))
+	if err != nil {
+		return err
+	}
+	moov, ok := findMP4Box(top, "moov")
+	if !ok {
+		return fmt.Errorf("no moov")
+	}
+	var offsets []int64
+	var walk func(start, end int64) error
+	walk = func(start, end int64) error {
+		boxes, err := listMP4Boxes(file, start, end)
+		if err != nil {
+			return err
+		}
+		for _, box := range boxes {
+			payload := data[box.start+box.headerSize : box.end()]
+			switch {
+			case mp4ContainerTypes[box.boxType]:
+				if err := walk(box.start+box.headerSize, box.end()); err != nil {
+					return err
+				}
+			case box.boxType == "stco":
+				for i := 0; i < int(binary.BigEndian.Uint32(payload[4:8])); i++ {
+					offsets = append(offsets, int64(binary.BigEndian.Uint32(payload[8+i*4:])))
+				}
+			case box.boxType == "co64":
+				for i := 0; i < int(binary.BigEndian.Uint32(payload[4:8])); i++ {
+					offsets = append(offsets, int64(binary.BigEndian.Uint64(payload[8+i*8:])))
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(moov.start+moov.headerSize, moov.end()); err != nil {
+		return err
+	}
+	if len(offsets) != len(testMP4Chunks) {
+		return fmt.Errorf("%d chunk offsets, want %d", len(offsets), len(testMP4Chunks))
+	}
+	for i, offset := range offsets {
+		chunk := testMP4Chunks[i]
+		if offset+int64(len(chunk)) > int64(len(data)) || !bytes.Equal(data[offset:offset+int64(len(chunk))], chunk) {
+			return fmt.Errorf("chunk %d offset %d does not point at its data", i, offset)
+		}
+	}
+	return nil
+}
+
+func TestMP4WatermarkRoundTrip(t *testing.T) {
+	// QuickTime closes udta with a 32-bit zero terminator
+	existingUdta := append(buildMP4Box("\xa9nam", []byte("title")), 0, 0, 0, 0)
+	tests := []struct {
+		name      string
+		co64      bool
+		moovFirst bool
+		udta      []byte
+	}{
+		{"stco, moov first", false, true, nil},
+		{"co64, moov first", true, true, nil},
+		{"stco, moov last", false, false, nil},
+		{"existing udta with terminator", false, true, existingUdta},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildTestMP4(t, tt.co64, tt.moovFirst, tt.udta)
+			if err := checkChunkOffsets(data); err != nil {
+				t.Fatalf("test file is broken: %v", err)
+			}
+			path := writeTestFile(t, "video.mp4", data)
+			checkContainerRoundTrip(t, mp4Container{}, path, checkChunkOffsets)
+		})
+	}
+}
+
+func TestMP4WatermarkKeepsUdtaTerminator(t *testing.T) {
+	udta := append(buildMP4Box("\xa9nam", []byte("title")), 0, 0, 0, 0)
+	path := writeTestFile(t, "video.mov", buildTestMP4(t, false, true, udta))
+	if err := (mp4Container{}).embed(path, buildWatermark("payload")); err != nil {
+		t.Fatal(err)
+	}
+
+	data := readTestFile(t, path)
+	top, _ := listMP4Boxes(bytes.NewReader(data), 0, int64(len(data)))
+	moov, _ := findMP4Box(top, "moov")
+	children, _ := listMP4Boxes(bytes.NewReader(data), moov.start+moov.headerSize, moov.end())
+	box, ok := findMP4Box(children, "udta")
+	if !ok {
+		t.Fatal("no udta after embedding")
+	}
+	if !bytes.HasSuffix(data[box.start:box.end()], []byte{0, 0, 0, 0}) {
+		t.Error("udta lost its zero terminator")
+	}
+}
+
+func TestReadMP4BoxMalformed(t *testing.T) {
+	header := func(size uint32, boxType string, extra ...byte) []byte {
+		box := binary.BigEndian.AppendUint32(nil, size)
+		return append(append(box, boxType...), extra...)
+	}
+	huge := binary.BigEndian.AppendUint64(nil, 0x7FFFFFFFFFFFFFF0)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"size below header", header(4, "moov")},
+		{"size past end", header(64, "moov", make([]byte, 8)...)},
+		{"truncated 64-bit size", header(1, "moov", 0, 0)},
+		{"64-bit size below header", header(1, "moov", make([]byte, 8)...)},
+		{"64-bit size wrapping", header(1, "moov", huge...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readMP4Box(bytes.NewReader(tt.data), 0, int64(len(tt.data))); err == nil {
+				t.Error("malformed box header accepted")
+			}
+			path := writeTestFile(t, "video.mp4", tt.data)
+			if marks, err := (mp4Container{}).extract(path); err != nil || marks != nil {
+				t.Errorf("extract = %q, %v; want no marks", marks, err)
+			}
+			if err := (mp4Container{}).embed(path, buildWatermark("x")); err == nil {
+				t.Error("embedded into a malformed MP4")
+			}
+		})
+	}
+}
+
+func TestMP4WatermarkNoMoov(t *testing.T) {
+	data := append(buildMP4Box("ftyp", []byte("isom")), buildMP4Box("mdat", []byte("data"))...)
+	path := writeTestFile(t, "video.mp4", data)
+	if err := (mp4Container{}).embed(path, buildWatermark("x")); err == nil {
+		t.Error("embedded into an MP4 without moov")
+	}
+	if removed, err := (mp4Container{}).remove(path, nil); err != nil || removed != 0 {
+		t.Errorf("remove = %d, %v", removed, err)
+	}
+}
+
+func TestMP4WatermarkTruncated(t *testing.T) {
+	path := writeTestFile(t, "video.mp4", buildTestMP4(t, false, true, nil))
+	if err := (mp4Container{}).embed(path, buildWatermark("payload")); err != nil {
+		t.Fatal(err)
+	}
+	checkTruncations(t, mp4Container{}, "video.mp4", readTestFile(t, path))
+}
+
+func TestAdjustChunkOffsetsOverflow(t *testing.T) {
+	table := binary.BigEndian.AppendUint32(make([]byte, 4), 1)
+	table = binary.BigEndian.AppendUint32(table, 0xFFFFFFF0)
+	stbl := buildMP4Box("stbl", buildMP4Box("stco", table))
+	if err := adjustChunkOffsets(stbl, 0, int64(len(stbl)), 0, 0x100); err == nil {
+		t.Error("stco offset overflow not reported")
+	}
+}
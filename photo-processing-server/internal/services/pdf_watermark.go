@@ -0,0 +1,346 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// PDF marks live in the document information dictionary under
+// /EnDcWatermarks, an array of hex strings in chain order. They are written
+// as an incremental update (new Info object, xref section and trailer), so
+// the original bytes are never touched. While our update is the file's last
+// revision it is rewritten in place on every change, and removing the last
+// mark truncates the file back to its original bytes. Once another tool has
+// appended a revision after ours, changes go into a fresh update instead.
+const (
+	PDF_WATERMARK_KEY    = "/EnDcWatermarks"
+	pdfUpdateMarker      = "\n%EnDcWatermark\n"
+	pdfMaxDictionaryScan = 1 << 20
+)
+
+var (
+	pdfSignature       = []byte("%PDF-")
+	pdfStartXRef       = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF`)
+	pdfWatermarkArray  = regexp.MustCompile(regexp.QuoteMeta(PDF_WATERMARK_KEY) + `\s*\[[^\]]*\]`)
+	pdfSizeEntry       = regexp.MustCompile(`/Size\s+(\d+)`)
+	pdfIDEntry         = regexp.MustCompile(`/ID\s*\[[^\]]*\]`)
+	pdfEncryptEntry    = regexp.MustCompile(`/Encrypt\s+\d+\s+\d+\s+R`)
+	pdfRootEntry       = regexp.MustCompile(`/Root\s+\d+\s+\d+\s+R`)
+	pdfInfoEntry       = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	pdfTrailerKeyword  = []byte("trailer")
+	pdfXRefKeyword     = []byte("xref")
+	pdfStartXRefMarker = []byte("startxref")
+)
+
+type pdfContainer struct{}
+
+func (pdfContainer) name() string { return "PDF info dictionary" }
+
+// pdfRevision is what an incremental update needs from the current last revision
+type pdfRevision struct {
+	xrefOffset int
+	trailer    []byte // trailer dictionary, or the xref stream dictionary
+	infoNum    int    // 0 when the document has no Info dictionary
+	infoGen    int
+	info       []byte // current Info dictionary, nil if absent or compressed
+}
+
+// readPDFRevision parses the trailer of the last revision and its Info dictionary
+func readPDFRevision(data []byte) (*pdfRevision, error) {
+	matches := pdfStartXRef.FindAllSubmatch(data, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("PDF has no startxref")
+	}
+	offset, err := strconv.Atoi(string(matches[len(matches)-1][1]))
+	if err != nil || offset >= len(data) {
+		return nil, fmt.Errorf("invalid PDF startxref offset")
+	}
+
+	// Classic xref table followed by "trailer", or an xref stream object
+	from := offset
+	if bytes.HasPrefix(bytes.TrimLeft(data[offset:], " \r\n"), pdfXRefKeyword) {
+		i := bytes.Index(data[offset:], pdfTrailerKeyword)
+		if i < 0 {
+			return nil, fmt.Errorf("PDF has no trailer")
+		}
+		from = offset + i
+	}
+	trailer := pdfDictionaryAt(data, from)
+	if trailer == nil || !pdfRootEntry.Match(trailer) {
+		return nil, fmt.Errorf("invalid PDF trailer")
+	}
+
+	revision := &pdfRevision{xrefOffset: offset, trailer: trailer}
+	if m := pdfInfoEntry.FindSubmatch(trailer); m != nil {
+		revision.infoNum, _ = strconv.Atoi(string(m[1]))
+		revision.infoGen, _ = strconv.Atoi(string(m[2]))
+		// The newest definition of an object wins in incrementally updated files
+		header := regexp.MustCompile(fmt.Sprintf(`(?:^|[^0-9])%d\s+%d\s+obj\b`, revision.infoNum, revision.infoGen))
+		if all := header.FindAllIndex(data, -1); len(all) > 0 {
+			revision.info = pdfDictionaryAt(data, all[len(all)-1][1])
+		}
+	}
+	return revision, nil
+}
+
+// pdfDictionaryAt returns the dictionary starting at the first "<<" at or
+// after pos, skipping nested dictionaries and strings
+func pdfDictionaryAt(data []byte, pos int) []byte {
+	start := bytes.Index(data[pos:], []byte("<<"))
+	if start < 0 || start > pdfMaxDictionaryScan {
+		return nil
+	}
+	start += pos
+
+	depth := 0
+	for i := start; i < len(data); i++ {
+		switch data[i] {
+		case '(':
+			i = pdfSkipLiteral(data, i)
+		case '<':
+			if i+1 < len(data) && data[i+1] == '<' {
+				depth++
+				i++
+			} else if end := bytes.IndexByte(data[i:], '>'); end >= 0 {
+				i += end
+			}
+		case '>':
+			if i+1 < len(data) && data[i+1] == '>' {
+				depth--
+				i++
+				if depth == 0 {
+					return data[start : i+1]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// pdfSkipLiteral returns the index of the parenthesis closing the literal string at i
+func pdfSkipLiteral(data []byte, i int) int {
+	depth := 0
+	for ; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return i
+}
+
+// pdfWatermarkMarks reads the marks array of an Info dictionary. Our own
+// updates write hex strings; rewriting tools may turn them into literals.
+func pdfWatermarkMarks(info []byte) [][]byte {
+	array := pdfWatermarkArray.Find(info)
+	if array == nil {
+		return nil
+	}
+	array = array[bytes.IndexByte(array, '[')+1 : len(array)-1]
+
+	var marks [][]byte
+	for i := 0; i < len(array); i++ {
+		switch array[i] {
+		case '<':
+			end := bytes.IndexByte(array[i:], '>')
+			if end < 0 {
+				return marks
+			}
+			if mark, err := hex.DecodeString(string(bytes.Join(bytes.Fields(array[i+1:i+end]), nil))); err == nil {
+				marks = append(marks, mark)
+			}
+			i += end
+		case '(':
+			end := pdfSkipLiteral(array, i)
+			marks = append(marks, pdfUnescapeLiteral(array[i+1:end]))
+			i = end
+		}
+	}
+	return marks
+}
+
+// pdfUnescapeLiteral decodes the escapes of a PDF literal string body
+func pdfUnescapeLiteral(s []byte) []byte {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out = append(out, s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case '\r', '\n':
+			// line continuation
+		default:
+			if c >= '0' && c <= '7' {
+				n, j := 0, i
+				for ; j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7'; j++ {
+					n = n*8 + int(s[j]-'0')
+				}
+				out = append(out, byte(n))
+				i = j - 1
+			} else {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// pdfOwnUpdate returns the offset of our update if it is the last revision, or -1
+func pdfOwnUpdate(data []byte) int {
+	i := bytes.LastIndex(data, []byte(pdfUpdateMarker))
+	if i < 0 || bytes.Count(data[i:], pdfStartXRefMarker) != 1 {
+		return -1
+	}
+	return i
+}
+
+// appendPDFUpdate appends an incremental update whose Info dictionary holds marks
+func appendPDFUpdate(data []byte, marks [][]byte) ([]byte, error) {
+	revision, err := readPDFRevision(data)
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	if m := pdfSizeEntry.FindSubmatch(revision.trailer); m != nil {
+		size, _ = strconv.Atoi(string(m[1]))
+	}
+	infoNum, infoGen := revision.infoNum, revision.infoGen
+	if infoNum == 0 {
+		infoNum, infoGen = size, 0
+		size++
+	}
+
+	// Keep the existing Info entries (title, author, ...) next to the marks
+	var entries []byte
+	if revision.info != nil {
+		entries = bytes.TrimSpace(pdfWatermarkArray.ReplaceAll(revision.info[2:len(revision.info)-2], nil))
+	}
+	var info bytes.Buffer
+	info.WriteString("<<")
+	if len(entries) > 0 {
+		info.WriteString(" ")
+		info.Write(entries)
+	}
+	info.WriteString(" " + PDF_WATERMARK_KEY + " [")
+	for i, mark := range marks {
+		if i > 0 {
+			info.WriteString(" ")
+		}
+		info.WriteString("<" + hex.EncodeToString(mark) + ">")
+	}
+	info.WriteString("] >>")
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)+info.Len()+256))
+	out.Write(data)
+	out.WriteString(pdfUpdateMarker)
+	objectOffset := out.Len()
+	fmt.Fprintf(out, "%d %d obj\n%s\nendobj\n", infoNum, infoGen, info.Bytes())
+	xrefOffset := out.Len()
+	fmt.Fprintf(out, "xref\n%d 1\n%010d %05d n\r\n", infoNum, objectOffset, infoGen)
+	fmt.Fprintf(out, "trailer\n<< /Size %d %s /Info %d %d R /Prev %d", size, pdfRootEntry.Find(revision.trailer), infoNum, infoGen, revision.xrefOffset)
+	for _, entry := range [][]byte{pdfIDEntry.Find(revision.trailer), pdfEncryptEntry.Find(revision.trailer)} {
+		if entry != nil {
+			out.WriteString(" ")
+			out.Write(entry)
+		}
+	}
+	fmt.Fprintf(out, " >>\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	return out.Bytes(), nil
+}
+
+// pdfCurrentMarks returns the marks of the last revision
+func pdfCurrentMarks(data []byte) ([][]byte, error) {
+	revision, err := readPDFRevision(data)
+	if err != nil {
+		return nil, err
+	}
+	return pdfWatermarkMarks(revision.info), nil
+}
+
+// writePDFMarks replaces the file's marks, reusing our trailing update if possible
+func writePDFMarks(filePath string, data []byte, marks [][]byte) error {
+	if own := pdfOwnUpdate(data); own >= 0 {
+		data = data[:own]
+		// Truncating only clears the marks if no earlier update of ours is
+		// still current, e.g. one followed by another tool's revision
+		if current, err := pdfCurrentMarks(data); len(marks) == 0 && err == nil && len(current) == 0 {
+			return WriteFileAtomic(filePath, data)
+		}
+	}
+	out, err := appendPDFUpdate(data, marks)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(filePath, out)
+}
+
+func (pdfContainer) embed(filePath string, mark []byte) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	marks, err := pdfCurrentMarks(data)
+	if err != nil {
+		return err
+	}
+	return writePDFMarks(filePath, data, append(marks, mark))
+}
+
+func (pdfContainer) extract(filePath string) ([][]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	marks, err := pdfCurrentMarks(data)
+	if err != nil {
+		return nil, nil
+	}
+	return marks, nil
+}
+
+func (pdfContainer) remove(filePath string, drop func(index int) bool) (int, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+	marks, err := pdfCurrentMarks(data)
+	if err != nil {
+		return 0, nil
+	}
+
+	var kept [][]byte
+	for i, mark := range marks {
+		if drop == nil || drop(i) {
+			continue
+		}
+		kept = append(kept, mark)
+	}
+	removed := len(marks) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, writePDFMarks(filePath, data, kept)
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// buildTestPDF writes a one-revision PDF with a classic xref table. info, if
+// not empty, becomes object 3 and the trailer's /Info.
+func buildTestPDF(info string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+	}
+	if info != "" {
+		objects = append(objects, info)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f\r\n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n\r\n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R", len(objects)+1)
+	if info != "" {
+		out.WriteString(" /Info 3 0 R")
+	}
+	fmt.Fprintf(&out, " /ID [<0123abcd> <0123abcd>] >>\nstartxref\n%d\n%%%%EOF\n", xref)
+	return out.Bytes()
+}
+
+var testPDFXRefEntry = regexp.MustCompile(`xref\s+(\d+) 1\s+(\d{10}) (\d{5}) n`)
+
+// checkPDFRevision checks that the last revision's trailer parses, keeps the
+// document ID, and that its xref entry points at the object it lists
+func checkPDFRevision(data []byte) error {
+	revision, err := readPDFRevision(data)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(revision.trailer, []byte("/ID [<0123abcd> <0123abcd>]")) {
+		return fmt.Errorf("trailer lost the document ID: %s", revision.trailer)
+	}
+	if !bytes.HasPrefix(data[revision.xrefOffset:], []byte("xref")) {
+		return fmt.Errorf("startxref %d does not point at an xref table", revision.xrefOffset)
+	}
+	if m := testPDFXRefEntry.FindSubmatch(data[revision.xrefOffset:]); m != nil {
+		offset, _ := strconv.Atoi(string(m[2]))
+		if !bytes.HasPrefix(data[offset:], []byte(string(m[1])+" 0 obj")) {
+			return fmt.Errorf("xref entry for object %s points at offset %d", m[1], offset)
+		}
+	}
+	return nil
+}
+
+func TestPDFWatermarkRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		info string
+	}{
+		{"no Info dictionary", ""},
+		{"existing Info", "<< /Title (Holiday \\(2024\\)) /Author (Studio) /Custom << /Nested (>>) >> >>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, "document.pdf", buildTestPDF(tt.info))
+			checkContainerRoundTrip(t, pdfContainer{}, path, func(data []byte) error {
+				if err := checkPDFRevision(data); err != nil {
+					return err
+				}
+				revision, _ := readPDFRevision(data)
+				if tt.info != "" && !bytes.Contains(revision.info, []byte("/Title (Holiday \\(2024\\))")) {
+					return fmt.Errorf("Info entries lost: %s", revision.info)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestPDFWatermarkAfterForeignRevision(t *testing.T) {
+	path := writeTestFile(t, "document.pdf", buildTestPDF(""))
+	first := buildWatermark("first")
+	if err := (pdfContainer{}).embed(path, first); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another tool appends a revision that does not touch the Info dictionary
+	data := readTestFile(t, path)
+	revision, err := readPDFRevision(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var foreign bytes.Buffer
+	foreign.Write(data)
+	object := foreign.Len()
+	foreign.WriteString("9 0 obj\n<< /Type /Annot >>\nendobj\n")
+	xref := foreign.Len()
+	fmt.Fprintf(&foreign, "xref\n9 1\n%010d 00000 n\r\ntrailer\n<< /Size 10 %s %s /Prev %d /ID [<0123abcd> <0123abcd>] >>\nstartxref\n%d\n%%%%EOF\n",
+		object, pdfRootEntry.Find(revision.trailer), pdfInfoEntry.Find(revision.trailer), revision.xrefOffset, xref)
+	path = writeTestFile(t, "document.pdf", foreign.Bytes())
+
+	second := buildWatermark("second")
+	if err := (pdfContainer{}).embed(path, second); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, path); !bytes.HasPrefix(got, foreign.Bytes()) {
+		t.Fatal("the foreign revision was rewritten instead of updated")
+	}
+	marks, _ := (pdfContainer{}).extract(path)
+	if len(marks) != 2 || !bytes.Equal(marks[0], first) || !bytes.Equal(marks[1], second) {
+		t.Fatalf("extracted %q, want both marks", marks)
+	}
+
+	// Truncating our update would bring back the first mark from before the foreign revision
+	if removed, err := (pdfContainer{}).remove(path, nil); err != nil || removed != 2 {
+		t.Fatalf("removed %d, %v", removed, err)
+	}
+	if marks, _ := (pdfContainer{}).extract(path); len(marks) != 0 {
+		t.Errorf("after removing every mark extracted %q", marks)
+	}
+	if err := checkPDFRevision(readTestFile(t, path)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPDFWatermarkMarks(t *testing.T) {
+	tests := []struct {
+		name string
+		info string
+		want []string
+	}{
+		{"hex strings", "<< /EnDcWatermarks [<3c3c3d3d61> <62 63>] >>", []string{"<<==a", "bc"}},
+		{"literal strings", `<< /EnDcWatermarks [(<<==a\(b\)==>>) (x\101\nz)] >>`, []string{"<<==a(b)==>>", "xA\nz"}},
+		{"mixed", "<< /EnDcWatermarks [(a) <62>] >>", []string{"a", "b"}},
+		{"empty array", "<< /EnDcWatermarks [] >>", nil},
+		{"no key", "<< /Title (x) >>", nil},
+		{"bad hex skipped", "<< /EnDcWatermarks [<zz> <61>] >>", []string{"a"}},
+		{"unterminated hex", "<< /EnDcWatermarks [<61> <62 ] >>", []string{"a"}},
+		{"unterminated literal", "<< /EnDcWatermarks [(abc ] >>", []string{"abc "}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, mark := range pdfWatermarkMarks([]byte(tt.info)) {
+				got = append(got, string(mark))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("marks %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPDFRevisionMalformed(t *testing.T) {
+	valid := buildTestPDF("")
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"header only", []byte("%PDF-1.4\n")},
+		{"no startxref", bytes.Replace(valid, []byte("startxref"), []byte("startxrfe"), 1)},
+		{"startxref past end", []byte("%PDF-1.4\nstartxref\n999999\n%%EOF\n")},
+		{"startxref overflow", []byte("%PDF-1.4\nstartxref\n99999999999999999999999\n%%EOF\n")},
+		{"no trailer", []byte("%PDF-1.4\nxref\n0 1\nstartxref\n9\n%%EOF\n")},
+		{"trailer without Root", bytes.Replace(valid, []byte("/Root 1 0 R"), []byte("/Rot 1 0 R"), 1)},
+		{"unterminated trailer", []byte("%PDF-1.4\nxref\ntrailer\n<< /Root 1 0 R << (>>\nstartxref\n9\n%%EOF\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readPDFRevision(tt.data); err == nil {
+				t.Error("malformed PDF parsed without error")
+			}
+			path := writeTestFile(t, "document.pdf", tt.data)
+			if marks, err := (pdfContainer{}).extract(path); err != nil || marks != nil {
+				t.Errorf("extract = %q, %v; want no marks", marks, err)
+			}
+			if err := (pdfContainer{}).embed(path, buildWatermark("x")); err == nil {
+				t.Error("embedded into a malformed PDF")
+			}
+			if removed, err := (pdfContainer{}).remove(path, nil); err != nil || removed != 0 {
+				t.Errorf("remove = %d, %v", removed, err)
+			}
+		})
+	}
+}
+
+func TestPDFWatermarkTruncated(t *testing.T) {
+	path := writeTestFile(t, "document.pdf", buildTestPDF("<< /Title (x) >>"))
+	if err := (pdfContainer{}).embed(path, buildWatermark("payload")); err != nil {
+		t.Fatal(err)
+	}
+	checkTruncations(t, pdfContainer{}, "document.pdf", readTestFile(t, path))
+}
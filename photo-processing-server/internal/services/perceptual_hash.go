@@ -0,0 +1,114 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"gocv.io/x/gocv"
+)
+
+// PHASH_MATCH_DISTANCE is the largest Hamming distance (out of 64 bits)
+// at which two perceptual hashes are considered the same picture
+const PHASH_MATCH_DISTANCE = 10
+
+// PerceptualHash fingerprints image content independently of encoding
+type PerceptualHash struct {
+	PHash uint64 // low-frequency DCT signs relative to the median
+	DHash uint64 // horizontal gradient signs
+}
+
+// ComputePerceptualHash computes pHash and dHash of an image
+func ComputePerceptualHash(imagePath string) (PerceptualHash, error) {
+	if err := initializeOpenCV(); err != nil {
+		return PerceptualHash{}, err
+	}
+	gray := gocv.IMRead(imagePath, gocv.IMReadGrayScale)
+	if gray.Empty() {
+		return PerceptualHash{}, fmt.Errorf("failed to load image: %s", filepath.Base(imagePath))
+	}
+	defer gray.Close()
+
+	// pHash: 32x32 DCT, top-left 8x8 block
+	small := gocv.NewMat()
+	defer small.Close()
+	gocv.Resize(gray, &small, image.Pt(32, 32), 0, 0, gocv.InterpolationArea)
+	smallF := gocv.NewMat()
+	defer smallF.Close()
+	small.ConvertTo(&smallF, gocv.MatTypeCV32F)
+	dct := gocv.NewMat()
+	defer dct.Close()
+	gocv.DCT(smallF, &dct, gocv.DftForward)
+
+	var coeffs [64]float64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			coeffs[y*8+x] = float64(dct.GetFloatAt(y, x))
+		}
+	}
+
+	// dHash: 9x8 thumbnail, compare neighbours
+	thumb := gocv.NewMat()
+	defer thumb.Close()
+	gocv.Resize(gray, &thumb, image.Pt(9, 8), 0, 0, gocv.InterpolationArea)
+	var pix [72]uint8
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 9; x++ {
+			pix[y*9+x] = thumb.GetUCharAt(y, x)
+		}
+	}
+
+	return PerceptualHash{PHash: pHashBits(coeffs), DHash: dHashBits(pix)}, nil
+}
+
+// pHashBits sets a bit for each coefficient above the median (DC excluded)
+func pHashBits(coeffs [64]float64) uint64 {
+	sorted := make([]float64, 63)
+	copy(sorted, coeffs[1:])
+	sort.Float64s(sorted)
+	median := (sorted[31] + sorted[32]) / 2
+
+	var hash uint64
+	for i, c := range coeffs {
+		if i > 0 && c > median {
+			hash |= 1 << uint(63-i)
+		}
+	}
+	return hash
+}
+
+// dHashBits sets a bit where a pixel is brighter than its right neighbour
+func dHashBits(pix [72]uint8) uint64 {
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if pix[y*9+x] > pix[y*9+x+1] {
+				hash |= 1 << uint(63-(y*8+x))
+			}
+		}
+	}
+	return hash
+}
+
+// HammingDistance counts differing bits between two hashes
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// FormatHash renders a 64-bit hash as 16 hex digits
+func FormatHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// ParseHash parses a hash produced by FormatHash
+func ParseHash(s string) (uint64, error) {
+	return strconv.ParseUint(s, 16, 64)
+}
+
+// Distance returns the pHash and dHash distances to another hash
+func (h PerceptualHash) Distance(other PerceptualHash) (int, int) {
+	return HammingDistance(h.PHash, other.PHash), HammingDistance(h.DHash, other.DHash)
+}
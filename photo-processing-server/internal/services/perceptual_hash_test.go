@@ -0,0 +1,94 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPHashBits(t *testing.T) {
+	ramp := func(dc float64) (coeffs [64]float64) {
+		coeffs[0] = dc
+		for i := 1; i < 64; i++ {
+			coeffs[i] = float64(i)
+		}
+		return coeffs
+	}
+	var alternating [64]float64
+	for i := range alternating {
+		alternating[i] = float64(1 - i%2*2)
+	}
+	var flat [64]float64
+
+	tests := []struct {
+		name   string
+		coeffs [64]float64
+		want   uint64
+	}{
+		// Median of 1..63 is 32, so coefficients 33..63 set the low 31 bits
+		{"ramp", ramp(0), 0x7fffffff},
+		{"DC term ignored", ramp(1e9), 0x7fffffff},
+		{"negative DC term ignored", ramp(-1e9), 0x7fffffff},
+		{"flat", flat, 0},
+		// Even coefficients (1) are above the median of 0; odd ones (-1) are not
+		{"alternating", alternating, 0x2aaaaaaaaaaaaaaa},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pHashBits(tt.coeffs); got != tt.want {
+				t.Errorf("hash %s, want %s", FormatHash(got), FormatHash(tt.want))
+			}
+		})
+	}
+}
+
+func TestDHashBits(t *testing.T) {
+	grid := func(value func(x, y int) uint8) (pix [72]uint8) {
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 9; x++ {
+				pix[y*9+x] = value(x, y)
+			}
+		}
+		return pix
+	}
+	tests := []struct {
+		name string
+		pix  [72]uint8
+		want uint64
+	}{
+		{"flat", grid(func(x, y int) uint8 { return 128 }), 0},
+		{"darkening to the right", grid(func(x, y int) uint8 { return uint8(200 - 10*x) }), 0xffffffffffffffff},
+		{"brightening to the right", grid(func(x, y int) uint8 { return uint8(10 * x) }), 0},
+		{"first row only", grid(func(x, y int) uint8 {
+			if y == 0 {
+				return uint8(200 - 10*x)
+			}
+			return 128
+		}), 0xff00000000000000},
+		{"dark last column", grid(func(x, y int) uint8 {
+			if x == 8 {
+				return 0
+			}
+			return 255
+		}), 0x0101010101010101},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dHashBits(tt.pix); got != tt.want {
+				t.Errorf("hash %s, want %s", FormatHash(got), FormatHash(tt.want))
+			}
+		})
+	}
+}
+
+func TestParseHashRoundTrip(t *testing.T) {
+	for _, hash := range []uint64{0, 1, 0x0123456789abcdef, 0xffffffffffffffff} {
+		t.Run(fmt.Sprintf("%x", hash), func(t *testing.T) {
+			if got, err := ParseHash(FormatHash(hash)); err != nil || got != hash {
+				t.Errorf("parsed %x, %v", got, err)
+			}
+		})
+	}
+	if _, err := ParseHash("not a hash"); err == nil {
+		t.Error("parsed an invalid hash")
+	}
+}
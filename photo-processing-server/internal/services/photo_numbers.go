@@ -0,0 +1,88 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MAX_PHOTO_NUMBERS caps how many photos one spec can select, so a typo like
+// "1-1000000" fails instead of stamping for minutes
+const MAX_PHOTO_NUMBERS = 10000
+
+// PhotoNumbers selects photos by the first number in their file name. In JSON
+// it is either a spec string like "1-5,12" or a list of numbers and specs,
+// e.g. [1, 2, "5-7"].
+type PhotoNumbers []int
+
+// ParsePhotoNumbers parses comma-separated numbers and inclusive ranges into
+// sorted unique photo numbers
+func ParsePhotoNumbers(spec string) (PhotoNumbers, error) {
+	seen := map[int]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last := part, part
+		if dash := strings.Index(part, "-"); dash >= 0 {
+			first, last = strings.TrimSpace(part[:dash]), strings.TrimSpace(part[dash+1:])
+		}
+		from, err := strconv.Atoi(first)
+		if err != nil || from < 1 {
+			return nil, fmt.Errorf("invalid photo number %q in %q", first, spec)
+		}
+		to, err := strconv.Atoi(last)
+		if err != nil || to < from {
+			return nil, fmt.Errorf("invalid photo range %q in %q", part, spec)
+		}
+		if to-from >= MAX_PHOTO_NUMBERS {
+			return nil, fmt.Errorf("photo range %q selects more than %d photos", part, MAX_PHOTO_NUMBERS)
+		}
+		for n := from; n <= to; n++ {
+			seen[n] = true
+		}
+		if len(seen) > MAX_PHOTO_NUMBERS {
+			return nil, fmt.Errorf("%q selects more than %d photos", spec, MAX_PHOTO_NUMBERS)
+		}
+	}
+
+	numbers := make(PhotoNumbers, 0, len(seen))
+	for n := range seen {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+// UnmarshalJSON accepts a spec string or a list of numbers and spec strings
+func (p *PhotoNumbers) UnmarshalJSON(data []byte) error {
+	var spec string
+	if err := json.Unmarshal(data, &spec); err == nil {
+		numbers, err := ParsePhotoNumbers(spec)
+		*p = numbers
+		return err
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return fmt.Errorf("photo numbers must be a string like \"1-5,12\" or a list")
+	}
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		var number int
+		if err := json.Unmarshal(item, &number); err == nil {
+			parts = append(parts, strconv.Itoa(number))
+			continue
+		}
+		if err := json.Unmarshal(item, &spec); err != nil {
+			return fmt.Errorf("invalid photo number %s", item)
+		}
+		parts = append(parts, spec)
+	}
+	numbers, err := ParsePhotoNumbers(strings.Join(parts, ","))
+	*p = numbers
+	return err
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParsePhotoNumbers(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    PhotoNumbers
+		wantErr bool
+	}{
+		{"", PhotoNumbers{}, false},
+		{"3", PhotoNumbers{3}, false},
+		{"1-3, 7 ,2", PhotoNumbers{1, 2, 3, 7}, false},
+		{" 5 - 6 ,,", PhotoNumbers{5, 6}, false},
+		{"4-4", PhotoNumbers{4}, false},
+		{"0", nil, true},
+		{"-3", nil, true},
+		{"3-1", nil, true},
+		{"1-2-3", nil, true},
+		{"a", nil, true},
+		{"1-", nil, true},
+		{"99999999999999999999", nil, true},
+		{fmt.Sprintf("1-%d", MAX_PHOTO_NUMBERS), nil, false}, // exactly at the limit
+		{fmt.Sprintf("1-%d", MAX_PHOTO_NUMBERS+1), nil, true},
+		{fmt.Sprintf("1-%d,%d", MAX_PHOTO_NUMBERS, MAX_PHOTO_NUMBERS+5), nil, true},
+		{"1-9223372036854775807", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParsePhotoNumbers(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("numbers %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPhotoNumbersUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    PhotoNumbers
+		wantErr bool
+	}{
+		{`"1-3,5"`, PhotoNumbers{1, 2, 3, 5}, false},
+		{`[4, 2, "6-7"]`, PhotoNumbers{2, 4, 6, 7}, false},
+		{`[]`, PhotoNumbers{}, false},
+		{`[1.5]`, nil, true},
+		{`[-2]`, nil, true},
+		{`[true]`, nil, true},
+		{`{"a":1}`, nil, true},
+		{`"3-1"`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			var got PhotoNumbers
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("numbers %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
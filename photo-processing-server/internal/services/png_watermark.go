@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+)
+
+// PNG watermark chunk: private, ancillary, safe-to-copy chunk "enDc"
+// (lowercase 1st = ancillary, lowercase 2nd = private, uppercase 3rd =
+// reserved bit, lowercase 4th = safe-to-copy) inserted before the first IDAT.
+var (
+	pngSignature        = []byte{0x89, 'P', 'N', 'G', 0x0D, 0x0A, 0x1A, 0x0A}
+	PNG_WATERMARK_CHUNK = []byte("enDc")
+	pngChunkIDAT        = []byte("IDAT")
+	pngChunkIEND        = []byte("IEND")
+)
+
+// pngChunk is a parsed chunk with its byte range in the file
+type pngChunk struct {
+	chunkType []byte
+	start     int // offset of the length field
+	end       int // offset just past the CRC
+	data      []byte
+}
+
+type pngContainer struct{}
+
+func (pngContainer) name() string { return "PNG chunk" }
+
+// parsePNGChunks walks all chunks up to and including IEND
+func parsePNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("not a PNG file")
+	}
+
+	var chunks []pngChunk
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		// Compare before converting, so a huge length cannot wrap on 32-bit ints
+		if uint64(binary.BigEndian.Uint32(data[pos:pos+4])) > uint64(len(data)-pos-12) {
+			return nil, fmt.Errorf("invalid PNG chunk length at offset %d", pos)
+		}
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		end := pos + 12 + length
+		chunk := pngChunk{
+			chunkType: data[pos+4 : pos+8],
+			start:     pos,
+			end:       end,
+			data:      data[pos+8 : pos+8+length],
+		}
+		chunks = append(chunks, chunk)
+		pos = end
+		if bytes.Equal(chunk.chunkType, pngChunkIEND) {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// buildPNGChunk serializes a chunk with its CRC
+func buildPNGChunk(chunkType []byte, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk[0:4], uint32(len(data)))
+	copy(chunk[4:8], chunkType)
+	chunk = append(chunk, data...)
+
+	crc := crc32.NewIEEE()
+	crc.Write(chunk[4:])
+	return binary.BigEndian.AppendUint32(chunk, crc.Sum32())
+}
+
+func (pngContainer) embed(filePath string, mark []byte) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	chunks, err := parsePNGChunks(data)
+	if err != nil {
+		return err
+	}
+
+	insertAt := -1
+	for _, chunk := range chunks {
+		if bytes.Equal(chunk.chunkType, pngChunkIDAT) {
+			insertAt = chunk.start
+			break
+		}
+	}
+	if insertAt == -1 {
+		return fmt.Errorf("PNG has no IDAT chunk")
+	}
+
+	chunk := buildPNGChunk(PNG_WATERMARK_CHUNK, mark)
+	out := make([]byte, 0, len(data)+len(chunk))
+	out = append(out, data[:insertAt]...)
+	out = append(out, chunk...)
+	out = append(out, data[insertAt:]...)
+	return WriteFileAtomic(filePath, out)
+}
+
+func (pngContainer) extract(filePath string) ([][]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := parsePNGChunks(data)
+	if err != nil {
+		return nil, nil
+	}
+
+	var marks [][]byte
+	for _, chunk := range chunks {
+		if bytes.Equal(chunk.chunkType, PNG_WATERMARK_CHUNK) {
+			marks = append(marks, chunk.data)
+		}
+	}
+	return marks, nil
+}
+
+func (pngContainer) remove(filePath string, drop func(index int) bool) (int, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+	chunks, err := parsePNGChunks(data)
+	if err != nil {
+		return 0, nil
+	}
+
+	out := make([]byte, 0, len(data))
+	last := 0
+	index, removed := 0, 0
+	for _, chunk := range chunks {
+		if !bytes.Equal(chunk.chunkType, PNG_WATERMARK_CHUNK) {
+			continue
+		}
+		if drop == nil || drop(index) {
+			out = append(out, data[last:chunk.start]...)
+			last = chunk.end
+			removed++
+		}
+		index++
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	out = append(out, data[last:]...)
+	return removed, WriteFileAtomic(filePath, out)
+}
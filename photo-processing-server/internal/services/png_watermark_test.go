@@ -0,0 +1,87 @@
+package services
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+)
+
+func encodeTestPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPNGWatermarkRoundTrip(t *testing.T) {
+	path := writeTestFile(t, "photo.png", encodeTestPNG(t))
+	checkContainerRoundTrip(t, pngContainer{}, path, func(data []byte) error {
+		_, err := png.Decode(bytes.NewReader(data))
+		return err
+	})
+}
+
+func TestPNGWatermarkBeforeIDAT(t *testing.T) {
+	path := writeTestFile(t, "photo.png", encodeTestPNG(t))
+	if err := (pngContainer{}).embed(path, buildWatermark("payload")); err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := parsePNGChunks(readTestFile(t, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, chunk := range chunks {
+		if bytes.Equal(chunk.chunkType, pngChunkIDAT) {
+			if i == 0 || !bytes.Equal(chunks[i-1].chunkType, PNG_WATERMARK_CHUNK) {
+				t.Error("watermark chunk is not right before the first IDAT")
+			}
+			return
+		}
+	}
+	t.Fatal("no IDAT chunk")
+}
+
+func TestParsePNGChunksMalformed(t *testing.T) {
+	withChunk := func(length uint32, chunkType string) []byte {
+		data := append([]byte{}, pngSignature...)
+		data = append(data, byte(length>>24), byte(length>>16), byte(length>>8), byte(length))
+		data = append(data, chunkType...)
+		return append(data, 0, 0, 0, 0)
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"empty", nil, true},
+		{"not a PNG", []byte("\x89PNX\r\n\x1a\n"), true},
+		{"length past end", withChunk(100, "IHDR"), true},
+		{"maximum length", withChunk(0xFFFFFFFF, "IHDR"), true},
+		{"signature only", pngSignature, false},
+		{"no IDAT", withChunk(0, "IEND"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parsePNGChunks(tt.data); (err != nil) != tt.wantErr {
+				t.Errorf("error %v, wantErr %v", err, tt.wantErr)
+			}
+			path := writeTestFile(t, "photo.png", tt.data)
+			if marks, err := (pngContainer{}).extract(path); err != nil || marks != nil {
+				t.Errorf("extract = %q, %v; want no marks", marks, err)
+			}
+			if err := (pngContainer{}).embed(path, buildWatermark("x")); err == nil {
+				t.Error("embedded into a PNG without image data")
+			}
+		})
+	}
+}
+
+func TestPNGWatermarkTruncated(t *testing.T) {
+	path := writeTestFile(t, "photo.png", encodeTestPNG(t))
+	if err := (pngContainer{}).embed(path, buildWatermark("payload")); err != nil {
+		t.Fatal(err)
+	}
+	checkTruncations(t, pngContainer{}, "photo.png", readTestFile(t, path))
+}
@@ -8,11 +8,36 @@ import (
     "path/filepath"
     "photo-processing-server/internal/models"
     "regexp"
+    "sort"
     "strconv"
     "strings"
     "io"
+    "time"
 )
 
+// BatchOptions holds optional batch features that have no Kotlin counterpart
+type BatchOptions struct {
+	RobustWatermark   bool   // embed the order number into image pixels
+	StructuredPayload bool   // embed a WatermarkPayload instead of "<baseText> <orderNumber>"
+	Owner             string // owner label of the copy's mark in the watermark chain
+	TextMode          string // TEXT_MARK_VISIBLE (default) or TEXT_MARK_ZERO_WIDTH for text files
+	VisibleStyle      *VisibleWatermarkStyle // look of the visible watermark, nil for the original one
+	Logo              *LogoWatermark         // stamp the configured logo onto every image, nil for none
+	// Photos to stamp with the visible watermark instead of the single photo
+	// number; VisibleTexts overrides the text per photo and adds its photos
+	VisiblePhotos PhotoNumbers
+	VisibleTexts  map[int]string
+	// How copies swap photos; the zero value swaps N with N+SWAP_OFFSET.
+	// OnSwap receives the swaps made in each copy.
+	Swap   SwapPlan
+	OnSwap func(orderNumber string, swaps []models.SwapOperation)
+
+	// Issuance details recorded in the issuance registry
+	JobID     string
+	UserID    string
+	Recipient string
+}
+
 // PerformBatchCopyAndEncode main function for batch copying and encoding (exact port from Kotlin)
 func PerformBatchCopyAndEncode(
 	sourceFolder string,
@@ -25,9 +50,28 @@ func PerformBatchCopyAndEncode(
 	photoNumber *int,
 	progress func(float32),
 	cleanName string, // Original folder name without UUID suffixes for ZIP naming
+	options BatchOptions,
 ) error {
 	logger := GetGlobalLogger()
 	
+	if err := CheckTextMarkMode(options.TextMode); err != nil {
+		return err
+	}
+	if err := options.VisibleStyle.Validate(); err != nil {
+		return err
+	}
+	if err := options.Logo.Validate(); err != nil {
+		return err
+	}
+	if addSwap && options.Swap.Strategy == "" {
+		options.Swap, _ = NewSwapPlan(SWAP_STRATEGY_OFFSET, nil, 0)
+	}
+	for number := range options.VisibleTexts {
+		if number < 1 {
+			return fmt.Errorf("invalid photo number %d in visible watermark texts", number)
+		}
+	}
+	
 	// 1) Create main folder for all copies, e.g. "Test1-Bundle-Copies"
 	copiesFolder := filepath.Join(filepath.Dir(sourceFolder), filepath.Base(sourceFolder)+"-Copies")
 	err := EnsureDirectoryExists(copiesFolder)
@@ -81,17 +125,15 @@ func PerformBatchCopyAndEncode(
 			progress(completedOperations / totalOperations)
 		}
 		
-		// Process files (invisible watermark, rename, etc.)
-		err = processFiles(destinationFolder, baseTextWithoutNumber, orderNumber)
+		// One payload per copy, shared by every file and the issuance record
+		payload, err := copyPayload(baseTextWithoutNumber, orderNumber, i+1, options)
 		if err != nil {
 			return err
 		}
-		completedOperations++
-		if progress != nil {
-			progress(completedOperations / totalOperations)
-		}
 		
-		// Visible watermark if needed
+		// Visible watermark if needed. Stamping re-encodes the photo, which would
+		// drop the invisible marks, so it runs before processFiles
+		var stamped map[string]string
 		if addWatermark {
 			actualPhotoNumber := startNumber + i
 			if photoNumber != nil {
@@ -103,7 +145,8 @@ func PerformBatchCopyAndEncode(
 				actualWatermarkText = watermarkText
 			}
 			
-			err = addVisibleWatermarkToPhoto(destinationFolder, actualWatermarkText, actualPhotoNumber)
+			texts := visibleTextsForCopy(actualWatermarkText, actualPhotoNumber, options)
+			stamped, err = addVisibleWatermarksToPhotos(destinationFolder, texts, options.VisibleStyle)
 			if err != nil {
 				return err
 			}
@@ -113,18 +156,38 @@ func PerformBatchCopyAndEncode(
 			}
 		}
 		
+		// Process files (invisible watermark, rename, etc.)
+		err = processFiles(destinationFolder, payload, orderNumber, options)
+		if err != nil {
+			return err
+		}
+		completedOperations++
+		if progress != nil {
+			progress(completedOperations / totalOperations)
+		}
+		
 		// Swap if needed
+		var swaps []models.SwapOperation
 		if addSwap {
-			err = performSwap(destinationFolder, orderNumber)
+			swaps, err = performSwap(destinationFolder, orderNumber, options.Swap)
 			if err != nil {
 				return err
 			}
+			if options.OnSwap != nil {
+				options.OnSwap(orderNumber, swaps)
+			}
 			completedOperations++
 			if progress != nil {
 				progress(completedOperations / totalOperations)
 			}
 		}
 		
+		// Record the issued watermark before the folder is zipped
+		err = recordIssuance(sourceFolder, destinationFolder, baseTextWithoutNumber, orderNumber, i+1, payload, stamped, swaps, options)
+		if err != nil {
+			return err
+		}
+		
 		// Save destination for ZIP stage
 		foldersToProcess = append(foldersToProcess, struct {
 			folder      string
@@ -161,26 +224,71 @@ func PerformBatchCopyAndEncode(
 	return nil
 }
 
+// copyPayload builds the encoded payload of one batch copy
+func copyPayload(baseText string, orderNumber string, copyNumber int, options BatchOptions) (string, error) {
+	if !options.StructuredPayload {
+		return EncodePayload(fmt.Sprintf("%s %s", baseText, orderNumber)), nil
+	}
+	issuer := options.Owner
+	if issuer == "" {
+		issuer = options.UserID
+	}
+	return EncodeStructuredPayload(WatermarkPayload{
+		OrderID:     orderNumber,
+		CopyIndex:   copyNumber,
+		RecipientID: options.Recipient,
+		IssuedAt:    time.Now().UTC(),
+		Issuer:      issuer,
+		BaseText:    baseText,
+	})
+}
+
 // processFiles processes files based on their type (exact port from Kotlin)
-func processFiles(folder string, baseText string, orderNumber string) error {
-	files, err := GetSupportedFiles(folder)
+func processFiles(folder string, encodedWatermark string, orderNumber string, options BatchOptions) error {
+	files, err := GetMarkableFiles(folder)
 	if err != nil {
 		return err
 	}
 	
-	encodedText := fmt.Sprintf("%s %s", baseText, orderNumber)
-	encodedWatermark := EncodeText(encodedText)
-	watermark := AddWatermark(encodedText)
+	// Appended after any marks the source files already carry
+	watermark := string(buildWatermark(ownedPayload(options.Owner, encodedWatermark)))
 	
 	for _, file := range files {
 		if IsVideoFile(file) {
 			// Only add invisible watermark to video files
-            err := AddBinaryWatermark(file, encodedWatermark)
+            err := AddOwnedWatermark(file, options.Owner, encodedWatermark)
 			if err != nil {
 				return err
 			}
 			logger := GetGlobalLogger()
 			logger.Log(fmt.Sprintf("Added watermark to video: %s", filepath.Base(file)))
+		} else if IsImageFile(file) {
+			// The logo becomes part of the pixels the robust mark is embedded in
+			if options.Logo != nil {
+				if err := AddLogoToImage(file, options.Logo); err != nil {
+					return err
+				}
+			}
+			// Robust mark re-encodes pixels, so it must precede byte-level marks
+			if options.RobustWatermark {
+				if err := addRobustWatermarkToPhoto(file, orderNumber); err != nil {
+					return err
+				}
+			}
+			// Container segment or length-prefixed trailer, so long payloads stay findable
+			if err := AddOwnedWatermark(file, options.Owner, encodedWatermark); err != nil {
+				return err
+			}
+		} else if IsDocumentFile(file) {
+			// PDF/DOCX metadata, SVG/HTML comment or CSV comment row
+			if err := AddOwnedWatermark(file, options.Owner, encodedWatermark); err != nil {
+				return err
+			}
+		} else if IsTextFile(file) && options.TextMode == TEXT_MARK_ZERO_WIDTH {
+			// Hidden in the body instead of appended in plain sight
+			if err := AddZeroWidthWatermark(file, options.Owner, encodedWatermark); err != nil {
+				return err
+			}
 		} else {
 			// Process other files normally (text files get text watermarks)
 			_, err := ProcessFile(file, watermark)
@@ -193,90 +301,163 @@ func processFiles(folder string, baseText string, orderNumber string) error {
 	return nil
 }
 
-// addVisibleWatermarkToPhoto adds visible watermark to photo with specified number (exact port from Kotlin)
-func addVisibleWatermarkToPhoto(folder string, watermarkText string, photoNumber int) error {
-	logger := GetGlobalLogger()
-	
-	files, err := GetSupportedFiles(folder)
+// recordIssuance stores the watermark and file hashes of a finished copy
+// stamped maps the relative paths of photos with a visible watermark to their
+// text as stamped, before swaps moved photo contents between files.
+func recordIssuance(sourceFolder string, copyFolder string, baseText string, orderNumber string, copyNumber int, payload string, stamped map[string]string, swaps []models.SwapOperation, options BatchOptions) error {
+	files, err := hashCopyFiles(copyFolder)
 	if err != nil {
 		return err
 	}
-	
-	found := false
-	for _, file := range files {
-		if IsImageFile(file) {
-			fileNumber := extractFileNumber(filepath.Base(file))
-			if fileNumber != nil && *fileNumber == photoNumber {
-				err := AddTextToImage(file, watermarkText, BottomRight)
-				if err != nil {
-					return err
-				}
-				found = true
-				break
-			}
+	stamped = swapStampedPaths(stamped, swaps)
+	for i := range files {
+		files[i].VisibleText = stamped[files[i].Path]
+	}
+	
+	text := fmt.Sprintf("%s %s", baseText, orderNumber)
+	var visibleStyle *VisibleWatermarkStyle
+	if len(stamped) > 0 {
+		visibleStyle = options.VisibleStyle
+	}
+	return GetIssuanceRegistry().Record(&IssuedWatermark{
+		JobID:        options.JobID,
+		UserID:       options.UserID,
+		Recipient:    options.Recipient,
+		Owner:        options.Owner,
+		SourceFolder: sourceFolder,
+		CopyFolder:   copyFolder,
+		OrderNumber:  orderNumber,
+		CopyNumber:   copyNumber,
+		Text:         text,
+		Payload:      payload,
+		VisibleStyle: visibleStyle,
+		Swaps:        swaps,
+		KeyID:        PayloadKeyID(payload),
+		Files:        files,
+	})
+}
+
+// swapStampedPaths moves each stamped text to the file its photo was swapped
+// into, applying swaps in order
+func swapStampedPaths(stamped map[string]string, swaps []models.SwapOperation) map[string]string {
+	moved := make(map[string]string, len(stamped))
+	for path, text := range stamped {
+		moved[path] = text
+	}
+	for _, swap := range swaps {
+		a, b := moved[swap.FileA], moved[swap.FileB]
+		delete(moved, swap.FileA)
+		delete(moved, swap.FileB)
+		if b != "" {
+			moved[swap.FileA] = b
+		}
+		if a != "" {
+			moved[swap.FileB] = a
 		}
 	}
-	
-	if !found {
-		logger.Log(fmt.Sprintf("No photo with number %d found in %s", photoNumber, filepath.Base(folder)))
-	}
-	
-	return nil
+	return moved
 }
 
-// performSwap performs swap operation for files in folder (exact port from Kotlin)
-func performSwap(folder string, orderNumber string) error {
-	logger := GetGlobalLogger()
-	
-	baseNumber, err := strconv.Atoi(orderNumber)
+// addRobustWatermarkToPhoto embeds the numeric order number into image pixels
+func addRobustWatermarkToPhoto(file string, orderNumber string) error {
+	orderID, err := strconv.ParseUint(orderNumber, 10, 32)
 	if err != nil {
-		return err
+		return fmt.Errorf("order number %s cannot be used as a robust watermark: %v", orderNumber, err)
 	}
-	swapNumber := baseNumber + 10
-	
-	logger.Processing(fmt.Sprintf("Starting swap operation for number %d with %d ...", baseNumber, swapNumber))
+	err = EmbedRobustWatermark(file, uint32(orderID))
+	if err == ErrRobustImageTooSmall {
+		GetGlobalLogger().Log(fmt.Sprintf("Skipping robust watermark for %s: %v", filepath.Base(file), err))
+		return nil
+	}
+	return err
+}
+
+// visibleTextsForCopy maps the photo numbers to stamp in one copy to their
+// text. Without VisiblePhotos or VisibleTexts it is the single photoNumber.
+func visibleTextsForCopy(watermarkText string, photoNumber int, options BatchOptions) map[int]string {
+	texts := map[int]string{}
+	for _, number := range options.VisiblePhotos {
+		texts[number] = watermarkText
+	}
+	for number, text := range options.VisibleTexts {
+		if text == "" {
+			text = watermarkText
+		}
+		texts[number] = text
+	}
+	if len(texts) == 0 {
+		texts[photoNumber] = watermarkText
+	}
+	return texts
+}
+
+// addVisibleWatermarkToPhoto adds visible watermark to photo with specified number (exact port from Kotlin)
+func addVisibleWatermarkToPhoto(folder string, watermarkText string, photoNumber int, style *VisibleWatermarkStyle) error {
+	_, err := addVisibleWatermarksToPhotos(folder, map[int]string{photoNumber: watermarkText}, style)
+	return err
+}
+
+// addVisibleWatermarksToPhotos stamps the first photo of each number in texts
+// with its text and returns the stamped paths, relative to folder, with their text
+func addVisibleWatermarksToPhotos(folder string, texts map[int]string, style *VisibleWatermarkStyle) (map[string]string, error) {
+	logger := GetGlobalLogger()
 	
-	// Take all images in folder
 	files, err := GetSupportedFiles(folder)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
-	var allImages []string
+	stamped := map[string]string{}
+	done := map[int]bool{}
 	for _, file := range files {
-		if IsImageFile(file) {
-			allImages = append(allImages, file)
+		if !IsImageFile(file) {
+			continue
+		}
+		fileNumber := extractFileNumber(filepath.Base(file))
+		if fileNumber == nil || done[*fileNumber] {
+			continue
+		}
+		text, ok := texts[*fileNumber]
+		if !ok {
+			continue
+		}
+		if err := AddStyledTextToImage(file, text, style.TextPosition(), style); err != nil {
+			return nil, err
+		}
+		done[*fileNumber] = true
+		if rel, err := filepath.Rel(folder, file); err == nil {
+			stamped[filepath.ToSlash(rel)] = text
 		}
 	}
 	
-	// Find file with the baseNumber
-	var fileA, fileB string
-	for _, file := range allImages {
-		fileNum := extractFileNumber(filepath.Base(file))
-		if fileNum != nil {
-			if *fileNum == baseNumber {
-				fileA = file
-			} else if *fileNum == swapNumber {
-				fileB = file
-			}
+	var missing []int
+	for number := range texts {
+		if !done[number] {
+			missing = append(missing, number)
 		}
 	}
-	
-	// If there are no matching files - stop swapping
-	if fileA == "" || fileB == "" {
-		logger.Log(fmt.Sprintf("No matching pair found for swapping in folder %s (need %d and %d)", 
-			filepath.Base(folder), baseNumber, swapNumber))
-		return nil
+	sort.Ints(missing)
+	for _, number := range missing {
+		logger.Log(fmt.Sprintf("No photo with number %d found in %s", number, filepath.Base(folder)))
 	}
 	
-	// If found - rename
-	err = swapFiles(fileA, fileB)
+	return stamped, nil
+}
+
+// performSwap performs swap operation for files in folder (exact port from Kotlin,
+// which always swapped N with N+10; plan picks the photos)
+func performSwap(folder string, orderNumber string, plan SwapPlan) ([]models.SwapOperation, error) {
+	logger := GetGlobalLogger()
+	
+	logger.Processing(fmt.Sprintf("Starting %s swap operation for order %s ...", plan.Strategy, orderNumber))
+	
+	swaps, err := applySwapPlan(folder, orderNumber, plan)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
-	logger.Log(fmt.Sprintf("Finished swap operation for folder %s", filepath.Base(folder)))
-	return nil
+	logger.Log(fmt.Sprintf("Finished swap operation for folder %s (%d swaps)", filepath.Base(folder), len(swaps)))
+	return swaps, nil
 }
 
 // swapFiles swaps two files: fileA -> temp, fileB -> fileA, temp -> fileB (exact port from Kotlin)
@@ -522,5 +703,13 @@ func ProcessJob(job *models.ProcessingJob, progress func(float32)) error {
 		job.PhotoNumber,
 		progress,
 		job.SourcePath, // Pass the original source folder name for clean naming
+		BatchOptions{
+			RobustWatermark:   job.AddRobustWatermark,
+			StructuredPayload: job.StructuredPayload,
+			TextMode:          job.TextWatermarkMode,
+			JobID:             job.ID,
+			UserID:            job.UserID,
+			Recipient:         job.OrderID,
+		},
 	)
 }
\ No newline at end of file
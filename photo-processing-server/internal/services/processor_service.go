@@ -6,6 +6,9 @@ import (
     "os"
     "path/filepath"
     "strings"
+    "sync"
+
+    "photo-processing-server/internal/models"
 )
 
 // BatchSettings maps 1:1 to the frontend BatchCopySettings
@@ -14,9 +17,22 @@ type BatchSettings struct {
     NumberOfCopies               int                    `json:"numberOfCopies"`
     BaseText                     string                 `json:"baseText"`
     AddSwapEncoding              bool                   `json:"addSwapEncoding"`
-    SwapPairs                    []map[string]string    `json:"swapPairs,omitempty"`
+    SwapPairs                    []map[string]string    `json:"swapPairs,omitempty"`    // {"a": "3", "b": "7", "order": "001"}; order is optional
+    SwapStrategy                 string                 `json:"swapStrategy,omitempty"` // SWAP_STRATEGY_*, "offset" by default
+    SwapCount                    int                    `json:"swapCount,omitempty"`    // photos in random and rotate swaps
     AddVisibleWatermark          bool                   `json:"addVisibleWatermark"`
-    WatermarkPositions           []int                  `json:"watermarkPositions,omitempty"`
+    WatermarkPositions           PhotoNumbers           `json:"watermarkPositions,omitempty"` // "1-5,12" or a list; overrides PhotoNumber
+    WatermarkTexts               map[int]string         `json:"watermarkTexts,omitempty"`     // visible text per photo number
+    AddRobustWatermark           bool                   `json:"addRobustWatermark,omitempty"`
+    StructuredPayload            bool                   `json:"structuredPayload,omitempty"`
+    Recipient                    string                 `json:"recipient,omitempty"`
+    WatermarkOwner               string                 `json:"watermarkOwner,omitempty"`
+    TextWatermarkMode            string                 `json:"textWatermarkMode,omitempty"`
+    VisibleWatermarkStyle        *VisibleWatermarkStyle `json:"visibleWatermarkStyle,omitempty"`
+    LogoWatermark                *LogoWatermark         `json:"logoWatermark,omitempty"`
+    // Set by the server for the issuance registry, never by clients
+    JobID                        string                 `json:"-"`
+    UserID                       string                 `json:"-"`
     CreateZip                    bool                   `json:"createZip"`
     WatermarkText                string                 `json:"watermarkText,omitempty"`
     PhotoNumber                  *int                   `json:"photoNumber,omitempty"`
@@ -37,17 +53,25 @@ func NewProcessor(logger *Logger) *Processor {
 }
 
 // EncryptFiles applies watermarks/encoding across supported files in the directory.
+// A non-empty owner labels the mark so it can later be removed on its own.
+// textMode selects how text files are marked (visible by default, or zero-width).
 // Progress callback receives values in [0.0, 1.0].
-func (p *Processor) EncryptFiles(selectedPath string, nameToInject string, progress func(float64)) error {
+func (p *Processor) EncryptFiles(selectedPath string, nameToInject string, owner string, textMode string, progress func(float64)) error {
     if selectedPath == "" {
         return fmt.Errorf("selectedPath is empty")
     }
     if info, err := os.Stat(selectedPath); err != nil || !info.IsDir() {
         return fmt.Errorf("selectedPath is not a directory or does not exist: %s", selectedPath)
     }
+    if strings.Contains(owner, WATERMARK_OWNER_SEPARATOR) {
+        return fmt.Errorf("watermark owner must not contain the separator character")
+    }
+    if err := CheckTextMarkMode(textMode); err != nil {
+        return err
+    }
 
     p.logger.Processing("[ENCRYPT] Scanning files...")
-    files, err := GetSupportedFiles(selectedPath)
+    files, err := GetMarkableFiles(selectedPath)
     if err != nil {
         return err
     }
@@ -59,14 +83,25 @@ func (p *Processor) EncryptFiles(selectedPath string, nameToInject string, progr
     var processed float32 = 0
 
     // Pre-compute watermark strings
-    textWatermark := AddWatermark(nameToInject) // includes markers and encoded text
-    encodedOnly := EncodeText(nameToInject)     // for binary watermark API
+    encodedOnly := EncodePayload(nameToInject) // for binary watermark API
+    // includes markers, owner label and encoded text
+    textWatermark := string(buildWatermark(ownedPayload(owner, encodedOnly)))
 
     for _, file := range files {
         switch {
         case IsVideoFile(file):
             // Add invisible binary watermark to media
-            if err := AddBinaryWatermark(file, encodedOnly); err != nil {
+            if err := AddOwnedWatermark(file, owner, encodedOnly); err != nil {
+                return err
+            }
+        case IsDocumentFile(file):
+            // Embedded in the document's metadata or markup
+            if err := AddOwnedWatermark(file, owner, encodedOnly); err != nil {
+                return err
+            }
+        case IsTextFile(file) && textMode == TEXT_MARK_ZERO_WIDTH:
+            // Hide the mark in the body as zero-width characters
+            if err := AddZeroWidthWatermark(file, owner, encodedOnly); err != nil {
                 return err
             }
         case IsTextFile(file):
@@ -77,7 +112,7 @@ func (p *Processor) EncryptFiles(selectedPath string, nameToInject string, progr
         default:
             // Images: keep consistent with batch logic — add invisible binary watermark
             if IsImageFile(file) {
-                if err := AddBinaryWatermark(file, encodedOnly); err != nil {
+                if err := AddOwnedWatermark(file, owner, encodedOnly); err != nil {
                     return err
                 }
             }
@@ -93,48 +128,88 @@ func (p *Processor) EncryptFiles(selectedPath string, nameToInject string, progr
     return nil
 }
 
-// DecryptFiles scans files and logs extracted watermarks.
-func (p *Processor) DecryptFiles(selectedPath string, progress func(float64)) error {
+// DecryptFiles scans files, logs extracted watermarks and returns them per file.
+func (p *Processor) DecryptFiles(selectedPath string, progress func(float64)) (*DecryptReport, error) {
     if selectedPath == "" {
-        return fmt.Errorf("selectedPath is empty")
+        return nil, fmt.Errorf("selectedPath is empty")
     }
     if info, err := os.Stat(selectedPath); err != nil || !info.IsDir() {
-        return fmt.Errorf("selectedPath is not a directory or does not exist: %s", selectedPath)
+        return nil, fmt.Errorf("selectedPath is not a directory or does not exist: %s", selectedPath)
     }
 
     p.logger.Processing("[DECRYPT] Scanning files...")
-    files, err := GetSupportedFiles(selectedPath)
+    files, err := GetMarkableFiles(selectedPath)
     if err != nil {
-        return err
+        return nil, err
     }
     if len(files) == 0 {
-        return fmt.Errorf("no supported files found in: %s", selectedPath)
+        return nil, fmt.Errorf("no supported files found in: %s", selectedPath)
     }
     p.logger.Log(fmt.Sprintf("[DECRYPT] Found %d supported files", len(files)))
     total := float32(len(files))
     var processed float32 = 0
 
-    foundCount := 0
+    report := &DecryptReport{
+        Folder:  filepath.Base(selectedPath),
+        Scanned: len(files),
+        Results: make([]DecryptResult, 0, len(files)),
+    }
     for _, file := range files {
-        var decoded string
+        rel, relErr := filepath.Rel(selectedPath, file)
+        if relErr != nil {
+            rel = getFileName(file)
+        }
+        rel = filepath.ToSlash(rel)
 
-        // Try binary watermark extraction first (images/videos)
-        if IsImageFile(file) || IsVideoFile(file) {
-            if encoded, err := ExtractWatermarkText(file); err == nil && encoded != "" {
-                decoded = DecodeText(encoded)
-            }
+        // Every mark of the chain, oldest first
+        marks, err := ExtractWatermarks(file)
+        if err != nil {
+            p.logger.Error(fmt.Sprintf("%s → %v", getFileName(file), err))
         }
 
-        // For text files, check appended textual watermark
-        if decoded == "" && IsTextFile(file) {
+        // Old "*/" text marks are not part of the chain format
+        if len(marks) == 0 && IsTextFile(file) {
             if content, err := ioutil.ReadFile(file); err == nil {
-                decoded = ExtractAndDecodeWatermark(string(content))
+                if payload := ExtractWatermark(string(content)); payload != "" {
+                    marks = append(marks, WatermarkMark{Location: ExtractorText, Format: "old text", Payload: payload})
+                }
             }
         }
 
-        if decoded != "" {
-            p.logger.Log(fmt.Sprintf("%s → %s", getFileName(file), decoded))
-            foundCount++
+        if len(marks) == 0 {
+            result := DecryptResult{Path: rel}
+            if err != nil {
+                result.Error = err.Error()
+            }
+            report.Results = append(report.Results, result)
+        }
+
+        for _, mark := range marks {
+            result := decryptMark(rel, mark)
+            report.Results = append(report.Results, result)
+
+            // Keyed payloads name their key, so rotated keys still decode
+            decoded := result.Text
+            if result.Fields != nil {
+                decoded = result.Fields.Describe()
+            }
+            label := string(result.Status)
+            if result.KeyID != "" && result.Fields == nil {
+                label = fmt.Sprintf("%s, key %s", result.Status, result.KeyID)
+            }
+            name := getFileName(file)
+            if len(marks) > 1 {
+                name = fmt.Sprintf("%s #%d", name, mark.Index+1)
+            }
+            if mark.Owner != "" {
+                name = fmt.Sprintf("%s (%s)", name, mark.Owner)
+            }
+            if result.Error == "" {
+                p.logger.Log(fmt.Sprintf("%s → %s [%s]", name, decoded, label))
+            } else {
+                p.logger.Error(fmt.Sprintf("%s → watermark %s", name, label))
+            }
+            report.Found++
         }
 
         processed++
@@ -143,21 +218,88 @@ func (p *Processor) DecryptFiles(selectedPath string, progress func(float64)) er
         }
     }
 
-    if foundCount == 0 {
+    if report.Found == 0 {
         p.logger.Log("[DECRYPT] Completed: no watermarks found")
     } else {
-        p.logger.Log(fmt.Sprintf("[DECRYPT] Completed: scanned %d files, found %d watermarks", len(files), foundCount))
+        p.logger.Log(fmt.Sprintf("[DECRYPT] Completed: scanned %d files, found %d watermarks", len(files), report.Found))
     }
-    return nil
+    return report, nil
+}
+
+// VerifyFiles checks every file's watermark, MAC, recorded hash and visible
+// watermark and returns the report.
+func (p *Processor) VerifyFiles(selectedPath string, progress func(float64)) (*VerificationReport, error) {
+    if selectedPath == "" {
+        return nil, fmt.Errorf("selectedPath is empty")
+    }
+    if info, err := os.Stat(selectedPath); err != nil || !info.IsDir() {
+        return nil, fmt.Errorf("selectedPath is not a directory or does not exist: %s", selectedPath)
+    }
+
+    p.logger.Processing("[VERIFY] Scanning files...")
+    report, err := VerifyFolder(selectedPath, progress)
+    if err != nil {
+        return nil, err
+    }
+    if len(report.Files) == 0 {
+        return nil, fmt.Errorf("no supported files found in: %s", selectedPath)
+    }
+
+    for _, row := range report.Files {
+        if row.Error != "" {
+            p.logger.Error(fmt.Sprintf("%s → %s", row.Path, row.Error))
+        }
+    }
+    s := report.Summary
+    p.logger.Log(fmt.Sprintf("[VERIFY] Completed: %d files, %d watermarked, %d valid MAC, %d invalid MAC, %d unchanged, %d modified, %d with visible watermark",
+        s.Total, s.Watermarked, s.ValidMAC, s.InvalidMAC, s.Matching, s.Modified, s.Visible))
+    return report, nil
+}
+
+// DecodeSwaps compares a delivered or leaked copy (folder or ZIP) with the
+// batch's source folder and reports the swapped photos and the order numbers
+// whose swaps they match.
+func (p *Processor) DecodeSwaps(sourcePath string, suspectPath string, progress func(float64)) (*SwapDecodeReport, error) {
+    if sourcePath == "" || suspectPath == "" {
+        return nil, fmt.Errorf("sourcePath and suspect are required")
+    }
+    if info, err := os.Stat(sourcePath); err != nil || !info.IsDir() {
+        return nil, fmt.Errorf("sourcePath is not a directory or does not exist: %s", sourcePath)
+    }
+    if _, err := os.Stat(suspectPath); err != nil {
+        return nil, fmt.Errorf("suspect copy does not exist: %s", suspectPath)
+    }
+
+    p.logger.Processing("[SWAP DECODE] Comparing photos with the source...")
+    report, err := DecodeSwapFingerprint(sourcePath, suspectPath, progress)
+    if err != nil {
+        return nil, err
+    }
+    for _, candidate := range report.Candidates {
+        p.logger.Log(fmt.Sprintf("[SWAP DECODE] Order %s (%s, %d moves matched, exact: %v)",
+            candidate.OrderNumber, candidate.Source, candidate.Matched, candidate.Exact))
+    }
+    return report, nil
+}
+
+// BatchResult is what a finished batch copy reports besides its files
+type BatchResult struct {
+    // Swaps holds the file swaps of each copy by order number, the copy's
+    // swap fingerprint for leak tracing
+    Swaps map[string][]models.SwapOperation `json:"swaps,omitempty"`
 }
 
 // PerformBatchCopy runs the full batch copy and encoding flow.
-func (p *Processor) PerformBatchCopy(selectedPath string, settings BatchSettings, progress func(float64)) error {
+func (p *Processor) PerformBatchCopy(selectedPath string, settings BatchSettings, progress func(float64)) (*BatchResult, error) {
     if selectedPath == "" {
-        return fmt.Errorf("selectedPath is empty")
+        return nil, fmt.Errorf("selectedPath is empty")
     }
     if info, err := os.Stat(selectedPath); err != nil || !info.IsDir() {
-        return fmt.Errorf("selectedPath is not a directory or does not exist: %s", selectedPath)
+        return nil, fmt.Errorf("selectedPath is not a directory or does not exist: %s", selectedPath)
+    }
+    swapPlan, err := NewSwapPlan(settings.SwapStrategy, settings.SwapPairs, settings.SwapCount)
+    if err != nil {
+        return nil, err
     }
 
     // Extract clean folder name (remove UUID suffix if present)
@@ -179,7 +321,9 @@ func (p *Processor) PerformBatchCopy(selectedPath string, settings BatchSettings
         photoPtr = settings.PhotoNumber
     }
 
-    return PerformBatchCopyAndEncode(
+    result := &BatchResult{Swaps: map[string][]models.SwapOperation{}}
+    var resultMutex sync.Mutex
+    err = PerformBatchCopyAndEncode(
         selectedPath,
         settings.NumberOfCopies,
         settings.BaseText,
@@ -194,7 +338,30 @@ func (p *Processor) PerformBatchCopy(selectedPath string, settings BatchSettings
             }
         },
         cleanName, // Pass clean name for ZIP files
+        BatchOptions{
+            RobustWatermark:   settings.AddRobustWatermark,
+            StructuredPayload: settings.StructuredPayload,
+            JobID:             settings.JobID,
+            UserID:            settings.UserID,
+            Recipient:         settings.Recipient,
+            Owner:             settings.WatermarkOwner,
+            TextMode:          settings.TextWatermarkMode,
+            VisibleStyle:      settings.VisibleWatermarkStyle,
+            Logo:              settings.LogoWatermark,
+            VisiblePhotos:     settings.WatermarkPositions,
+            VisibleTexts:      settings.WatermarkTexts,
+            Swap:              swapPlan,
+            OnSwap: func(orderNumber string, swaps []models.SwapOperation) {
+                resultMutex.Lock()
+                result.Swaps[orderNumber] = swaps
+                resultMutex.Unlock()
+            },
+        },
     )
+    if err != nil {
+        return nil, err
+    }
+    return result, nil
 }
 
 // isHexString checks if a string contains only hexadecimal characters
@@ -208,19 +375,29 @@ func isHexString(s string) bool {
 }
 
 // AddTextToPhoto adds a visible watermark text to a specific photo number in the folder.
-func (p *Processor) AddTextToPhoto(selectedPath string, text string, photoNumber int) error {
+// A nil style draws the original small white text.
+func (p *Processor) AddTextToPhoto(selectedPath string, text string, photoNumber int, style *VisibleWatermarkStyle) error {
     if selectedPath == "" {
         return fmt.Errorf("selectedPath is empty")
     }
-    return addVisibleWatermarkToPhoto(selectedPath, text, photoNumber)
+    if err := style.Validate(); err != nil {
+        return err
+    }
+    return addVisibleWatermarkToPhoto(selectedPath, text, photoNumber, style)
 }
 
 // RemoveWatermarks removes invisible watermarks from supported media files.
-func (p *Processor) RemoveWatermarks(selectedPath string, progress func(float64)) error {
+// The selector limits removal to some marks of each chain (by index, owner,
+// decoded text or key ID); the zero value removes every mark. options can redirect the cleaned files
+// to a separate folder or ZIP, or make it a dry run.
+func (p *Processor) RemoveWatermarks(selectedPath string, selector WatermarkSelector, options RemovalOptions, progress func(float64)) (*RemovalReport, error) {
     if selectedPath == "" {
-        return fmt.Errorf("selectedPath is empty")
+        return nil, fmt.Errorf("selectedPath is empty")
+    }
+    if info, err := os.Stat(selectedPath); err != nil || !info.IsDir() {
+        return nil, fmt.Errorf("selectedPath is not a directory or does not exist: %s", selectedPath)
     }
-    return RemoveWatermarks(selectedPath, func(pf float32) {
+    return CleanWatermarks(selectedPath, selector, options, func(pf float32) {
         if progress != nil {
             progress(float64(pf))
         }
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"photo-processing-server/internal/models"
+)
+
+func TestSwapStampedPaths(t *testing.T) {
+	stamped := map[string]string{"a_3.jpg": "003", "b_5.jpg": "005"}
+	tests := []struct {
+		name  string
+		swaps []models.SwapOperation
+		want  map[string]string
+	}{
+		{"no swaps", nil, map[string]string{"a_3.jpg": "003", "b_5.jpg": "005"}},
+		{"stamped with unstamped", []models.SwapOperation{{FileA: "a_3.jpg", FileB: "c_13.jpg"}},
+			map[string]string{"c_13.jpg": "003", "b_5.jpg": "005"}},
+		{"two stamped", []models.SwapOperation{{FileA: "b_5.jpg", FileB: "a_3.jpg"}},
+			map[string]string{"a_3.jpg": "005", "b_5.jpg": "003"}},
+		{"in order", []models.SwapOperation{{FileA: "a_3.jpg", FileB: "c_13.jpg"}, {FileA: "c_13.jpg", FileB: "d_23.jpg"}},
+			map[string]string{"d_23.jpg": "003", "b_5.jpg": "005"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := swapStampedPaths(stamped, tt.swaps); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stamped %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if stamped["a_3.jpg"] != "003" || len(stamped) != 2 {
+		t.Error("input map was modified")
+	}
+}
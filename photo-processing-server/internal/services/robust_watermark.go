@@ -0,0 +1,469 @@
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// Robust (pixel-domain) watermark parameters.
+//
+// The luminance plane is normalized so its shorter side is ROBUST_REFERENCE_SIZE,
+// split into 8x8 DCT blocks, and each block carries one bit as the sign of
+// C(2,1) - C(1,2). Blocks are grouped into 8x8 tiles that each repeat the full
+// 64-bit code word (32-bit order ID + CRC-32), so a crop keeps whole tiles and
+// JPEG noise is averaged out by voting. The embedded difference is
+// scaled back to the original resolution, which keeps the mark low-frequency
+// enough to survive recompression and moderate resizing.
+const (
+	ROBUST_REFERENCE_SIZE = 512
+	ROBUST_MIN_IMAGE_SIZE = 256
+	ROBUST_STRENGTH       = 24.0 // target |C(2,1) - C(1,2)| per block
+	ROBUST_JPEG_QUALITY   = 95
+	robustBlockSize       = 8
+	robustTileBlocks      = 8
+	robustPayloadBits     = 32
+	robustCodeBits        = 64
+	robustMinScore        = 0.25
+)
+
+// Crop factors tried during detection: a crop shrinks the shorter side, which
+// changes the normalization scale relative to the embedding grid
+var robustCropFactors = []float64{1.0, 0.95, 0.9, 0.85, 0.8, 0.75, 0.7}
+
+// ErrRobustImageTooSmall is returned for images below ROBUST_MIN_IMAGE_SIZE
+var ErrRobustImageTooSmall = errors.New("image is too small for a robust watermark")
+
+var (
+	robustBasisDiff [robustBlockSize * robustBlockSize]float64
+	robustPN        [robustTileBlocks * robustTileBlocks]bool
+)
+
+func init() {
+	// Orthonormal DCT-II basis difference for coefficients (2,1) and (1,2)
+	alpha := func(u int) float64 {
+		if u == 0 {
+			return math.Sqrt(1.0 / robustBlockSize)
+		}
+		return math.Sqrt(2.0 / robustBlockSize)
+	}
+	basis := func(u, v, x, y int) float64 {
+		return alpha(u) * alpha(v) *
+			math.Cos(float64(2*x+1)*float64(u)*math.Pi/16) *
+			math.Cos(float64(2*y+1)*float64(v)*math.Pi/16)
+	}
+	for y := 0; y < robustBlockSize; y++ {
+		for x := 0; x < robustBlockSize; x++ {
+			robustBasisDiff[y*robustBlockSize+x] = basis(2, 1, x, y) - basis(1, 2, x, y)
+		}
+	}
+
+	// Fixed pseudo-noise sequence whitening the code word across a tile
+	state := uint32(0x5EED1234)
+	for i := range robustPN {
+		state = state*1664525 + 1013904223
+		robustPN[i] = state&0x80000000 != 0
+	}
+}
+
+// lumaPlane is a float luminance image
+type lumaPlane struct {
+	width  int
+	height int
+	pix    []float64
+}
+
+// robustCheck returns the CRC-32 of the big-endian order ID
+func robustCheck(orderID uint32) uint32 {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, orderID)
+	return crc32.ChecksumIEEE(payload)
+}
+
+// robustCodeWord builds the 64-bit code word for an order ID: 32 payload
+// bits followed by their CRC-32
+func robustCodeWord(orderID uint32) []bool {
+	check := robustCheck(orderID)
+	checkBits := robustCodeBits - robustPayloadBits
+
+	bits := make([]bool, robustCodeBits)
+	for i := 0; i < robustPayloadBits; i++ {
+		bits[i] = orderID&(1<<(31-i)) != 0
+	}
+	for i := 0; i < checkBits; i++ {
+		bits[robustPayloadBits+i] = check&(1<<(checkBits-1-i)) != 0
+	}
+	return bits
+}
+
+// parseRobustCodeWord validates the CRC-32 of a 64-bit code word and returns
+// the order ID
+func parseRobustCodeWord(bits []bool) (uint32, bool) {
+	if len(bits) != robustCodeBits {
+		return 0, false
+	}
+	checkBits := robustCodeBits - robustPayloadBits
+	var orderID, check uint32
+	for i := 0; i < robustPayloadBits; i++ {
+		if bits[i] {
+			orderID |= 1 << (31 - i)
+		}
+	}
+	for i := 0; i < checkBits; i++ {
+		if bits[robustPayloadBits+i] {
+			check |= 1 << (checkBits - 1 - i)
+		}
+	}
+	return orderID, robustCheck(orderID) == check
+}
+
+// robustSlotBit returns the code bit index and whitening for a tile slot
+func robustSlotBit(slot int) (int, bool) {
+	return slot % robustCodeBits, robustPN[slot]
+}
+
+// blockDiff computes C(2,1) - C(1,2) for the block at (x0, y0)
+func (p lumaPlane) blockDiff(x0, y0 int) float64 {
+	sum := 0.0
+	for y := 0; y < robustBlockSize; y++ {
+		row := p.pix[(y0+y)*p.width+x0:]
+		for x := 0; x < robustBlockSize; x++ {
+			sum += row[x] * robustBasisDiff[y*robustBlockSize+x]
+		}
+	}
+	return sum
+}
+
+// embedRobustBits writes the code word into every block of a normalized plane
+func embedRobustBits(plane lumaPlane, bits []bool, strength float64) {
+	blocksX := plane.width / robustBlockSize
+	blocksY := plane.height / robustBlockSize
+	// Basis difference has squared norm 2, so adding k*B moves the diff by 2k
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			slot := (by%robustTileBlocks)*robustTileBlocks + bx%robustTileBlocks
+			bitIndex, flip := robustSlotBit(slot)
+			target := strength
+			if bits[bitIndex] == flip {
+				target = -strength
+			}
+
+			x0, y0 := bx*robustBlockSize, by*robustBlockSize
+			diff := plane.blockDiff(x0, y0)
+			if (target > 0 && diff >= target) || (target < 0 && diff <= target) {
+				continue
+			}
+			k := (target - diff) / 2
+			for y := 0; y < robustBlockSize; y++ {
+				row := plane.pix[(y0+y)*plane.width+x0:]
+				for x := 0; x < robustBlockSize; x++ {
+					row[x] += k * robustBasisDiff[y*robustBlockSize+x]
+				}
+			}
+		}
+	}
+}
+
+// robustCandidate is a decoded code word at one grid alignment
+type robustCandidate struct {
+	bits  []bool
+	score float64
+}
+
+// detectRobustBits searches all block and tile alignments of a normalized
+// plane and returns the decoded code words ordered by confidence
+func detectRobustBits(plane lumaPlane, strength float64) []robustCandidate {
+	var candidates []robustCandidate
+	tileSlots := robustTileBlocks * robustTileBlocks
+
+	for dy := 0; dy < robustBlockSize; dy++ {
+		for dx := 0; dx < robustBlockSize; dx++ {
+			blocksX := (plane.width - dx) / robustBlockSize
+			blocksY := (plane.height - dy) / robustBlockSize
+			if blocksX < robustTileBlocks || blocksY < robustTileBlocks {
+				continue
+			}
+
+			// Accumulate clipped block votes per position within a tile
+			var slotSum [robustTileBlocks * robustTileBlocks]float64
+			var slotCount [robustTileBlocks * robustTileBlocks]int
+			for by := 0; by < blocksY; by++ {
+				for bx := 0; bx < blocksX; bx++ {
+					diff := plane.blockDiff(dx+bx*robustBlockSize, dy+by*robustBlockSize)
+					diff = math.Max(-2*strength, math.Min(2*strength, diff))
+					slot := (by%robustTileBlocks)*robustTileBlocks + bx%robustTileBlocks
+					slotSum[slot] += diff
+					slotCount[slot]++
+				}
+			}
+
+			// Try every tile origin: it only permutes slots
+			for ty := 0; ty < robustTileBlocks; ty++ {
+				for tx := 0; tx < robustTileBlocks; tx++ {
+					votes := make([]float64, robustCodeBits)
+					total := 0
+					for s := 0; s < tileSlots; s++ {
+						sy, sx := s/robustTileBlocks, s%robustTileBlocks
+						slot := ((sy+ty)%robustTileBlocks)*robustTileBlocks + (sx+tx)%robustTileBlocks
+						bitIndex, flip := robustSlotBit(slot)
+						v := slotSum[s]
+						if flip {
+							v = -v
+						}
+						votes[bitIndex] += v
+						total += slotCount[s]
+					}
+
+					bits := make([]bool, robustCodeBits)
+					agreement := 0.0
+					for i, v := range votes {
+						bits[i] = v > 0
+						agreement += math.Abs(v)
+					}
+					score := agreement / (float64(total) * strength)
+					candidates = append(candidates, robustCandidate{bits: bits, score: score})
+				}
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	return candidates
+}
+
+// robustNormalizedSize scales (width, height) so the shorter side is
+// ROBUST_REFERENCE_SIZE * factor
+func robustNormalizedSize(width, height int, factor float64) image.Point {
+	short := math.Min(float64(width), float64(height))
+	scale := ROBUST_REFERENCE_SIZE * factor / short
+	return image.Pt(int(math.Round(float64(width)*scale)), int(math.Round(float64(height)*scale)))
+}
+
+// matToPlane converts a single-channel 8-bit Mat to a luma plane
+func matToPlane(mat gocv.Mat) lumaPlane {
+	data := mat.ToBytes()
+	plane := lumaPlane{width: mat.Cols(), height: mat.Rows(), pix: make([]float64, len(data))}
+	for i, v := range data {
+		plane.pix[i] = float64(v)
+	}
+	return plane
+}
+
+// readLuminance loads an image and returns its Y channel plus the YCrCb planes
+func readLuminance(imagePath string) (gocv.Mat, []gocv.Mat, error) {
+	if err := initializeOpenCV(); err != nil {
+		return gocv.Mat{}, nil, err
+	}
+	img := gocv.IMRead(imagePath, gocv.IMReadColor)
+	if img.Empty() {
+		return gocv.Mat{}, nil, fmt.Errorf("failed to load image: %s", filepath.Base(imagePath))
+	}
+	defer img.Close()
+
+	ycrcb := gocv.NewMat()
+	defer ycrcb.Close()
+	gocv.CvtColor(img, &ycrcb, gocv.ColorBGRToYCrCb)
+	channels := gocv.Split(ycrcb)
+	return channels[0], channels, nil
+}
+
+// closeMats releases a list of Mats
+func closeMats(mats []gocv.Mat) {
+	for i := range mats {
+		mats[i].Close()
+	}
+}
+
+// EmbedRobustWatermark embeds orderID into the image luminance so it can be
+// recovered after recompression, resizing and cropping
+func EmbedRobustWatermark(imagePath string, orderID uint32) error {
+	logger := GetGlobalLogger()
+
+	luma, channels, err := readLuminance(imagePath)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+	defer closeMats(channels)
+
+	width, height := luma.Cols(), luma.Rows()
+	if width < ROBUST_MIN_IMAGE_SIZE || height < ROBUST_MIN_IMAGE_SIZE {
+		return ErrRobustImageTooSmall
+	}
+
+	// Embed on the normalized plane
+	size := robustNormalizedSize(width, height, 1.0)
+	small := gocv.NewMat()
+	defer small.Close()
+	gocv.Resize(luma, &small, size, 0, 0, gocv.InterpolationArea)
+
+	plane := matToPlane(small)
+	marked := lumaPlane{width: plane.width, height: plane.height, pix: append([]float64{}, plane.pix...)}
+	embedRobustBits(marked, robustCodeWord(orderID), ROBUST_STRENGTH)
+
+	// Scale the difference back up and add it to the full-resolution luminance
+	delta := gocv.NewMatWithSize(plane.height, plane.width, gocv.MatTypeCV32F)
+	defer delta.Close()
+	for y := 0; y < plane.height; y++ {
+		for x := 0; x < plane.width; x++ {
+			i := y*plane.width + x
+			delta.SetFloatAt(y, x, float32(marked.pix[i]-plane.pix[i]))
+		}
+	}
+	fullDelta := gocv.NewMat()
+	defer fullDelta.Close()
+	gocv.Resize(delta, &fullDelta, image.Pt(width, height), 0, 0, gocv.InterpolationLinear)
+
+	lumaF := gocv.NewMat()
+	defer lumaF.Close()
+	luma.ConvertTo(&lumaF, gocv.MatTypeCV32F)
+	gocv.Add(lumaF, fullDelta, &lumaF)
+	lumaF.ConvertTo(&channels[0], gocv.MatTypeCV8U)
+
+	ycrcb := gocv.NewMat()
+	defer ycrcb.Close()
+	gocv.Merge(channels, &ycrcb)
+	out := gocv.NewMat()
+	defer out.Close()
+	gocv.CvtColor(ycrcb, &out, gocv.ColorYCrCbToBGR)
+
+	var params []int
+	ext := strings.ToLower(filepath.Ext(imagePath))
+	if ext == ".jpg" || ext == ".jpeg" {
+		params = []int{int(gocv.IMWriteJpegQuality), ROBUST_JPEG_QUALITY}
+	}
+	if !gocv.IMWriteWithParams(imagePath, out, params) {
+		errMsg := fmt.Sprintf("Failed to save image %s", filepath.Base(imagePath))
+		logger.Error(errMsg)
+		return errors.New(errMsg)
+	}
+
+	logger.Log(fmt.Sprintf("Added robust watermark to %s", filepath.Base(imagePath)))
+	return nil
+}
+
+// DetectRobustWatermark searches the image for a robust watermark and returns
+// the embedded order ID with a confidence score
+func DetectRobustWatermark(imagePath string) (uint32, float64, bool, error) {
+	luma, channels, err := readLuminance(imagePath)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer closeMats(channels)
+
+	width, height := luma.Cols(), luma.Rows()
+	planes := make([]lumaPlane, 0, len(robustCropFactors))
+	for _, factor := range robustCropFactors {
+		size := robustNormalizedSize(width, height, factor)
+		small := gocv.NewMat()
+		gocv.Resize(luma, &small, size, 0, 0, gocv.InterpolationArea)
+		planes = append(planes, matToPlane(small))
+		small.Close()
+	}
+	orderID, score, found := detectRobustPlanes(planes, ROBUST_STRENGTH)
+	return orderID, score, found, nil
+}
+
+// detectRobustPlanes decodes the planes normalized at each crop factor and
+// accepts the first candidate whose CRC-32 checks out
+func detectRobustPlanes(planes []lumaPlane, strength float64) (uint32, float64, bool) {
+	bestScore := 0.0
+	for _, plane := range planes {
+		candidates := detectRobustBits(plane, strength)
+		if len(candidates) > 0 && candidates[0].score > bestScore {
+			bestScore = candidates[0].score
+		}
+		for _, candidate := range candidates {
+			if candidate.score < robustMinScore {
+				break
+			}
+			if orderID, ok := parseRobustCodeWord(candidate.bits); ok {
+				return orderID, candidate.score, true
+			}
+		}
+	}
+	return 0, bestScore, false
+}
+
+// TestRobustWatermark embeds a robust watermark on a copy of a test image and
+// detects it as embedded and after JPEG q70 recompression, downscaling and cropping
+func TestRobustWatermark(testFilePath string) {
+	logger := GetGlobalLogger()
+	logger.Log("Testing robust watermark...")
+
+	testCopy := filepath.Join(os.TempDir(), "robust_"+filepath.Base(testFilePath))
+	info, err := os.Stat(testFilePath)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to stat test file: %v", err))
+		return
+	}
+	if err := copyFile(testFilePath, testCopy, info.Mode()); err != nil {
+		logger.Error(fmt.Sprintf("Failed to copy test file: %v", err))
+		return
+	}
+	defer os.Remove(testCopy)
+
+	const orderID = 42
+	if err := EmbedRobustWatermark(testCopy, orderID); err != nil {
+		logger.Error(fmt.Sprintf("Failed to embed robust watermark: %v", err))
+		return
+	}
+
+	attacked := filepath.Join(os.TempDir(), "robust_attacked_"+strings.TrimSuffix(filepath.Base(testFilePath), filepath.Ext(testFilePath))+".jpg")
+	if err := attackRobustTestImage(testCopy, attacked); err != nil {
+		logger.Error(fmt.Sprintf("Failed to recompress test image: %v", err))
+		return
+	}
+	defer os.Remove(attacked)
+
+	for _, check := range []struct{ name, path string }{
+		{"as embedded", testCopy},
+		{"after q70, 75% scale and 85% crop", attacked},
+	} {
+		detected, score, found, err := DetectRobustWatermark(check.path)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to detect robust watermark %s: %v", check.name, err))
+			continue
+		}
+		if found && detected == orderID {
+			logger.Log(fmt.Sprintf("✓ Robust watermark detected %s: %d (score %.2f)", check.name, detected, score))
+		} else {
+			logger.Error(fmt.Sprintf("✗ Robust watermark not detected %s (score %.2f)", check.name, score))
+		}
+	}
+}
+
+// attackRobustTestImage downscales an image to 75%, crops the centre 85% and
+// saves it as a quality 70 JPEG
+func attackRobustTestImage(source string, target string) error {
+	img := gocv.IMRead(source, gocv.IMReadColor)
+	if img.Empty() {
+		return fmt.Errorf("failed to load image: %s", filepath.Base(source))
+	}
+	defer img.Close()
+
+	scaled := gocv.NewMat()
+	defer scaled.Close()
+	gocv.Resize(img, &scaled, image.Pt(img.Cols()*3/4, img.Rows()*3/4), 0, 0, gocv.InterpolationArea)
+
+	width, height := scaled.Cols()*85/100, scaled.Rows()*85/100
+	x0, y0 := (scaled.Cols()-width)/2, (scaled.Rows()-height)/2
+	cropped := scaled.Region(image.Rect(x0, y0, x0+width, y0+height))
+	defer cropped.Close()
+
+	if !gocv.IMWriteWithParams(target, cropped, []int{int(gocv.IMWriteJpegQuality), 70}) {
+		return fmt.Errorf("failed to save %s", filepath.Base(target))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// texturedPlane builds a photo-like plane: smooth gradients plus fine noise
+func texturedPlane(width, height int, seed int64) lumaPlane {
+	random := rand.New(rand.NewSource(seed))
+	fx, fy := 0.01+random.Float64()*0.03, 0.01+random.Float64()*0.03
+	plane := lumaPlane{width: width, height: height, pix: make([]float64, width*height)}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := 128 + 60*math.Sin(float64(x)*fx)*math.Cos(float64(y)*fy) + random.NormFloat64()*12
+			plane.pix[y*width+x] = math.Max(0, math.Min(255, v))
+		}
+	}
+	return plane
+}
+
+// recompress round-trips a plane through 8-bit JPEG at quality
+func recompress(t *testing.T, plane lumaPlane, quality int) lumaPlane {
+	t.Helper()
+	gray := image.NewGray(image.Rect(0, 0, plane.width, plane.height))
+	for i, v := range plane.pix {
+		gray.Pix[i] = uint8(math.Max(0, math.Min(255, math.Round(v))))
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, gray, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := lumaPlane{width: plane.width, height: plane.height, pix: make([]float64, len(plane.pix))}
+	for y := 0; y < plane.height; y++ {
+		for x := 0; x < plane.width; x++ {
+			r, _, _, _ := decoded.At(x, y).RGBA()
+			out.pix[y*plane.width+x] = float64(r >> 8)
+		}
+	}
+	return out
+}
+
+// resizePlane scales a plane bilinearly
+func resizePlane(plane lumaPlane, width, height int) lumaPlane {
+	out := lumaPlane{width: width, height: height, pix: make([]float64, width*height)}
+	sx, sy := float64(plane.width)/float64(width), float64(plane.height)/float64(height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fx := math.Max(0, (float64(x)+0.5)*sx-0.5)
+			fy := math.Max(0, (float64(y)+0.5)*sy-0.5)
+			x0, y0 := int(fx), int(fy)
+			x1, y1 := min(x0+1, plane.width-1), min(y0+1, plane.height-1)
+			ax, ay := fx-float64(x0), fy-float64(y0)
+			top := plane.pix[y0*plane.width+x0]*(1-ax) + plane.pix[y0*plane.width+x1]*ax
+			bottom := plane.pix[y1*plane.width+x0]*(1-ax) + plane.pix[y1*plane.width+x1]*ax
+			out.pix[y*width+x] = top*(1-ay) + bottom*ay
+		}
+	}
+	return out
+}
+
+// cropPlane keeps the centre fraction of a plane
+func cropPlane(plane lumaPlane, fraction float64) lumaPlane {
+	width := int(float64(plane.width) * fraction)
+	height := int(float64(plane.height) * fraction)
+	x0, y0 := (plane.width-width)/2, (plane.height-height)/2
+	out := lumaPlane{width: width, height: height, pix: make([]float64, width*height)}
+	for y := 0; y < height; y++ {
+		copy(out.pix[y*width:(y+1)*width], plane.pix[(y0+y)*plane.width+x0:])
+	}
+	return out
+}
+
+// normalizedPlanes mirrors DetectRobustWatermark on an attacked plane
+func normalizedPlanes(plane lumaPlane) []lumaPlane {
+	var planes []lumaPlane
+	for _, factor := range robustCropFactors {
+		size := robustNormalizedSize(plane.width, plane.height, factor)
+		planes = append(planes, resizePlane(plane, size.X, size.Y))
+	}
+	return planes
+}
+
+func TestRobustCodeWordRoundTrip(t *testing.T) {
+	for _, orderID := range []uint32{0, 1, 42, 999, 0xFFFFFFFF} {
+		bits := robustCodeWord(orderID)
+		if len(bits) != robustCodeBits {
+			t.Fatalf("code word length %d, want %d", len(bits), robustCodeBits)
+		}
+		got, ok := parseRobustCodeWord(bits)
+		if !ok || got != orderID {
+			t.Errorf("parse(%d) = %d, %v", orderID, got, ok)
+		}
+		bits[robustCodeBits-1] = !bits[robustCodeBits-1]
+		if _, ok := parseRobustCodeWord(bits); ok {
+			t.Errorf("order %d: flipped check bit accepted", orderID)
+		}
+	}
+	for _, length := range []int{robustPayloadBits, 48} {
+		if _, ok := parseRobustCodeWord(robustCodeWord(42)[:length]); ok {
+			t.Errorf("%d-bit code word accepted", length)
+		}
+	}
+}
+
+func TestRobustWatermarkSurvivesAttacks(t *testing.T) {
+	const orderID = 4242
+	tests := []struct {
+		name   string
+		attack func(lumaPlane) lumaPlane
+	}{
+		{"none", func(p lumaPlane) lumaPlane { return p }},
+		{"jpeg q70", func(p lumaPlane) lumaPlane { return recompress(t, p, 70) }},
+		{"downscale 75%", func(p lumaPlane) lumaPlane {
+			return recompress(t, resizePlane(p, p.width*3/4, p.height*3/4), 70)
+		}},
+		{"crop 85%", func(p lumaPlane) lumaPlane { return recompress(t, cropPlane(p, 0.85), 70) }},
+		{"downscale and crop", func(p lumaPlane) lumaPlane {
+			return recompress(t, cropPlane(resizePlane(p, p.width*3/4, p.height*3/4), 0.85), 70)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size := robustNormalizedSize(768, 1024, 1.0)
+			plane := texturedPlane(size.X, size.Y, 7)
+			embedRobustBits(plane, robustCodeWord(orderID), ROBUST_STRENGTH)
+
+			got, score, found := detectRobustPlanes(normalizedPlanes(tt.attack(plane)), ROBUST_STRENGTH)
+			if !found || got != orderID {
+				t.Fatalf("detected %d (found %v, score %.2f), want %d", got, found, score, orderID)
+			}
+		})
+	}
+}
+
+func TestRobustWatermarkUnmarkedPlanes(t *testing.T) {
+	for seed := int64(1); seed <= 4; seed++ {
+		size := robustNormalizedSize(768, 1024, 1.0)
+		plane := recompress(t, texturedPlane(size.X, size.Y, seed), 70)
+		if got, score, found := detectRobustPlanes(normalizedPlanes(plane), ROBUST_STRENGTH); found {
+			t.Errorf("seed %d: unmarked plane attributed to order %d (score %.2f)", seed, got, score)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WatermarkPayload is a structured mark. It is serialized as compact JSON
+// (single-letter keys) and then encoded like any other text, keyed or
+// Caesar, so it fits every container and trailer format.
+type WatermarkPayload struct {
+	OrderID     string    `json:"orderId"`
+	CopyIndex   int       `json:"copyIndex,omitempty"`
+	RecipientID string    `json:"recipientId,omitempty"`
+	IssuedAt    time.Time `json:"issuedAt"`
+	Issuer      string    `json:"issuer,omitempty"`
+	KeyID       string    `json:"keyId,omitempty"`    // taken from the keyed payload header
+	BaseText    string    `json:"baseText,omitempty"` // batch base text, keeps flat-text matching working
+}
+
+// structuredWire is the embedded form of WatermarkPayload
+type structuredWire struct {
+	OrderID     string `json:"o"`
+	CopyIndex   int    `json:"c,omitempty"`
+	RecipientID string `json:"r,omitempty"`
+	IssuedAt    int64  `json:"t,omitempty"` // Unix seconds
+	Issuer      string `json:"i,omitempty"`
+	BaseText    string `json:"b,omitempty"`
+}
+
+// EncodeStructuredPayload serializes and encodes payload for embedding
+func EncodeStructuredPayload(payload WatermarkPayload) (string, error) {
+	if payload.OrderID == "" {
+		return "", fmt.Errorf("structured watermark needs an order ID")
+	}
+	wire := structuredWire{
+		OrderID:     payload.OrderID,
+		CopyIndex:   payload.CopyIndex,
+		RecipientID: payload.RecipientID,
+		Issuer:      payload.Issuer,
+		BaseText:    payload.BaseText,
+	}
+	if !payload.IssuedAt.IsZero() {
+		wire.IssuedAt = payload.IssuedAt.Unix()
+	}
+	data, err := json.Marshal(wire)
+	if err != nil {
+		return "", err
+	}
+	return EncodePayload(string(data)), nil
+}
+
+// ParseStructuredText parses decoded mark text; flat text is not structured
+func ParseStructuredText(text string) (*WatermarkPayload, bool) {
+	if !strings.HasPrefix(text, "{") {
+		return nil, false
+	}
+	var wire structuredWire
+	if err := json.Unmarshal([]byte(text), &wire); err != nil || wire.OrderID == "" {
+		return nil, false
+	}
+	payload := &WatermarkPayload{
+		OrderID:     wire.OrderID,
+		CopyIndex:   wire.CopyIndex,
+		RecipientID: wire.RecipientID,
+		Issuer:      wire.Issuer,
+		BaseText:    wire.BaseText,
+	}
+	if wire.IssuedAt != 0 {
+		payload.IssuedAt = time.Unix(wire.IssuedAt, 0).UTC()
+	}
+	return payload, true
+}
+
+// DecodeStructuredPayload decodes an embedded payload. The structured
+// fields are nil for flat-text marks and for marks that fail to decode.
+func DecodeStructuredPayload(payload string) (*WatermarkPayload, string, WatermarkStatus) {
+	text, status := DecodePayload(payload)
+	if status != WatermarkValid && status != WatermarkLegacy {
+		return nil, text, status
+	}
+	fields, ok := ParseStructuredText(text)
+	if !ok {
+		return nil, text, status
+	}
+	fields.KeyID = PayloadKeyID(payload)
+	return fields, text, status
+}
+
+// Text renders the payload as the flat "<baseText> <orderNumber>" form
+func (p *WatermarkPayload) Text() string {
+	return strings.TrimSpace(p.BaseText + " " + p.OrderID)
+}
+
+// Describe lists the populated fields for log output
+func (p *WatermarkPayload) Describe() string {
+	parts := []string{"order " + p.OrderID}
+	if p.CopyIndex > 0 {
+		parts = append(parts, fmt.Sprintf("copy %d", p.CopyIndex))
+	}
+	if p.RecipientID != "" {
+		parts = append(parts, "recipient "+p.RecipientID)
+	}
+	if !p.IssuedAt.IsZero() {
+		parts = append(parts, "issued "+p.IssuedAt.Format(time.RFC3339))
+	}
+	if p.Issuer != "" {
+		parts = append(parts, "issuer "+p.Issuer)
+	}
+	if p.KeyID != "" {
+		parts = append(parts, "key "+p.KeyID)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// AddStructuredWatermark encodes payload and appends it to the file's chain
+func AddStructuredWatermark(filePath string, owner string, payload WatermarkPayload) error {
+	encoded, err := EncodeStructuredPayload(payload)
+	if err != nil {
+		return err
+	}
+	return AddOwnedWatermark(filePath, owner, encoded)
+}
+
+// ExtractWatermarkPayload decodes the newest mark of the file. The payload
+// is nil when the file has no mark or the mark is flat text.
+func ExtractWatermarkPayload(filePath string) (*WatermarkPayload, WatermarkStatus, error) {
+	encoded, err := ExtractWatermarkText(filePath)
+	if err != nil || encoded == "" {
+		return nil, "", err
+	}
+	fields, _, status := DecodeStructuredPayload(encoded)
+	return fields, status, nil
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStructuredPayloadRoundTrip(t *testing.T) {
+	payload := WatermarkPayload{
+		OrderID:     "042",
+		CopyIndex:   3,
+		RecipientID: "client-7",
+		IssuedAt:    time.Date(2026, 5, 1, 12, 30, 0, 0, time.UTC),
+		Issuer:      "studio",
+		BaseText:    "Project Alpha",
+	}
+	tests := []struct {
+		name       string
+		secret     string
+		wantStatus WatermarkStatus
+		wantKeyID  string
+	}{
+		{"legacy", "", WatermarkLegacy, ""},
+		{"keyed", "test-secret", WatermarkValid, DEFAULT_KEY_ID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useWatermarkSecret(t, tt.secret)
+			encoded, err := EncodeStructuredPayload(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields, text, status := DecodeStructuredPayload(encoded)
+			if status != tt.wantStatus || fields == nil {
+				t.Fatalf("decoded %v (%s) from %q", fields, status, text)
+			}
+			want := payload
+			want.KeyID = tt.wantKeyID
+			if !reflect.DeepEqual(*fields, want) {
+				t.Errorf("fields %+v, want %+v", *fields, want)
+			}
+			if fields.Text() != "Project Alpha 042" {
+				t.Errorf("flat text %q", fields.Text())
+			}
+		})
+	}
+
+	if _, err := EncodeStructuredPayload(WatermarkPayload{BaseText: "x"}); err == nil {
+		t.Error("payload without an order ID was encoded")
+	}
+}
+
+func TestParseStructuredTextMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"flat text", "Project Alpha 042"},
+		{"empty", ""},
+		{"not JSON", "{order 042}"},
+		{"truncated", `{"o":"042","c":3`},
+		{"no order", `{"c":3,"b":"x"}`},
+		{"empty order", `{"o":""}`},
+		{"wrong type", `{"o":"042","c":"three"}`},
+		{"time overflow", `{"o":"042","t":1e30}`},
+		{"array", `[{"o":"042"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if fields, ok := ParseStructuredText(tt.text); ok || fields != nil {
+				t.Errorf("parsed %+v", fields)
+			}
+		})
+	}
+}
+
+func TestDecodeStructuredPayloadRejectsTampered(t *testing.T) {
+	useWatermarkSecret(t, "test-secret")
+	encoded, err := EncodeStructuredPayload(WatermarkPayload{OrderID: "042"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := encoded[:len(encoded)-2] + "AA"
+	if encoded == tampered {
+		tampered = encoded[:len(encoded)-2] + "BB"
+	}
+	if fields, _, status := DecodeStructuredPayload(tampered); fields != nil || status != WatermarkTampered {
+		t.Errorf("decoded %+v (%s) from a tampered payload", fields, status)
+	}
+}
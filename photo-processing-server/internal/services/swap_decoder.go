@@ -0,0 +1,406 @@
+package services
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"photo-processing-server/internal/models"
+)
+
+// Swap decoder limits
+const (
+	// MAX_SWAP_SEARCH_ORDER is the highest order number tried when the registry
+	// has no record of the source folder and the strategy has to be guessed
+	MAX_SWAP_SEARCH_ORDER = 9999
+	// Suspect ZIPs are uploads: cap their entries and extracted bytes
+	MAX_SWAP_ZIP_ENTRIES = 10000
+	MAX_SWAP_ZIP_SIZE    = 4 << 30
+)
+
+// SwapMove is a suspect photo showing the content of another source photo
+type SwapMove struct {
+	Path        string `json:"path"`        // relative to the suspect folder or ZIP
+	Number      int    `json:"number"`      // photo number in the file name
+	ContentFrom int    `json:"contentFrom"` // number of the source photo it shows
+	Distance    int    `json:"distance"`    // pHash distance to that source photo
+}
+
+// SwapCandidate is an order number whose swaps explain the observed moves
+type SwapCandidate struct {
+	OrderNumber string `json:"orderNumber"`
+	Source      string `json:"source"` // "registry", or "search" when inferred from the strategy alone
+	Strategy    string `json:"strategy,omitempty"`
+	RecordID    string `json:"recordId,omitempty"`
+	JobID       string `json:"jobId,omitempty"`
+	Recipient   string `json:"recipient,omitempty"`
+	// Matched counts moves the candidate predicts; Exact means it predicts
+	// every observed move and nothing else
+	Matched int  `json:"matched"`
+	Exact   bool `json:"exact"`
+}
+
+// SwapDecodeReport is the result of comparing a suspect copy with its source
+type SwapDecodeReport struct {
+	SourceFolder string                 `json:"sourceFolder"`
+	Suspect      string                 `json:"suspect"`
+	GeneratedAt  time.Time              `json:"generatedAt"`
+	Compared     int                    `json:"compared"`            // suspect photos matched to a source photo
+	Unmatched    []string               `json:"unmatched,omitempty"` // suspect photos like no source photo
+	Moves        []SwapMove             `json:"moves"`
+	Swaps        []models.SwapOperation `json:"swaps"` // moves that are plain exchanges of two photos
+	Candidates   []SwapCandidate        `json:"candidates"`
+	Warnings     []string               `json:"warnings,omitempty"` // why candidates may be missing or uncertain
+}
+
+// DecodeSwapFingerprint compares the photos of a suspect folder or ZIP with
+// the source folder of a batch by perceptual hash, reports which photos were
+// swapped and which order numbers' swaps explain that
+func DecodeSwapFingerprint(sourceFolder string, suspectPath string, progress func(float64)) (*SwapDecodeReport, error) {
+	logger := GetGlobalLogger()
+
+	suspectFolder := suspectPath
+	if strings.EqualFold(filepath.Ext(suspectPath), ".zip") {
+		dir, err := extractZipImages(suspectPath)
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		suspectFolder = dir
+	}
+
+	sourceImages, sourceNumbers, err := imagesByNumber(sourceFolder)
+	if err != nil {
+		return nil, err
+	}
+	suspectImages, suspectNumbers, err := imagesByNumber(suspectFolder)
+	if err != nil {
+		return nil, err
+	}
+	if len(sourceNumbers) == 0 || len(suspectNumbers) == 0 {
+		return nil, fmt.Errorf("no numbered photos to compare")
+	}
+
+	total := float64(len(sourceNumbers) + len(suspectNumbers))
+	done := 0.0
+	step := func() {
+		done++
+		if progress != nil {
+			progress(done / total)
+		}
+	}
+
+	sourceHashes := map[int]PerceptualHash{}
+	for _, number := range sourceNumbers {
+		if hash, err := ComputePerceptualHash(sourceImages[number]); err == nil {
+			sourceHashes[number] = hash
+		} else {
+			logger.Error(fmt.Sprintf("Perceptual hash failed for %s: %v", filepath.Base(sourceImages[number]), err))
+		}
+		step()
+	}
+
+	report := &SwapDecodeReport{
+		SourceFolder: sourceFolder,
+		Suspect:      filepath.Base(suspectPath),
+		GeneratedAt:  time.Now().UTC(),
+		Moves:        []SwapMove{},
+		Swaps:        []models.SwapOperation{},
+		Candidates:   []SwapCandidate{},
+	}
+	observed := map[int]int{}
+	compared := map[int]bool{}
+	for _, number := range suspectNumbers {
+		rel, _ := filepath.Rel(suspectFolder, suspectImages[number])
+		rel = filepath.ToSlash(rel)
+		hash, err := ComputePerceptualHash(suspectImages[number])
+		step()
+		if err != nil {
+			report.Unmatched = append(report.Unmatched, rel)
+			continue
+		}
+
+		from, distance := closestSourcePhoto(hash, number, sourceHashes)
+		if distance > PHASH_MATCH_DISTANCE {
+			report.Unmatched = append(report.Unmatched, rel)
+			continue
+		}
+		report.Compared++
+		compared[number] = true
+		if from != number {
+			observed[number] = from
+			report.Moves = append(report.Moves, SwapMove{Path: rel, Number: number, ContentFrom: from, Distance: distance})
+		}
+	}
+
+	// Two photos showing each other's content are a plain swap
+	for _, move := range report.Moves {
+		if move.Number < move.ContentFrom && observed[move.ContentFrom] == move.Number {
+			rel, _ := filepath.Rel(suspectFolder, suspectImages[move.ContentFrom])
+			report.Swaps = append(report.Swaps, models.SwapOperation{
+				FileA:   move.Path,
+				FileB:   filepath.ToSlash(rel),
+				NumberA: move.Number,
+				NumberB: move.ContentFrom,
+			})
+		}
+	}
+
+	if len(report.Unmatched) > 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf(
+			"%d suspect photo(s) matched no source photo; moves involving them are not compared", len(report.Unmatched)))
+	}
+	if len(observed) > 0 {
+		report.Candidates = registrySwapCandidates(sourceFolder, observed, compared)
+		if len(report.Candidates) == 0 {
+			report.Candidates = searchSwapCandidates(sourceNumbers, observed, compared, len(report.Unmatched))
+			if len(report.Candidates) == 0 {
+				report.Warnings = append(report.Warnings, fmt.Sprintf(
+					"no registry record of the source folder and no order number up to %d reproduces the %d moved photo(s); "+
+						"the copy may use explicit swap pairs, a swap count the moves do not show, or damaged photos",
+					MAX_SWAP_SEARCH_ORDER, len(observed)))
+			}
+		}
+	}
+	logger.Log(fmt.Sprintf("Swap decode of %s: %d moved photos, %d candidate order(s)",
+		report.Suspect, len(report.Moves), len(report.Candidates)))
+	return report, nil
+}
+
+// closestSourcePhoto returns the source photo most like hash, by pHash and
+// then dHash distance. A photo's own number wins ties, so near-duplicate
+// shots do not show up as moves.
+func closestSourcePhoto(hash PerceptualHash, number int, sources map[int]PerceptualHash) (int, int) {
+	numbers := make([]int, 0, len(sources))
+	for candidate := range sources {
+		numbers = append(numbers, candidate)
+	}
+	sort.Ints(numbers)
+
+	best, bestDistance, bestDHash := 0, 65, 65
+	for _, candidate := range numbers {
+		distance, dDistance := hash.Distance(sources[candidate])
+		if distance < bestDistance || (distance == bestDistance && dDistance < bestDHash) {
+			best, bestDistance, bestDHash = candidate, distance, dDistance
+		}
+	}
+	if own, ok := sources[number]; ok {
+		if distance, _ := hash.Distance(own); distance <= bestDistance {
+			return number, distance
+		}
+	}
+	return best, bestDistance
+}
+
+// expectedMoves replays swaps on photo contents and returns which photo ends
+// up showing which; swaps involving a photo not in available are skipped,
+// as applySwapPlan does
+func expectedMoves(swaps [][2]int, available map[int]bool) map[int]int {
+	content := map[int]int{}
+	at := func(number int) int {
+		if from, ok := content[number]; ok {
+			return from
+		}
+		return number
+	}
+	for _, swap := range swaps {
+		if !available[swap[0]] || !available[swap[1]] {
+			continue
+		}
+		a, b := at(swap[0]), at(swap[1])
+		content[swap[0]], content[swap[1]] = b, a
+	}
+	moves := map[int]int{}
+	for number, from := range content {
+		if from != number {
+			moves[number] = from
+		}
+	}
+	return moves
+}
+
+// compareMoves counts expected moves that were observed and whether both
+// agree exactly. Expected moves onto photos that were not compared are ignored.
+func compareMoves(expected map[int]int, observed map[int]int, compared map[int]bool) (int, bool) {
+	matched, total := 0, 0
+	for number, from := range expected {
+		if !compared[number] {
+			continue
+		}
+		total++
+		if observed[number] == from {
+			matched++
+		}
+	}
+	return matched, matched == total && matched == len(observed)
+}
+
+// registrySwapCandidates checks the swaps recorded for copies of sourceFolder
+func registrySwapCandidates(sourceFolder string, observed map[int]int, compared map[int]bool) []SwapCandidate {
+	records, err := GetIssuanceRegistry().List(IssuanceFilter{SourceFolder: sourceFolder})
+	if err != nil {
+		return nil
+	}
+	var candidates []SwapCandidate
+	for _, record := range records {
+		if len(record.Swaps) == 0 {
+			continue
+		}
+		swaps := make([][2]int, 0, len(record.Swaps))
+		available := map[int]bool{}
+		for _, swap := range record.Swaps {
+			swaps = append(swaps, [2]int{swap.NumberA, swap.NumberB})
+			available[swap.NumberA], available[swap.NumberB] = true, true
+		}
+		matched, exact := compareMoves(expectedMoves(swaps, available), observed, compared)
+		if matched == 0 {
+			continue
+		}
+		candidates = append(candidates, SwapCandidate{
+			OrderNumber: record.OrderNumber,
+			Source:      "registry",
+			RecordID:    record.ID,
+			JobID:       record.JobID,
+			Recipient:   record.Recipient,
+			Matched:     matched,
+			Exact:       exact,
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Exact != candidates[j].Exact {
+			return candidates[i].Exact
+		}
+		return candidates[i].Matched > candidates[j].Matched
+	})
+	return candidates
+}
+
+// searchSwapCandidates tries the generated strategies with every order number
+// up to MAX_SWAP_SEARCH_ORDER and keeps those reproducing the moves exactly.
+// Random and rotate swaps move every photo they pick, so the swap count is the
+// number of moves, plus up to unmatched more when photos could not be compared.
+// Explicit pairs cannot be guessed and need the registry.
+func searchSwapCandidates(sourceNumbers []int, observed map[int]int, compared map[int]bool, unmatched int) []SwapCandidate {
+	available := map[int]bool{}
+	for _, number := range sourceNumbers {
+		available[number] = true
+	}
+	minCount := len(observed)
+	if minCount < 2 {
+		minCount = 2
+	}
+	maxCount := minCount + unmatched
+	if maxCount > MAX_SWAP_COUNT {
+		maxCount = MAX_SWAP_COUNT
+	}
+
+	var plans []SwapPlan
+	if plan, err := NewSwapPlan(SWAP_STRATEGY_OFFSET, nil, 0); err == nil {
+		plans = append(plans, plan)
+	}
+	for _, strategy := range []string{SWAP_STRATEGY_ROTATE, SWAP_STRATEGY_RANDOM} {
+		for count := minCount; count <= maxCount; count++ {
+			if plan, err := NewSwapPlan(strategy, nil, count); err == nil {
+				plans = append(plans, plan)
+			}
+		}
+	}
+
+	candidates := []SwapCandidate{}
+	seen := map[string]bool{}
+	for _, plan := range plans {
+		for order := 1; order <= MAX_SWAP_SEARCH_ORDER; order++ {
+			orderNumber := fmt.Sprintf("%03d", order)
+			swaps, err := plan.transpositions(orderNumber, sourceNumbers)
+			if err != nil {
+				continue
+			}
+			expected := expectedMoves(swaps, available)
+			matched, exact := compareMoves(expected, observed, compared)
+			if !exact || seen[plan.Strategy+":"+orderNumber] {
+				continue
+			}
+			seen[plan.Strategy+":"+orderNumber] = true
+			candidates = append(candidates, SwapCandidate{
+				OrderNumber: orderNumber,
+				Source:      "search",
+				Strategy:    plan.Strategy,
+				Matched:     matched,
+				Exact:       true,
+			})
+		}
+	}
+	return candidates
+}
+
+// extractZipImages extracts the image files of a ZIP into a new temp
+// directory, keeping their folders; the caller removes the directory.
+// Archives with more than MAX_SWAP_ZIP_ENTRIES entries or more than
+// MAX_SWAP_ZIP_SIZE bytes of images are refused.
+func extractZipImages(zipPath string) (string, error) {
+	archive, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %v", filepath.Base(zipPath), err)
+	}
+	defer archive.Close()
+	if len(archive.File) > MAX_SWAP_ZIP_ENTRIES {
+		return "", fmt.Errorf("%s has more than %d entries", filepath.Base(zipPath), MAX_SWAP_ZIP_ENTRIES)
+	}
+
+	dir, err := os.MkdirTemp("", "swap-decode-")
+	if err != nil {
+		return "", err
+	}
+	remaining := int64(MAX_SWAP_ZIP_SIZE)
+	for _, entry := range archive.File {
+		name := filepath.Clean(filepath.FromSlash(entry.Name))
+		if entry.FileInfo().IsDir() || !IsImageFile(name) {
+			continue
+		}
+		// Entries must stay inside the directory
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			continue
+		}
+		written, err := extractZipEntry(entry, filepath.Join(dir, name), remaining)
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+		remaining -= written
+	}
+	return dir, nil
+}
+
+// extractZipEntry writes one entry to target, failing once it exceeds
+// limit bytes whatever size the entry header declares
+func extractZipEntry(entry *zip.File, target string, limit int64) (int64, error) {
+	if entry.UncompressedSize64 > uint64(limit) {
+		return 0, fmt.Errorf("images in the archive exceed %d bytes", int64(MAX_SWAP_ZIP_SIZE))
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+	reader, err := entry.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	file, err := os.Create(target)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	written, err := io.Copy(file, io.LimitReader(reader, limit+1))
+	if err != nil {
+		return written, err
+	}
+	if written > limit {
+		return written, fmt.Errorf("images in the archive exceed %d bytes", int64(MAX_SWAP_ZIP_SIZE))
+	}
+	return written, nil
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// writeTestZip stores entries (name → content) in a ZIP under dir
+func writeTestZip(t *testing.T, dir string, entries map[string]string) string {
+	t.Helper()
+	path := filepath.Join(dir, "suspect.zip")
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entries[name]))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractZipImages(t *testing.T) {
+	zipPath := writeTestZip(t, t.TempDir(), map[string]string{
+		"Bundle/photo_1.jpg": "one",
+		"Bundle/photo_2.png": "two",
+		"Bundle/notes.txt":   "skipped",
+		"../escape_3.jpg":    "outside",
+		"/absolute_4.jpg":    "outside",
+		"a/../../up_5.jpg":   "outside",
+	})
+
+	dir, err := extractZipImages(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var got []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	want := []string{"Bundle/photo_1.jpg", "Bundle/photo_2.png"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("extracted %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape_3.jpg")); err == nil {
+		t.Error("entry escaped the extraction directory")
+	}
+}
+
+func TestExtractZipImagesEntryLimit(t *testing.T) {
+	entries := map[string]string{}
+	for i := 0; i <= MAX_SWAP_ZIP_ENTRIES; i++ {
+		entries[fmt.Sprintf("f%d.txt", i)] = ""
+	}
+	if dir, err := extractZipImages(writeTestZip(t, t.TempDir(), entries)); err == nil {
+		os.RemoveAll(dir)
+		t.Fatal("archive over the entry limit was extracted")
+	}
+}
+
+func TestExtractZipEntrySizeLimit(t *testing.T) {
+	zipPath := writeTestZip(t, t.TempDir(), map[string]string{"photo_1.jpg": "0123456789"})
+	archive, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	tests := []struct {
+		limit   int64
+		wantErr bool
+	}{
+		{10, false},
+		{9, true},
+		{0, true},
+	}
+	for _, tt := range tests {
+		target := filepath.Join(t.TempDir(), "photo_1.jpg")
+		written, err := extractZipEntry(archive.File[0], target, tt.limit)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("limit %d: error %v, wantErr %v", tt.limit, err, tt.wantErr)
+		}
+		if !tt.wantErr && written != 10 {
+			t.Errorf("limit %d: wrote %d bytes, want 10", tt.limit, written)
+		}
+	}
+}
+
+// observedMoves replays swaps over photos 1..n, as a decoder would see them
+func observedMoves(t *testing.T, plan SwapPlan, orderNumber string, n int) ([]int, map[int]int) {
+	t.Helper()
+	var numbers []int
+	available := map[int]bool{}
+	for i := 1; i <= n; i++ {
+		numbers = append(numbers, i)
+		available[i] = true
+	}
+	swaps, err := plan.transpositions(orderNumber, numbers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return numbers, expectedMoves(swaps, available)
+}
+
+func hasCandidate(candidates []SwapCandidate, strategy string, orderNumber string) bool {
+	for _, candidate := range candidates {
+		if candidate.Strategy == strategy && candidate.OrderNumber == orderNumber && candidate.Exact {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSearchSwapCandidates(t *testing.T) {
+	tests := []struct {
+		name  string
+		plan  SwapPlan
+		order string
+	}{
+		{"offset", SwapPlan{Strategy: SWAP_STRATEGY_OFFSET}, "012"},
+		{"rotate", SwapPlan{Strategy: SWAP_STRATEGY_ROTATE, Count: 3}, "005"},
+		{"random", SwapPlan{Strategy: SWAP_STRATEGY_RANDOM, Count: 4}, "042"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			numbers, observed := observedMoves(t, tt.plan, tt.order, 40)
+			compared := map[int]bool{}
+			for _, number := range numbers {
+				compared[number] = true
+			}
+			candidates := searchSwapCandidates(numbers, observed, compared, 0)
+			if !hasCandidate(candidates, tt.plan.Strategy, tt.order) {
+				t.Errorf("order %s not among %d candidates", tt.order, len(candidates))
+			}
+		})
+	}
+}
+
+func TestSearchSwapCandidatesWithUnmatchedPhoto(t *testing.T) {
+	plan := SwapPlan{Strategy: SWAP_STRATEGY_RANDOM, Count: 5}
+	numbers, observed := observedMoves(t, plan, "077", 40)
+
+	// One moved photo was damaged and could not be compared
+	compared := map[int]bool{}
+	for _, number := range numbers {
+		compared[number] = true
+	}
+	for number := range observed {
+		delete(compared, number)
+		delete(observed, number)
+		break
+	}
+
+	if candidates := searchSwapCandidates(numbers, observed, compared, 0); hasCandidate(candidates, SWAP_STRATEGY_RANDOM, "077") {
+		t.Error("count taken from the moves alone should not reproduce the copy")
+	}
+	if candidates := searchSwapCandidates(numbers, observed, compared, 1); !hasCandidate(candidates, SWAP_STRATEGY_RANDOM, "077") {
+		t.Error("order 077 not found when allowing for the unmatched photo")
+	}
+}
+
+func TestCompareMoves(t *testing.T) {
+	all := map[int]bool{1: true, 2: true, 3: true}
+	tests := []struct {
+		name        string
+		expected    map[int]int
+		observed    map[int]int
+		compared    map[int]bool
+		wantMatched int
+		wantExact   bool
+	}{
+		{"exact", map[int]int{1: 2, 2: 1}, map[int]int{1: 2, 2: 1}, all, 2, true},
+		{"extra observed", map[int]int{1: 2, 2: 1}, map[int]int{1: 2, 2: 1, 3: 1}, all, 2, false},
+		{"missing observed", map[int]int{1: 2, 2: 1}, map[int]int{1: 2}, all, 1, false},
+		{"uncompared photo ignored", map[int]int{1: 2, 2: 3, 3: 1}, map[int]int{1: 2, 2: 3}, map[int]bool{1: true, 2: true}, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, exact := compareMoves(tt.expected, tt.observed, tt.compared)
+			if matched != tt.wantMatched || exact != tt.wantExact {
+				t.Errorf("got %d, %v, want %d, %v", matched, exact, tt.wantMatched, tt.wantExact)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"photo-processing-server/internal/models"
+)
+
+// Swap strategies of batch copies. The photos a copy swaps depend on its
+// order number, so the file order is a fingerprint of the copy.
+const (
+	SWAP_STRATEGY_OFFSET = "offset" // photo N with N+SWAP_OFFSET, N being the order number (default)
+	SWAP_STRATEGY_PAIRS  = "pairs"  // explicit SwapPairs, for every copy or one order number
+	SWAP_STRATEGY_RANDOM = "random" // one cycle through SwapCount photos picked by a seed from the order number
+	SWAP_STRATEGY_ROTATE = "rotate" // contents of photos N, N+SWAP_OFFSET, ... move one place along
+)
+
+// Swap strategy parameters
+const (
+	SWAP_OFFSET        = 10
+	SWAP_DEFAULT_COUNT = 3
+	MAX_SWAP_COUNT     = 100
+)
+
+// SwapPair swaps photos A and B; Order limits it to one copy's order number
+type SwapPair struct {
+	Order string
+	A     int
+	B     int
+}
+
+// SwapPlan selects how each batch copy swaps photos
+type SwapPlan struct {
+	Strategy string
+	Pairs    []SwapPair
+	Count    int // photos taking part in random and rotate swaps
+}
+
+// NewSwapPlan builds a plan from batch settings. Pairs are maps with "a" and
+// "b" photo numbers and an optional "order" number; given pairs without a
+// strategy select SWAP_STRATEGY_PAIRS.
+func NewSwapPlan(strategy string, pairs []map[string]string, count int) (SwapPlan, error) {
+	plan := SwapPlan{Strategy: strings.ToLower(strategy), Count: count}
+	for i, pair := range pairs {
+		a, errA := strconv.Atoi(strings.TrimSpace(pair["a"]))
+		b, errB := strconv.Atoi(strings.TrimSpace(pair["b"]))
+		if errA != nil || errB != nil || a < 1 || b < 1 || a == b {
+			return plan, fmt.Errorf("swap pair %d needs two different photo numbers \"a\" and \"b\"", i+1)
+		}
+		order := strings.TrimSpace(pair["order"])
+		if order != "" {
+			if _, err := strconv.Atoi(order); err != nil {
+				return plan, fmt.Errorf("swap pair %d has an invalid order number %q", i+1, order)
+			}
+		}
+		plan.Pairs = append(plan.Pairs, SwapPair{Order: order, A: a, B: b})
+	}
+	if plan.Strategy == "" {
+		plan.Strategy = SWAP_STRATEGY_OFFSET
+		if len(plan.Pairs) > 0 {
+			plan.Strategy = SWAP_STRATEGY_PAIRS
+		}
+	}
+	if plan.Count == 0 {
+		plan.Count = SWAP_DEFAULT_COUNT
+	}
+
+	switch plan.Strategy {
+	case SWAP_STRATEGY_OFFSET, SWAP_STRATEGY_RANDOM, SWAP_STRATEGY_ROTATE:
+	case SWAP_STRATEGY_PAIRS:
+		if len(plan.Pairs) == 0 {
+			return plan, fmt.Errorf("swap strategy %q needs swap pairs", plan.Strategy)
+		}
+	default:
+		return plan, fmt.Errorf("unknown swap strategy %q", strategy)
+	}
+	if plan.Count < 2 || plan.Count > MAX_SWAP_COUNT {
+		return plan, fmt.Errorf("swap count must be between 2 and %d", MAX_SWAP_COUNT)
+	}
+	return plan, nil
+}
+
+// transpositions returns the photo number pairs swapped, in order, for the
+// copy with orderNumber. available are the photo numbers of the copy.
+func (p SwapPlan) transpositions(orderNumber string, available []int) ([][2]int, error) {
+	switch p.Strategy {
+	case SWAP_STRATEGY_PAIRS:
+		var swaps [][2]int
+		for _, pair := range p.Pairs {
+			if pair.Order == "" || sameOrderNumber(pair.Order, orderNumber) {
+				swaps = append(swaps, [2]int{pair.A, pair.B})
+			}
+		}
+		return swaps, nil
+
+	case SWAP_STRATEGY_RANDOM:
+		numbers := append([]int(nil), available...)
+		sort.Ints(numbers)
+		random := rand.New(rand.NewSource(swapSeed(orderNumber)))
+		random.Shuffle(len(numbers), func(i, j int) { numbers[i], numbers[j] = numbers[j], numbers[i] })
+		if len(numbers) > p.Count {
+			numbers = numbers[:p.Count]
+		}
+		// Sattolo's algorithm: a single cycle, so no chosen photo keeps its place
+		var swaps [][2]int
+		for i := len(numbers) - 1; i > 0; i-- {
+			j := random.Intn(i)
+			swaps = append(swaps, [2]int{numbers[j], numbers[i]})
+			numbers[i], numbers[j] = numbers[j], numbers[i]
+		}
+		return swaps, nil
+	}
+
+	base, err := strconv.Atoi(orderNumber)
+	if err != nil {
+		return nil, err
+	}
+	if p.Strategy == SWAP_STRATEGY_ROTATE {
+		// Swapping the first photo with each of the others in turn rotates them
+		var swaps [][2]int
+		for i := 1; i < p.Count; i++ {
+			swaps = append(swaps, [2]int{base, base + i*SWAP_OFFSET})
+		}
+		return swaps, nil
+	}
+	return [][2]int{{base, base + SWAP_OFFSET}}, nil
+}
+
+// swapSeed derives the random strategy's seed from the order number, ignoring
+// zero padding so "007" and "7" swap alike
+func swapSeed(orderNumber string) int64 {
+	if number, err := strconv.Atoi(orderNumber); err == nil {
+		orderNumber = strconv.Itoa(number)
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte("swap:" + orderNumber))
+	return int64(hash.Sum64())
+}
+
+func sameOrderNumber(a string, b string) bool {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return x == y
+}
+
+// imagesByNumber maps photo numbers to the last image file with that number,
+// in walk order, as the original swap always picked
+func imagesByNumber(folder string) (map[int]string, []int, error) {
+	files, err := GetSupportedFiles(folder)
+	if err != nil {
+		return nil, nil, err
+	}
+	images := map[int]string{}
+	var numbers []int
+	for _, file := range files {
+		if !IsImageFile(file) {
+			continue
+		}
+		number := extractFileNumber(filepath.Base(file))
+		if number == nil {
+			continue
+		}
+		if _, exists := images[*number]; !exists {
+			numbers = append(numbers, *number)
+		}
+		images[*number] = file
+	}
+	sort.Ints(numbers)
+	return images, numbers, nil
+}
+
+// applySwapPlan swaps the photos of one copy folder and returns the swaps
+// made, with paths relative to folder. Pairs with a missing photo are skipped.
+func applySwapPlan(folder string, orderNumber string, plan SwapPlan) ([]models.SwapOperation, error) {
+	logger := GetGlobalLogger()
+
+	images, numbers, err := imagesByNumber(folder)
+	if err != nil {
+		return nil, err
+	}
+	swaps, err := plan.transpositions(orderNumber, numbers)
+	if err != nil {
+		return nil, err
+	}
+
+	operations := []models.SwapOperation{}
+	for _, swap := range swaps {
+		fileA, fileB := images[swap[0]], images[swap[1]]
+		if fileA == "" || fileB == "" {
+			logger.Log(fmt.Sprintf("No matching pair found for swapping in folder %s (need %d and %d)",
+				filepath.Base(folder), swap[0], swap[1]))
+			continue
+		}
+		if err := swapFiles(fileA, fileB); err != nil {
+			return operations, err
+		}
+		relA, _ := filepath.Rel(folder, fileA)
+		relB, _ := filepath.Rel(folder, fileB)
+		operations = append(operations, models.SwapOperation{
+			FileA:   filepath.ToSlash(relA),
+			FileB:   filepath.ToSlash(relB),
+			NumberA: swap[0],
+			NumberB: swap[1],
+		})
+	}
+	return operations, nil
+}
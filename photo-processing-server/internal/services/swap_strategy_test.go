@@ -0,0 +1,115 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewSwapPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		pairs    []map[string]string
+		count    int
+		want     string
+		wantErr  bool
+	}{
+		{"default offset", "", nil, 0, SWAP_STRATEGY_OFFSET, false},
+		{"pairs implied", "", []map[string]string{{"a": "3", "b": "7"}}, 0, SWAP_STRATEGY_PAIRS, false},
+		{"case insensitive", "Rotate", nil, 4, SWAP_STRATEGY_ROTATE, false},
+		{"pairs without pairs", "pairs", nil, 0, "", true},
+		{"same photo", "", []map[string]string{{"a": "3", "b": "3"}}, 0, "", true},
+		{"missing photo", "", []map[string]string{{"a": "3"}}, 0, "", true},
+		{"bad order", "", []map[string]string{{"a": "3", "b": "4", "order": "x"}}, 0, "", true},
+		{"unknown strategy", "shuffle", nil, 0, "", true},
+		{"count too small", "random", nil, 1, "", true},
+		{"count too large", "random", nil, MAX_SWAP_COUNT + 1, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := NewSwapPlan(tt.strategy, tt.pairs, tt.count)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && plan.Strategy != tt.want {
+				t.Errorf("strategy %q, want %q", plan.Strategy, tt.want)
+			}
+		})
+	}
+}
+
+func TestSwapTranspositions(t *testing.T) {
+	available := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24}
+	pairs := []SwapPair{{A: 1, B: 2}, {Order: "002", A: 5, B: 9}}
+	tests := []struct {
+		name  string
+		plan  SwapPlan
+		order string
+		want  [][2]int
+	}{
+		{"offset", SwapPlan{Strategy: SWAP_STRATEGY_OFFSET}, "003", [][2]int{{3, 13}}},
+		{"rotate", SwapPlan{Strategy: SWAP_STRATEGY_ROTATE, Count: 3}, "004", [][2]int{{4, 14}, {4, 24}}},
+		{"pairs for every copy", SwapPlan{Strategy: SWAP_STRATEGY_PAIRS, Pairs: pairs}, "001", [][2]int{{1, 2}}},
+		{"pairs for one order", SwapPlan{Strategy: SWAP_STRATEGY_PAIRS, Pairs: pairs}, "2", [][2]int{{1, 2}, {5, 9}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.plan.transpositions(tt.order, available)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("transpositions %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := (SwapPlan{Strategy: SWAP_STRATEGY_OFFSET}).transpositions("A-7", available); err == nil {
+		t.Error("offset swap accepted a non-numeric order number")
+	}
+}
+
+func TestRandomSwapIsOneCycle(t *testing.T) {
+	available := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	present := map[int]bool{}
+	for _, number := range available {
+		present[number] = true
+	}
+	plan := SwapPlan{Strategy: SWAP_STRATEGY_RANDOM, Count: 4}
+
+	swaps, err := plan.transpositions("007", available)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moves := expectedMoves(swaps, present); len(moves) != plan.Count {
+		t.Fatalf("%d photos moved, want %d: %v", len(moves), plan.Count, moves)
+	}
+	again, _ := plan.transpositions("7", available)
+	if !reflect.DeepEqual(swaps, again) {
+		t.Errorf("order 007 swaps %v, order 7 swaps %v", swaps, again)
+	}
+}
+
+func TestApplySwapPlanDuplicateNumbers(t *testing.T) {
+	folder := t.TempDir()
+	for _, name := range []string{"a_3.jpg", "b_3.jpg", "c_13.jpg", "notes_3.txt"} {
+		if err := os.WriteFile(filepath.Join(folder, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	swaps, err := applySwapPlan(folder, "003", SwapPlan{Strategy: SWAP_STRATEGY_OFFSET})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(swaps) != 1 || swaps[0].FileA != "b_3.jpg" || swaps[0].FileB != "c_13.jpg" {
+		t.Fatalf("swaps %+v, want b_3.jpg with c_13.jpg", swaps)
+	}
+	for name, want := range map[string]string{"a_3.jpg": "a_3.jpg", "b_3.jpg": "c_13.jpg", "c_13.jpg": "b_3.jpg", "notes_3.txt": "notes_3.txt"} {
+		if got, _ := os.ReadFile(filepath.Join(folder, name)); string(got) != want {
+			t.Errorf("%s holds %q, want %q", name, got, want)
+		}
+	}
+}
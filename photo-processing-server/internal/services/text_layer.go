@@ -0,0 +1,184 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// Visible text that is not a plain Hershey stamp is drawn as a layer: the
+// glyphs are rendered into coverage masks, shadow, outline and fill are
+// composited into a premultiplied RGBA image, and that image is blended into
+// the photo. Tiled watermarks rotate the layer before stamping it.
+
+// textMasks renders the fill and outline coverage of text with its baseline
+// at layout.origin. Without an outline both masks are the same.
+func textMasks(text string, layout visibleTextLayout, style *VisibleWatermarkStyle) (*image.Alpha, *image.Alpha, error) {
+	outline := 0
+	if style != nil {
+		outline = style.Outline
+	}
+	if layout.trueType != nil {
+		fill, err := layout.trueType.mask(text, layout.pixelSize, layout.origin)
+		if err != nil {
+			return nil, nil, err
+		}
+		return fill, dilateAlpha(fill, outline), nil
+	}
+	fill := hersheyMask(text, layout, layout.thickness)
+	if outline == 0 {
+		return fill, fill, nil
+	}
+	return fill, hersheyMask(text, layout, layout.thickness+2*outline), nil
+}
+
+// hersheyMask renders Hershey text anti-aliased into a coverage mask
+func hersheyMask(text string, layout visibleTextLayout, thickness int) *image.Alpha {
+	size, baseline := gocv.GetTextSizeWithBaseline(text, layout.font, layout.scale, thickness)
+	margin := thickness + 1
+	rect := image.Rect(layout.origin.X-margin, layout.origin.Y-size.Y-margin,
+		layout.origin.X+size.X+margin, layout.origin.Y+baseline+margin)
+
+	mat := gocv.NewMatWithSize(rect.Dy(), rect.Dx(), gocv.MatTypeCV8U)
+	defer mat.Close()
+	mat.SetTo(gocv.NewScalar(0, 0, 0, 0))
+	gocv.PutTextWithParams(&mat, text, layout.origin.Sub(rect.Min), layout.font, layout.scale, WHITE_COLOR, thickness, gocv.LineAA, false)
+
+	mask := image.NewAlpha(rect)
+	copy(mask.Pix, mat.ToBytes())
+	return mask
+}
+
+// dilateAlpha grows mask by radius pixels in every direction (square max
+// filter), which turns glyphs into their outline shape
+func dilateAlpha(mask *image.Alpha, radius int) *image.Alpha {
+	if radius <= 0 {
+		return mask
+	}
+	rect := mask.Rect.Inset(-radius)
+	horizontal := image.NewAlpha(rect)
+	for y := mask.Rect.Min.Y; y < mask.Rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			var peak uint8
+			for dx := -radius; dx <= radius; dx++ {
+				if a := mask.AlphaAt(x+dx, y).A; a > peak {
+					peak = a
+				}
+			}
+			horizontal.SetAlpha(x, y, color.Alpha{A: peak})
+		}
+	}
+	out := image.NewAlpha(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			var peak uint8
+			for dy := -radius; dy <= radius; dy++ {
+				if a := horizontal.AlphaAt(x, y+dy).A; a > peak {
+					peak = a
+				}
+			}
+			out.SetAlpha(x, y, color.Alpha{A: peak})
+		}
+	}
+	return out
+}
+
+// composeTextLayer paints shadow, outline and fill in opaque style colours.
+// A default style paints plain white fill for the additive look.
+func composeTextLayer(fill *image.Alpha, outline *image.Alpha, style *VisibleWatermarkStyle) *image.RGBA {
+	type pass struct {
+		mask  *image.Alpha
+		color color.RGBA
+	}
+	var passes []pass
+	if !style.isDefault() {
+		if style.Shadow > 0 {
+			shadowColor, _ := parseStyleColor(style.ShadowColor, BLACK_COLOR)
+			shadow := *outline
+			shadow.Rect = outline.Rect.Add(image.Point{X: style.Shadow, Y: style.Shadow})
+			passes = append(passes, pass{&shadow, shadowColor})
+		}
+		if style.Outline > 0 {
+			outlineColor, _ := parseStyleColor(style.OutlineColor, BLACK_COLOR)
+			passes = append(passes, pass{outline, outlineColor})
+		}
+	}
+	fillColor := WHITE_COLOR
+	if style != nil {
+		fillColor, _ = parseStyleColor(style.Color, WHITE_COLOR)
+	}
+	passes = append(passes, pass{fill, fillColor})
+
+	bounds := image.Rectangle{}
+	for _, p := range passes {
+		bounds = bounds.Union(p.mask.Rect)
+	}
+	layer := image.NewRGBA(bounds)
+	for _, p := range passes {
+		p.color.A = 255
+		draw.DrawMask(layer, p.mask.Rect, image.NewUniform(p.color), image.Point{}, p.mask, p.mask.Rect.Min, draw.Over)
+	}
+	return layer
+}
+
+// drawTextLayer draws text as a layer onto img. A default style adds white
+// at ALPHA like the Hershey overlay; other styles alpha-blend at their opacity.
+func drawTextLayer(img *gocv.Mat, text string, layout visibleTextLayout, style *VisibleWatermarkStyle) error {
+	fill, outline, err := textMasks(text, layout, style)
+	if err != nil {
+		return err
+	}
+	layer := composeTextLayer(fill, outline, style)
+	if style.isDefault() {
+		blendLayer(img, layer, ALPHA, true)
+	} else {
+		blendLayer(img, layer, style.opacity(), false)
+	}
+	return nil
+}
+
+// blendLayer blends the premultiplied RGBA layer into the BGR image at
+// opacity; additive adds the layer colour instead of covering the image
+func blendLayer(img *gocv.Mat, layer *image.RGBA, opacity float64, additive bool) {
+	box := layer.Rect.Intersect(image.Rect(0, 0, img.Cols(), img.Rows()))
+	if box.Empty() {
+		return
+	}
+	region := img.Region(box)
+	defer region.Close()
+	// Regions share the parent's rows, so work on a continuous copy
+	pixels := region.Clone()
+	defer pixels.Close()
+	data := pixels.ToBytes()
+
+	channels := pixels.Channels()
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			src := layer.RGBAAt(x, y) // premultiplied
+			if src.A == 0 {
+				continue
+			}
+			cover := float64(src.A) / 255 * opacity
+			i := ((y-box.Min.Y)*box.Dx() + (x - box.Min.X)) * channels
+			for c, value := range [3]uint8{src.B, src.G, src.R} {
+				v := float64(data[i+c])
+				if additive {
+					v += float64(value) * opacity
+				} else {
+					v = v*(1-cover) + float64(value)*opacity
+				}
+				data[i+c] = uint8(math.Min(255, math.Max(0, math.Round(v))))
+			}
+		}
+	}
+
+	blended, err := gocv.NewMatFromBytes(box.Dy(), box.Dx(), pixels.Type(), data)
+	if err != nil {
+		return
+	}
+	defer blended.Close()
+	blended.CopyTo(&region)
+}
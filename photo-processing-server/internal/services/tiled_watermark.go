@@ -0,0 +1,159 @@
+package services
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"gocv.io/x/gocv"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// Tiled watermarks repeat the text over the whole image on a rotated grid,
+// every other row shifted by half a tile, so no crop of useful size is free
+// of it. The text layer is rendered and rotated once and stamped per tile.
+const (
+	TILED_DEFAULT_ANGLE   = 30.0 // degrees counter-clockwise
+	TILED_DEFAULT_SPACING = 0.1  // gap between tiles, fraction of the shorter image side
+	TILED_DEFAULT_SIZE    = 0.04 // text height without a style size
+	MAX_TILED_SPACING     = 1.0
+)
+
+// angle returns the tile rotation in degrees
+func (s *VisibleWatermarkStyle) angle() float64 {
+	if s == nil || s.Angle == nil {
+		return TILED_DEFAULT_ANGLE
+	}
+	return *s.Angle
+}
+
+// spacing returns the gap between tiles as a fraction of the shorter side
+func (s *VisibleWatermarkStyle) spacing() float64 {
+	if s == nil || s.Spacing == 0 {
+		return TILED_DEFAULT_SPACING
+	}
+	return s.Spacing
+}
+
+// rotateLayer rotates a premultiplied layer by degrees counter-clockwise
+// around its centre; the result starts at (0, 0) and fits the rotated layer
+func rotateLayer(src *image.RGBA, degrees float64) *image.RGBA {
+	rad := degrees * math.Pi / 180
+	cos, sin := math.Cos(rad), math.Sin(rad)
+	bounds := src.Bounds()
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	rotatedWidth := int(math.Ceil(math.Abs(w*cos) + math.Abs(h*sin)))
+	rotatedHeight := int(math.Ceil(math.Abs(w*sin) + math.Abs(h*cos)))
+	dst := image.NewRGBA(image.Rect(0, 0, rotatedWidth, rotatedHeight))
+
+	// y points down, so a counter-clockwise turn maps (x, y) to (x·cos + y·sin, -x·sin + y·cos)
+	cx, cy := float64(bounds.Min.X)+w/2, float64(bounds.Min.Y)+h/2
+	tx := float64(rotatedWidth)/2 - (cos*cx + sin*cy)
+	ty := float64(rotatedHeight)/2 - (-sin*cx + cos*cy)
+	xdraw.BiLinear.Transform(dst, f64.Aff3{cos, sin, tx, -sin, cos, ty}, src, bounds, xdraw.Src, nil)
+	return dst
+}
+
+// tilePositions returns where the top-left corner of every rotated tile
+// that touches a width×height image goes. tile is the unrotated layer size,
+// rotated the size of the rotated layer and gap the space between tiles.
+func tilePositions(width int, height int, tile image.Point, rotated image.Point, degrees float64, gap float64) []image.Point {
+	rad := degrees * math.Pi / 180
+	// Along the text and across it, in image coordinates
+	ux, uy := math.Cos(rad), -math.Sin(rad)
+	vx, vy := math.Sin(rad), math.Cos(rad)
+	stepU := float64(tile.X) + gap
+	stepV := float64(tile.Y) + gap
+
+	diagonal := math.Hypot(float64(width), float64(height))
+	countU := int(diagonal/stepU)/2 + 2
+	countV := int(diagonal/stepV)/2 + 2
+	centerX, centerY := float64(width)/2, float64(height)/2
+	bounds := image.Rect(0, 0, width, height)
+
+	var positions []image.Point
+	for j := -countV; j <= countV; j++ {
+		shift := 0.0
+		if j%2 != 0 {
+			shift = stepU / 2
+		}
+		for i := -countU; i <= countU; i++ {
+			along := float64(i)*stepU + shift
+			across := float64(j) * stepV
+			x := centerX + ux*along + vx*across - float64(rotated.X)/2
+			y := centerY + uy*along + vy*across - float64(rotated.Y)/2
+			at := image.Point{X: int(math.Round(x)), Y: int(math.Round(y))}
+			if (image.Rectangle{Min: at, Max: at.Add(rotated)}).Overlaps(bounds) {
+				positions = append(positions, at)
+			}
+		}
+	}
+	return positions
+}
+
+// tiledLayer renders the rotated text layer and the tile positions for a
+// width×height image; fillOnly leaves out shadow and outline
+func tiledLayer(text string, layout visibleTextLayout, style *VisibleWatermarkStyle, width int, height int, fillOnly bool) (*image.RGBA, []image.Point, error) {
+	fill, outline, err := textMasks(text, layout, style)
+	if err != nil {
+		return nil, nil, err
+	}
+	layer := composeTextLayer(fill, outline, style)
+	// Tiles are spaced by the full text box so shadow and outline never overlap
+	tile := layer.Bounds().Size()
+	if fillOnly {
+		// Same bounds as the full layer so both rotate to the same tiles
+		glyphs := image.NewRGBA(layer.Bounds())
+		draw.DrawMask(glyphs, fill.Rect, image.White, image.Point{}, fill, fill.Rect.Min, draw.Over)
+		layer = glyphs
+	}
+	rotated := rotateLayer(layer, style.angle())
+
+	gap := style.spacing() * math.Min(float64(width), float64(height))
+	positions := tilePositions(width, height, tile, rotated.Bounds().Size(), style.angle(), gap)
+	return rotated, positions, nil
+}
+
+// drawTiledText stamps the rotated text layer over the whole image
+func drawTiledText(img *gocv.Mat, text string, layout visibleTextLayout, style *VisibleWatermarkStyle) error {
+	layer, positions, err := tiledLayer(text, layout, style, img.Cols(), img.Rows(), false)
+	if err != nil {
+		return err
+	}
+	for _, at := range positions {
+		tile := *layer
+		tile.Rect = layer.Rect.Add(at)
+		blendLayer(img, &tile, style.opacity(), false)
+	}
+	return nil
+}
+
+// tiledTextContrast compares the brightness of glyph pixels of every tile
+// with the other pixels of the tiles, like DetectVisibleText does for one text
+func tiledTextContrast(gray gocv.Mat, text string, layout visibleTextLayout, style *VisibleWatermarkStyle) (float64, error) {
+	width, height := gray.Cols(), gray.Rows()
+	layer, positions, err := tiledLayer(text, layout, style, width, height, true)
+	if err != nil {
+		return 0, err
+	}
+	// One copy of the pixels instead of a call into OpenCV per pixel
+	data := gray.ToBytes()
+	if len(data) < width*height {
+		return 0, nil
+	}
+
+	var pix []uint8
+	var inText []bool
+	bounds := image.Rect(0, 0, width, height)
+	for _, at := range positions {
+		box := layer.Rect.Add(at).Intersect(bounds)
+		for y := box.Min.Y; y < box.Max.Y; y++ {
+			for x := box.Min.X; x < box.Max.X; x++ {
+				pix = append(pix, data[y*width+x])
+				inText = append(inText, layer.RGBAAt(x-at.X, y-at.Y).A >= 128)
+			}
+		}
+	}
+	return visibleTextContrast(pix, inText), nil
+}
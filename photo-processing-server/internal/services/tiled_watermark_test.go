@@ -0,0 +1,106 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestRotateLayerSize(t *testing.T) {
+	tests := []struct {
+		degrees float64
+		want    image.Point
+	}{
+		{0, image.Point{X: 100, Y: 20}},
+		{90, image.Point{X: 20, Y: 100}},
+		{180, image.Point{X: 100, Y: 20}},
+		{-90, image.Point{X: 20, Y: 100}},
+		{30, image.Point{X: 97, Y: 68}}, // 100·cos 30 + 20·sin 30, 100·sin 30 + 20·cos 30
+		{-45, image.Point{X: 85, Y: 85}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.degrees), func(t *testing.T) {
+			src := image.NewRGBA(image.Rect(10, 5, 110, 25))
+			size := rotateLayer(src, tt.degrees).Bounds()
+			// Rounding of sin and cos may add a pixel
+			if size.Min != (image.Point{}) || size.Dx() < tt.want.X || size.Dx() > tt.want.X+1 ||
+				size.Dy() < tt.want.Y || size.Dy() > tt.want.Y+1 {
+				t.Errorf("rotated bounds %v, want %v", size, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotateLayerCounterClockwise(t *testing.T) {
+	// An opaque block at the right end of the layer ends up at the top
+	src := image.NewRGBA(image.Rect(0, 0, 40, 10))
+	for y := 0; y < 10; y++ {
+		for x := 30; x < 40; x++ {
+			src.SetRGBA(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	rotated := rotateLayer(src, 90)
+	size := rotated.Bounds().Size()
+	if top := rotated.RGBAAt(size.X/2, 4); top.A < 200 {
+		t.Errorf("top of the rotated layer has alpha %d", top.A)
+	}
+	if bottom := rotated.RGBAAt(size.X/2, size.Y-5); bottom.A != 0 {
+		t.Errorf("bottom of the rotated layer has alpha %d", bottom.A)
+	}
+}
+
+func TestTilePositionsCoverCorners(t *testing.T) {
+	tests := []struct {
+		width, height int
+		tile          image.Point
+		degrees, gap  float64
+	}{
+		{640, 480, image.Point{X: 120, Y: 24}, 30, 48},
+		{480, 640, image.Point{X: 120, Y: 24}, -45, 20},
+		{1000, 200, image.Point{X: 300, Y: 40}, 0, 0},
+		{300, 300, image.Point{X: 80, Y: 30}, 90, 30},
+		{50, 50, image.Point{X: 400, Y: 60}, 15, 5}, // tile larger than the image
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%dx%d at %g", tt.width, tt.height, tt.degrees), func(t *testing.T) {
+			layer := rotateLayer(image.NewRGBA(image.Rectangle{Max: tt.tile}), tt.degrees)
+			rotated := layer.Bounds().Size()
+			positions := tilePositions(tt.width, tt.height, tt.tile, rotated, tt.degrees, tt.gap)
+
+			bounds := image.Rect(0, 0, tt.width, tt.height)
+			seen := map[image.Point]bool{}
+			for _, at := range positions {
+				if !(image.Rectangle{Min: at, Max: at.Add(rotated)}).Overlaps(bounds) {
+					t.Errorf("tile at %v is outside the image", at)
+				}
+				if seen[at] {
+					t.Errorf("two tiles at %v", at)
+				}
+				seen[at] = true
+			}
+
+			// Every corner lies in the cell, tile plus gap, of some tile
+			rad := tt.degrees * math.Pi / 180
+			ux, uy := math.Cos(rad), -math.Sin(rad)
+			vx, vy := math.Sin(rad), math.Cos(rad)
+			halfU, halfV := (float64(tt.tile.X)+tt.gap)/2+1, (float64(tt.tile.Y)+tt.gap)/2+1
+			corners := []image.Point{{0, 0}, {tt.width - 1, 0}, {0, tt.height - 1}, {tt.width - 1, tt.height - 1}}
+			for _, corner := range corners {
+				covered := false
+				for _, at := range positions {
+					dx := float64(corner.X) - (float64(at.X) + float64(rotated.X)/2)
+					dy := float64(corner.Y) - (float64(at.Y) + float64(rotated.Y)/2)
+					if math.Abs(dx*ux+dy*uy) <= halfU && math.Abs(dx*vx+dy*vy) <= halfV {
+						covered = true
+						break
+					}
+				}
+				if !covered {
+					t.Errorf("corner %v is not covered by any of %d tiles", corner, len(positions))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+)
+
+// Length-prefixed trailer record, appended to files without a container format:
+//
+//	WATERMARK_START + content + WATERMARK_END + length + CRC-32 + magic
+//
+// length (uint32) and CRC-32 (IEEE, uint32) are big-endian and cover content
+// only. The footer is the last WATERMARK_FOOTER_LENGTH bytes of the file, so
+// the newest record is found in O(1) whatever the payload size or charset,
+// and each older record ends where the next one starts. Short records still
+// look like a plain mark to readers scanning the last MAX_WATERMARK_LENGTH bytes.
+const (
+	WATERMARK_FOOTER_LENGTH = 16
+	MAX_TRAILER_PAYLOAD     = 16 << 20
+)
+
+var WATERMARK_FOOTER_MAGIC = []byte("ENDECWM1")
+
+// buildTrailerRecord wraps content (owner label + payload) in a trailer record
+func buildTrailerRecord(content string) []byte {
+	record := buildWatermark(content)
+	record = binary.BigEndian.AppendUint32(record, uint32(len(content)))
+	record = binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE([]byte(content)))
+	return append(record, WATERMARK_FOOTER_MAGIC...)
+}
+
+// trailerMark is a mark found at the end of a file
+type trailerMark struct {
+	WatermarkInfo
+	footer bool // length-prefixed record rather than a plain mark
+}
+
+// readTrailerMarks reads the run of marks appended to the end of the file,
+// oldest first, with StartPosition/EndPosition as absolute file offsets.
+// Footer records and plain <<==...==>> marks may be mixed in one chain.
+func readTrailerMarks(filePath string) ([]trailerMark, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		GetGlobalLogger().Error(fmt.Sprintf("Error reading watermark data from %s: %v", filepath.Base(filePath), err))
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var marks []trailerMark
+	pos := info.Size()
+	for len(marks) < MAX_WATERMARK_CHAIN && pos > 0 {
+		mark, footer, err := readFooterRecord(file, pos)
+		if err != nil {
+			return nil, err
+		}
+		ok := footer
+		if !ok {
+			if mark, ok, err = readPlainMark(file, pos, len(marks) == 0); err != nil {
+				return nil, err
+			}
+		}
+		if !ok {
+			break
+		}
+		marks = append(marks, trailerMark{WatermarkInfo: mark, footer: footer})
+		pos = int64(mark.StartPosition)
+	}
+
+	// Collected newest first
+	for i, j := 0, len(marks)-1; i < j; i, j = i+1, j-1 {
+		marks[i], marks[j] = marks[j], marks[i]
+	}
+	return marks, nil
+}
+
+// readFooterRecord reads the length-prefixed record ending at end, if any
+func readFooterRecord(file *os.File, end int64) (WatermarkInfo, bool, error) {
+	overhead := int64(len(WATERMARK_START) + len(WATERMARK_END) + WATERMARK_FOOTER_LENGTH)
+	if end < overhead {
+		return WatermarkInfo{}, false, nil
+	}
+
+	footer := make([]byte, WATERMARK_FOOTER_LENGTH)
+	if _, err := file.ReadAt(footer, end-WATERMARK_FOOTER_LENGTH); err != nil {
+		return WatermarkInfo{}, false, err
+	}
+	if !bytes.Equal(footer[8:], WATERMARK_FOOTER_MAGIC) {
+		return WatermarkInfo{}, false, nil
+	}
+	length := int64(binary.BigEndian.Uint32(footer[0:4]))
+	if length > MAX_TRAILER_PAYLOAD || length+overhead > end {
+		return WatermarkInfo{}, false, nil
+	}
+
+	start := end - length - overhead
+	record := make([]byte, length+int64(len(WATERMARK_START)+len(WATERMARK_END)))
+	if _, err := file.ReadAt(record, start); err != nil {
+		return WatermarkInfo{}, false, err
+	}
+	if !bytes.HasPrefix(record, WATERMARK_START) || !bytes.HasSuffix(record, WATERMARK_END) {
+		return WatermarkInfo{}, false, nil
+	}
+	content := record[len(WATERMARK_START) : len(record)-len(WATERMARK_END)]
+	if crc32.ChecksumIEEE(content) != binary.BigEndian.Uint32(footer[4:8]) {
+		return WatermarkInfo{}, false, nil
+	}
+	return WatermarkInfo{StartPosition: int(start), EndPosition: int(end), Content: content}, true, nil
+}
+
+// readPlainMark reads a footerless mark within the MAX_WATERMARK_LENGTH bytes
+// before end (the Kotlin format). The newest mark may be followed by stray
+// bytes, which are removed with it; older marks must end exactly at end.
+func readPlainMark(file *os.File, end int64, newest bool) (WatermarkInfo, bool, error) {
+	window := int64(MAX_WATERMARK_LENGTH)
+	if window > end {
+		window = end
+	}
+	base := end - window
+	tail := make([]byte, window)
+	if _, err := file.ReadAt(tail, base); err != nil {
+		return WatermarkInfo{}, false, err
+	}
+
+	start := bytes.LastIndex(tail, WATERMARK_START)
+	if start == -1 {
+		return WatermarkInfo{}, false, nil
+	}
+	contentStart := start + len(WATERMARK_START)
+	var contentEnd int
+	if newest {
+		contentEnd = findBytes(tail, WATERMARK_END, contentStart)
+		if contentEnd == -1 {
+			return WatermarkInfo{}, false, nil
+		}
+	} else {
+		contentEnd = len(tail) - len(WATERMARK_END)
+		if contentEnd < contentStart || !bytes.HasSuffix(tail, WATERMARK_END) {
+			return WatermarkInfo{}, false, nil
+		}
+	}
+	return WatermarkInfo{
+		StartPosition: int(base) + start,
+		EndPosition:   int(end),
+		Content:       tail[contentStart:contentEnd],
+	}, true, nil
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// Media bytes no container format claims, so marks go to the trailer
+var testTrailerMedia = []byte("AVI-DATA\x00\x01\x02<<==not a mark\xff\xfe")
+
+func TestTrailerRecordRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"short", "Alzk 890"},
+		{"owned", "studio" + WATERMARK_OWNER_SEPARATOR + "Alzk 890"},
+		{"UTF-8", "Tüssly 778 — 東京"},
+		{"longer than the plain window", strings.Repeat("long-payload ", 40)},
+		{"contains markers", "a==>>b<<==c"},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := buildTrailerRecord(tt.content)
+			path := writeTestFile(t, "clip.avi", append(append([]byte(nil), testTrailerMedia...), record...))
+
+			marks, err := readTrailerMarks(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(marks) != 1 || !marks[0].footer || string(marks[0].Content) != tt.content {
+				t.Fatalf("read %+v, want one record holding %q", marks, tt.content)
+			}
+			if marks[0].StartPosition != len(testTrailerMedia) || marks[0].EndPosition != len(testTrailerMedia)+len(record) {
+				t.Errorf("record at %d-%d, want %d-%d", marks[0].StartPosition, marks[0].EndPosition,
+					len(testTrailerMedia), len(testTrailerMedia)+len(record))
+			}
+		})
+	}
+}
+
+func TestTrailerChainMixedFormats(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	data := append([]byte(nil), testTrailerMedia...)
+	data = append(data, buildWatermark("plain-old")...)
+	data = append(data, buildTrailerRecord(long)...)
+	data = append(data, buildTrailerRecord("newest")...)
+	path := writeTestFile(t, "clip.avi", data)
+
+	marks, err := readTrailerMarks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		content string
+		footer  bool
+	}{{"plain-old", false}, {long, true}, {"newest", true}}
+	if len(marks) != len(want) {
+		t.Fatalf("read %d marks, want %d", len(marks), len(want))
+	}
+	for i, w := range want {
+		if string(marks[i].Content) != w.content || marks[i].footer != w.footer {
+			t.Errorf("mark %d = %q (footer %v), want %q (footer %v)", i, marks[i].Content, marks[i].footer, w.content, w.footer)
+		}
+	}
+}
+
+func TestTrailerAddAndRemove(t *testing.T) {
+	path := writeTestFile(t, "clip.avi", testTrailerMedia)
+	payloads := []string{"Alzk 890", strings.Repeat("ü", 200)}
+	for _, payload := range payloads {
+		if err := addWatermarkToChain(path, "studio", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	marks, err := ExtractWatermarks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(marks) != 2 || marks[0].Payload != payloads[0] || marks[1].Payload != payloads[1] || marks[1].Owner != "studio" {
+		t.Fatalf("extracted %+v", marks)
+	}
+
+	if removed, err := removeWatermarksMatching(path, WatermarkSelector{}); err != nil || removed != 2 {
+		t.Fatalf("removed %d, %v", removed, err)
+	}
+	if got := readTestFile(t, path); !bytes.Equal(got, testTrailerMedia) {
+		t.Errorf("cleaned file %q, want the original media", got)
+	}
+}
+
+func TestReadTrailerMarksMalformed(t *testing.T) {
+	// Long enough that no plain mark fits in the last MAX_WATERMARK_LENGTH bytes
+	content := strings.Repeat("p", 2*MAX_WATERMARK_LENGTH)
+	valid := buildTrailerRecord(content)
+	footer := len(valid) - WATERMARK_FOOTER_LENGTH
+	corrupt := func(edit func(record []byte)) []byte {
+		record := append([]byte(nil), valid...)
+		edit(record)
+		return record
+	}
+
+	tests := []struct {
+		name   string
+		record []byte
+	}{
+		{"bad CRC", corrupt(func(r []byte) { r[footer+7] ^= 1 })},
+		{"bad magic", corrupt(func(r []byte) { r[len(r)-1] = '2' })},
+		{"payload changed", corrupt(func(r []byte) { r[len(WATERMARK_START)] = 'q' })},
+		{"length too short", corrupt(func(r []byte) { binary.BigEndian.PutUint32(r[footer:], uint32(len(content)-1)) })},
+		{"length past start of file", corrupt(func(r []byte) { binary.BigEndian.PutUint32(r[footer:], 1<<20) })},
+		{"length over limit", corrupt(func(r []byte) { binary.BigEndian.PutUint32(r[footer:], 0xFFFFFFFF) })},
+		{"missing start marker", corrupt(func(r []byte) { r[0] = 'x' })},
+		{"missing end marker", corrupt(func(r []byte) { r[footer-1] = 'x' })},
+		{"footer only", valid[footer:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, "clip.avi", append(append([]byte(nil), testTrailerMedia...), tt.record...))
+			marks, err := readTrailerMarks(path)
+			if err != nil || len(marks) != 0 {
+				t.Errorf("read %d marks, %v; want none", len(marks), err)
+			}
+		})
+	}
+}
+
+func TestReadTrailerMarksTruncated(t *testing.T) {
+	data := append([]byte(nil), testTrailerMedia...)
+	data = append(data, buildTrailerRecord("first")...)
+	data = append(data, buildTrailerRecord(strings.Repeat("second ", 30))...)
+	for n := 0; n <= len(data); n++ {
+		path := writeTestFile(t, "clip.avi", data[:n])
+		if _, err := readTrailerMarks(path); err != nil {
+			t.Fatalf("prefix of %d bytes: %v", n, err)
+		}
+	}
+}
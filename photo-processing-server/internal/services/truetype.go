@@ -0,0 +1,228 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// TRUETYPE_DEFAULT_SIZE is the em size in pixels of TrueType text without a
+// relative style size; it roughly matches the height of the Hershey default
+const TRUETYPE_DEFAULT_SIZE = 12.0
+
+// trueTypeReferenceSize is the em size at which text is measured before scaling
+const trueTypeReferenceSize = 100.0
+
+// TrueTypeFont is a TTF/OTF font loaded from the fonts directory
+type TrueTypeFont struct {
+	Name     string `json:"name"`               // file name without extension, lower case
+	FullName string `json:"fullName,omitempty"` // name from the font's name table
+	Path     string `json:"-"`
+	font     *opentype.Font
+}
+
+// FontLibrary holds the fonts available to visible watermarks. Style fonts
+// that are not Hershey names are looked up here, by file name or full name.
+type FontLibrary struct {
+	mutex       sync.RWMutex
+	fonts       map[string]*TrueTypeFont
+	names       []string
+	defaultFont *TrueTypeFont
+}
+
+var (
+	globalFontLibrary *FontLibrary
+	fontLibraryOnce   sync.Once
+)
+
+// GetFontLibrary returns the global font library instance
+func GetFontLibrary() *FontLibrary {
+	fontLibraryOnce.Do(func() {
+		globalFontLibrary = &FontLibrary{fonts: map[string]*TrueTypeFont{}}
+	})
+	return globalFontLibrary
+}
+
+// Load reads every .ttf and .otf file under the directories of dirs, a list
+// separated like PATH. Missing directories are skipped. defaultName picks the
+// font used for text Hershey cannot draw; empty or unknown picks the first by name.
+func (l *FontLibrary) Load(dirs string, defaultName string) error {
+	logger := GetGlobalLogger()
+	fonts := map[string]*TrueTypeFont{}
+	var names []string
+	var failed []string
+
+	for _, dir := range filepath.SplitList(dirs) {
+		if dir == "" {
+			continue
+		}
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil // Continue on errors
+			}
+			ext := strings.ToLower(filepath.Ext(path))
+			if ext != ".ttf" && ext != ".otf" {
+				return nil
+			}
+			loaded, err := loadTrueTypeFont(path)
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", filepath.Base(path), err))
+				return nil
+			}
+			if _, exists := fonts[loaded.Name]; exists {
+				return nil // The first directory wins
+			}
+			fonts[loaded.Name] = loaded
+			names = append(names, loaded.Name)
+			if full := strings.ToLower(loaded.FullName); full != "" {
+				if _, exists := fonts[full]; !exists {
+					fonts[full] = loaded
+				}
+			}
+			return nil
+		})
+	}
+	sort.Strings(names)
+
+	var defaultFont *TrueTypeFont
+	var err error
+	if defaultName != "" {
+		if defaultFont = fonts[strings.ToLower(defaultName)]; defaultFont == nil {
+			err = fmt.Errorf("default font %q not found in %s", defaultName, dirs)
+		}
+	}
+	if defaultFont == nil && len(names) > 0 {
+		defaultFont = fonts[names[0]]
+	}
+
+	l.mutex.Lock()
+	l.fonts, l.names, l.defaultFont = fonts, names, defaultFont
+	l.mutex.Unlock()
+
+	for _, failure := range failed {
+		logger.Error(fmt.Sprintf("Skipping font %s", failure))
+	}
+	if len(names) > 0 {
+		logger.Log(fmt.Sprintf("Loaded %d TrueType fonts (default: %s)", len(names), defaultFont.Name))
+	}
+	return err
+}
+
+// loadTrueTypeFont parses one font file
+func loadTrueTypeFont(path string) (*TrueTypeFont, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := opentype.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	loaded := &TrueTypeFont{
+		Name: strings.ToLower(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))),
+		Path: path,
+		font: parsed,
+	}
+	loaded.FullName, _ = parsed.Name(nil, sfnt.NameIDFull)
+	return loaded, nil
+}
+
+// Lookup finds a font by file name or full name, case-insensitively
+func (l *FontLibrary) Lookup(name string) *TrueTypeFont {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.fonts[strings.ToLower(name)]
+}
+
+// Default returns the fallback font for text Hershey cannot draw, or nil
+func (l *FontLibrary) Default() *TrueTypeFont {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.defaultFont
+}
+
+// Fonts lists the loaded fonts sorted by name
+func (l *FontLibrary) Fonts() []*TrueTypeFont {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	fonts := make([]*TrueTypeFont, 0, len(l.names))
+	for _, name := range l.names {
+		fonts = append(fonts, l.fonts[name])
+	}
+	return fonts
+}
+
+// needsTrueType reports whether text has characters outside the ASCII range
+// of the Hershey fonts
+func needsTrueType(text string) bool {
+	for _, r := range text {
+		if r < 0x20 || r > 0x7e {
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether the font has a glyph for every character of text
+func (f *TrueTypeFont) covers(text string) bool {
+	var buf sfnt.Buffer
+	for _, r := range text {
+		if index, err := f.font.GlyphIndex(&buf, r); err != nil || (index == 0 && r > ' ') {
+			return false
+		}
+	}
+	return true
+}
+
+// face returns a face of the font at size pixels per em. Faces are not safe
+// for concurrent use, so every drawing creates its own.
+func (f *TrueTypeFont) face(size float64) (font.Face, error) {
+	return opentype.NewFace(f.font, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone})
+}
+
+// measure returns the advance width and cap height of text at size, in pixels
+func (f *TrueTypeFont) measure(text string, size float64) (float64, float64, error) {
+	face, err := f.face(size)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer face.Close()
+	metrics := face.Metrics()
+	height := metrics.CapHeight
+	if height <= 0 {
+		height = metrics.Ascent
+	}
+	advance := font.MeasureString(face, text)
+	return fixedToFloat(advance), fixedToFloat(height), nil
+}
+
+func fixedToFloat(v fixed.Int26_6) float64 {
+	return float64(v) / 64
+}
+
+// mask renders text with its baseline starting at origin into an
+// anti-aliased coverage mask, in image coordinates
+func (f *TrueTypeFont) mask(text string, size float64, origin image.Point) (*image.Alpha, error) {
+	face, err := f.face(size)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	drawer := &font.Drawer{Face: face, Src: image.Opaque, Dot: fixed.P(origin.X, origin.Y)}
+	bounds, _ := drawer.BoundString(text)
+	rect := image.Rect(bounds.Min.X.Floor(), bounds.Min.Y.Floor(), bounds.Max.X.Ceil(), bounds.Max.Y.Ceil())
+	mask := image.NewAlpha(rect)
+	drawer.Dst = mask
+	drawer.DrawString(text) // kerning comes from the face
+	return mask, nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// writeTestFont stores font data as name in dir
+func writeTestFont(t *testing.T, dir string, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNeedsTrueType(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"", false},
+		{"Project 042", false},
+		{" !~", false},
+		{"Müller", true},
+		{"Order — 042", true},
+		{"東京", true},
+		{"tab\there", true},
+		{"\x7f", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := needsTrueType(tt.text); got != tt.want {
+				t.Errorf("needsTrueType = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTrueTypeFont(t *testing.T) {
+	dir := t.TempDir()
+	loaded, err := loadTrueTypeFont(writeTestFont(t, dir, "GoRegular.ttf", goregular.TTF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != "goregular" || loaded.FullName != "Go Regular" || loaded.Path != filepath.Join(dir, "GoRegular.ttf") {
+		t.Errorf("loaded %q (%q) from %s", loaded.Name, loaded.FullName, loaded.Path)
+	}
+
+	coverage := []struct {
+		text string
+		want bool
+	}{
+		{"Project 042", true},
+		{"Müller — Ålesund", true},
+		{"Ωμέγα", true},
+		{"", true},
+		{"東京 042", false},
+		{"Project 042 \U0001F4F7", false},
+	}
+	for _, tt := range coverage {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := loaded.covers(tt.text); got != tt.want {
+				t.Errorf("covers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	small, smallCap, err := loaded.measure("Project 042", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, largeCap, _ := loaded.measure("Project 042", 40)
+	if small <= 0 || smallCap <= 0 || math.Abs(large-2*small) > 1 || math.Abs(largeCap-2*smallCap) > 1 {
+		t.Errorf("measured %.1f×%.1f at 20 px and %.1f×%.1f at 40 px", small, smallCap, large, largeCap)
+	}
+
+	for name, data := range map[string][]byte{"broken.ttf": []byte("not a font"), "empty.ttf": nil} {
+		if _, err := loadTrueTypeFont(writeTestFont(t, dir, name, data)); err == nil {
+			t.Errorf("%s was loaded", name)
+		}
+	}
+	if _, err := loadTrueTypeFont(filepath.Join(dir, "missing.ttf")); err == nil {
+		t.Error("missing font was loaded")
+	}
+}
+
+func TestFontLibraryLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFont(t, dir, "GoRegular.ttf", goregular.TTF)
+	writeTestFont(t, dir, "GoBold.OTF", gobold.TTF)
+	writeTestFont(t, dir, "broken.ttf", []byte("not a font"))
+	writeTestFont(t, dir, "readme.txt", []byte("fonts"))
+	dirs := dir + string(filepath.ListSeparator) + filepath.Join(dir, "missing")
+
+	tests := []struct {
+		name        string
+		defaultName string
+		wantDefault string
+		wantErr     bool
+	}{
+		{"first by name", "", "gobold", false},
+		{"by file name", "GoRegular", "goregular", false},
+		{"by full name", "go regular", "goregular", false},
+		{"unknown default", "comic", "gobold", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			library := &FontLibrary{}
+			if err := library.Load(dirs, tt.defaultName); (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, wantErr %v", err, tt.wantErr)
+			}
+			fonts := library.Fonts()
+			if len(fonts) != 2 || fonts[0].Name != "gobold" || fonts[1].Name != "goregular" {
+				t.Fatalf("loaded %d fonts", len(fonts))
+			}
+			if got := library.Default(); got == nil || got.Name != tt.wantDefault {
+				t.Errorf("default %v, want %s", got, tt.wantDefault)
+			}
+			if library.Lookup("GO BOLD") != fonts[0] || library.Lookup("goregular") != fonts[1] || library.Lookup("broken") != nil {
+				t.Error("lookup by file or full name failed")
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Integrity results: the file matches a delivered copy byte for byte, was
+// delivered but has changed since, or is not in the issuance registry
+const (
+	IntegrityMatch      = "match"
+	IntegrityModified   = "modified"
+	IntegrityUnrecorded = "unrecorded"
+)
+
+// Visible watermark results
+const (
+	VisiblePresent    = "present"
+	VisibleAbsent     = "absent"
+	VisibleNotChecked = "not_checked"
+)
+
+// FileVerification is one row of a verification report. Format, version
+// and MAC describe the newest mark of the file's chain.
+type FileVerification struct {
+	Path            string          `json:"path"`
+	Watermarked     bool            `json:"watermarked"`
+	Marks           int             `json:"marks"`
+	Format          string          `json:"format,omitempty"`
+	Version         string          `json:"version,omitempty"` // "v2" (keyed) or "caesar"
+	Structured      bool            `json:"structured"`
+	Status          WatermarkStatus `json:"status,omitempty"`
+	MACValid        *bool           `json:"macValid"` // nil when the payload carries no verifiable MAC
+	KeyID           string          `json:"keyId,omitempty"`
+	Text            string          `json:"text,omitempty"`
+	Integrity       string          `json:"integrity"`
+	RecordID        string          `json:"recordId,omitempty"`
+	Visible         string          `json:"visibleWatermark"`
+	VisibleText     string          `json:"visibleText,omitempty"`
+	VisibleContrast float64         `json:"visibleContrast,omitempty"`
+	Error           string          `json:"error,omitempty"`
+}
+
+// VerificationSummary counts report rows by outcome
+type VerificationSummary struct {
+	Total       int `json:"total"`
+	Watermarked int `json:"watermarked"`
+	ValidMAC    int `json:"validMac"`
+	InvalidMAC  int `json:"invalidMac"`
+	Matching    int `json:"matching"`
+	Modified    int `json:"modified"`
+	Visible     int `json:"visible"`
+	Errors      int `json:"errors"`
+}
+
+// VerificationReport is the result of verifying a folder
+type VerificationReport struct {
+	Folder      string              `json:"folder"`
+	GeneratedAt time.Time           `json:"generatedAt"`
+	Summary     VerificationSummary `json:"summary"`
+	Files       []FileVerification  `json:"files"`
+}
+
+// VerifyFolder verifies every supported file and document in folder
+func VerifyFolder(folder string, progress func(float64)) (*VerificationReport, error) {
+	files, err := GetMarkableFiles(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerificationReport{
+		Folder:      filepath.Base(folder),
+		GeneratedAt: time.Now().UTC(),
+		Files:       make([]FileVerification, 0, len(files)),
+	}
+	for i, file := range files {
+		rel, err := filepath.Rel(folder, file)
+		if err != nil {
+			rel = filepath.Base(file)
+		}
+		row := VerifyFile(file, filepath.ToSlash(rel))
+		report.Files = append(report.Files, row)
+		report.Summary.add(row)
+
+		if progress != nil {
+			progress(float64(i+1) / float64(len(files)))
+		}
+	}
+	return report, nil
+}
+
+// VerifyFile checks one file's marks, MAC, recorded hash and visible watermark.
+// rel is the path reported and matched against registry file paths.
+func VerifyFile(filePath string, rel string) FileVerification {
+	row := FileVerification{Path: rel, Integrity: IntegrityUnrecorded, Visible: VisibleNotChecked}
+
+	marks, err := ExtractWatermarks(filePath)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	row.Marks = len(marks)
+	row.Watermarked = len(marks) > 0
+
+	orderNumber := ""
+	if row.Watermarked {
+		newest := marks[len(marks)-1]
+		fields, text, status := DecodeStructuredPayload(newest.Payload)
+		row.Format = newest.Format
+		row.Version = "caesar"
+		if IsKeyedPayload(newest.Payload) {
+			row.Version = "v2"
+		}
+		row.Status = status
+		row.KeyID = PayloadKeyID(newest.Payload)
+		row.MACValid = macValidity(status)
+		row.Text = text
+		if fields != nil {
+			row.Structured = true
+			row.Text = fields.Text()
+			orderNumber = fields.OrderID
+		} else if status == WatermarkValid || status == WatermarkLegacy {
+			_, orderNumber = splitWatermarkText(text)
+		}
+	}
+
+	record := verifyIntegrity(&row, filePath)
+
+	// The registry knows the stamped text; otherwise it defaults to the order number
+	if IsImageFile(filePath) {
+		expected := orderNumber
+		var style *VisibleWatermarkStyle
+		if record != nil {
+			expected, style = recordedVisibleText(record, row.Path), record.VisibleStyle
+		}
+		if expected != "" {
+			present, contrast, err := DetectVisibleText(filePath, expected, style.TextPosition(), style)
+			if err != nil {
+				row.Error = err.Error()
+			} else {
+				row.Visible = VisibleAbsent
+				if present {
+					row.Visible = VisiblePresent
+				}
+				row.VisibleText = expected
+				row.VisibleContrast = contrast
+			}
+		}
+	}
+	return row
+}
+
+// recordedVisibleText returns the visible text stamped on the file at rel,
+// or "" for photos that were not stamped, which are not checked
+func recordedVisibleText(record *IssuedWatermark, rel string) string {
+	for _, file := range record.Files {
+		if file.VisibleText != "" && issuedPathMatches(rel, file.Path) {
+			return file.VisibleText
+		}
+	}
+	return ""
+}
+
+// macValidity maps a payload status to MAC validity (nil when not checkable)
+func macValidity(status WatermarkStatus) *bool {
+	var valid bool
+	switch status {
+	case WatermarkValid:
+		valid = true
+	case WatermarkTampered, WatermarkForged:
+		valid = false
+	default:
+		return nil
+	}
+	return &valid
+}
+
+// verifyIntegrity compares the file with the hash recorded at issuance, first
+// by exact hash, then by the record of its watermark text and file path
+func verifyIntegrity(row *FileVerification, filePath string) *IssuedWatermark {
+	sum, err := fileSHA256(filePath)
+	if err != nil {
+		row.Error = err.Error()
+		return nil
+	}
+	registry := GetIssuanceRegistry()
+
+	if records, err := registry.List(IssuanceFilter{SHA256: sum}); err == nil && len(records) > 0 {
+		row.Integrity = IntegrityMatch
+		row.RecordID = records[0].ID
+		return &records[0]
+	}
+	if row.Text == "" {
+		return nil
+	}
+	records, err := registry.List(IssuanceFilter{Text: row.Text})
+	if err != nil {
+		return nil
+	}
+	for i := range records {
+		for _, file := range records[i].Files {
+			if issuedPathMatches(row.Path, file.Path) {
+				row.Integrity = IntegrityModified
+				row.RecordID = records[i].ID
+				return &records[i]
+			}
+		}
+	}
+	return nil
+}
+
+// issuedPathMatches reports whether a verified relative path is the same file
+// as a registry path, allowing for the verified folder being a parent or child
+// of the delivered copy folder
+func issuedPathMatches(rel string, issued string) bool {
+	return rel == issued || strings.HasSuffix(rel, "/"+issued) || strings.HasSuffix(issued, "/"+rel)
+}
+
+func (s *VerificationSummary) add(row FileVerification) {
+	s.Total++
+	if row.Watermarked {
+		s.Watermarked++
+	}
+	if row.MACValid != nil {
+		if *row.MACValid {
+			s.ValidMAC++
+		} else {
+			s.InvalidMAC++
+		}
+	}
+	switch row.Integrity {
+	case IntegrityMatch:
+		s.Matching++
+	case IntegrityModified:
+		s.Modified++
+	}
+	if row.Visible == VisiblePresent {
+		s.Visible++
+	}
+	if row.Error != "" {
+		s.Errors++
+	}
+}
+
+// WriteCSV writes one line per file with a header row
+func (r *VerificationReport) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	header := []string{"path", "watermarked", "marks", "format", "version", "structured", "status",
+		"mac_valid", "key_id", "text", "integrity", "record_id", "visible_watermark", "visible_text",
+		"visible_contrast", "error"}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	for _, row := range r.Files {
+		macValid := ""
+		if row.MACValid != nil {
+			macValid = strconv.FormatBool(*row.MACValid)
+		}
+		record := []string{
+			row.Path,
+			strconv.FormatBool(row.Watermarked),
+			strconv.Itoa(row.Marks),
+			row.Format,
+			row.Version,
+			strconv.FormatBool(row.Structured),
+			string(row.Status),
+			macValid,
+			row.KeyID,
+			row.Text,
+			row.Integrity,
+			row.RecordID,
+			row.Visible,
+			row.VisibleText,
+			fmt.Sprintf("%.1f", row.VisibleContrast),
+			row.Error,
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
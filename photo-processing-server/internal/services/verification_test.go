@@ -0,0 +1,164 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// useIssuanceRegistry points the global registry at a temporary file and
+// empties it again when the test ends
+func useIssuanceRegistry(t *testing.T) *IssuanceRegistry {
+	t.Helper()
+	registry := GetIssuanceRegistry()
+	if err := registry.Configure(filepath.Join(t.TempDir(), "issuance.jsonl")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { registry.Configure("") })
+	return registry
+}
+
+// markedTestFile writes media under name and appends a mark carrying payload
+func markedTestFile(t *testing.T, name string, media []byte, payload string) string {
+	t.Helper()
+	path := writeTestFile(t, name, media)
+	if payload != "" {
+		if err := addWatermarkToChain(path, "", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestVerifyFileIntegrity(t *testing.T) {
+	useWatermarkSecret(t, "test-secret")
+	registry := useIssuanceRegistry(t)
+
+	delivered := markedTestFile(t, "clip.avi", testTrailerMedia, EncodePayload("Project Alpha 042"))
+	sum, err := fileSHA256(delivered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := &IssuedWatermark{ID: "copy-2", OrderNumber: "042", CopyNumber: 2, Text: "Project Alpha 042",
+		Files: []IssuedFile{{Path: "photos/clip.avi", SHA256: sum}}}
+	if err := registry.Record(record); err != nil {
+		t.Fatal(err)
+	}
+	edited := markedTestFile(t, "clip.avi", []byte("AVI-EDITED"), EncodePayload("Project Alpha 042"))
+	other := markedTestFile(t, "clip.avi", testTrailerMedia, EncodePayload("Project Alpha 043"))
+	unmarked := markedTestFile(t, "clip.avi", testTrailerMedia, "")
+
+	tests := []struct {
+		name          string
+		path, rel     string
+		wantIntegrity string
+		wantRecord    string
+		wantMarks     int
+	}{
+		{"delivered bytes", delivered, "elsewhere.avi", IntegrityMatch, "copy-2", 1},
+		{"edited, verified from the copy folder", edited, "photos/clip.avi", IntegrityModified, "copy-2", 1},
+		{"edited, verified from a parent folder", edited, "copy-2/photos/clip.avi", IntegrityModified, "copy-2", 1},
+		{"edited, verified from a child folder", edited, "clip.avi", IntegrityModified, "copy-2", 1},
+		{"edited, other file name", edited, "photos/other.avi", IntegrityUnrecorded, "", 1},
+		{"unrecorded text", other, "photos/clip.avi", IntegrityUnrecorded, "", 1},
+		{"no mark", unmarked, "photos/clip.avi", IntegrityUnrecorded, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := VerifyFile(tt.path, tt.rel)
+			if row.Error != "" {
+				t.Fatal(row.Error)
+			}
+			if row.Integrity != tt.wantIntegrity || row.RecordID != tt.wantRecord {
+				t.Errorf("integrity %s of %q, want %s of %q", row.Integrity, row.RecordID, tt.wantIntegrity, tt.wantRecord)
+			}
+			if row.Path != tt.rel || row.Marks != tt.wantMarks || row.Watermarked != (tt.wantMarks > 0) {
+				t.Errorf("row %+v", row)
+			}
+			if row.Visible != VisibleNotChecked {
+				t.Errorf("visible %s on a non-image", row.Visible)
+			}
+		})
+	}
+
+	row := VerifyFile(delivered, "clip.avi")
+	if row.Version != "v2" || row.Status != WatermarkValid || row.KeyID != DEFAULT_KEY_ID ||
+		row.MACValid == nil || !*row.MACValid || row.Text != "Project Alpha 042" || row.Structured {
+		t.Errorf("mark fields %+v", row)
+	}
+}
+
+func TestIssuedPathMatches(t *testing.T) {
+	tests := []struct {
+		rel, issued string
+		want        bool
+	}{
+		{"photos/a.jpg", "photos/a.jpg", true},
+		{"copy-1/photos/a.jpg", "photos/a.jpg", true}, // verified a parent of the copy folder
+		{"a.jpg", "photos/a.jpg", true},               // verified a child of the copy folder
+		{"photos/a.jpg", "other/a.jpg", false},
+		{"photos/xa.jpg", "a.jpg", false},
+		{"xa.jpg", "photos/a.jpg", false},
+		{"a.jpg", "b.jpg", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rel+" "+tt.issued, func(t *testing.T) {
+			if got := issuedPathMatches(tt.rel, tt.issued); got != tt.want {
+				t.Errorf("matches %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMacValidity(t *testing.T) {
+	valid, invalid := true, false
+	tests := []struct {
+		status WatermarkStatus
+		want   *bool
+	}{
+		{WatermarkValid, &valid},
+		{WatermarkTampered, &invalid},
+		{WatermarkForged, &invalid},
+		{WatermarkLegacy, nil},
+		{WatermarkNoKey, nil},
+		{WatermarkUnknownKey, nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			if got := macValidity(tt.status); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validity %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerificationReportWriteCSV(t *testing.T) {
+	valid := true
+	report := &VerificationReport{Files: []FileVerification{
+		{Path: "photos/a.jpg", Watermarked: true, Marks: 2, Format: "trailer record", Version: "v2", Structured: true,
+			Status: WatermarkValid, MACValid: &valid, KeyID: DEFAULT_KEY_ID, Text: "Project, \"Alpha\" 042",
+			Integrity: IntegrityMatch, RecordID: "copy-2", Visible: VisiblePresent, VisibleText: "042", VisibleContrast: 41.26},
+		{Path: "notes.txt", Integrity: IntegrityUnrecorded, Visible: VisibleNotChecked, Error: "read failed"},
+	}}
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"path", "watermarked", "marks", "format", "version", "structured", "status", "mac_valid", "key_id", "text",
+			"integrity", "record_id", "visible_watermark", "visible_text", "visible_contrast", "error"},
+		{"photos/a.jpg", "true", "2", "trailer record", "v2", "true", "valid", "true", "default", "Project, \"Alpha\" 042",
+			"match", "copy-2", "present", "042", "41.3", ""},
+		{"notes.txt", "false", "0", "", "", "false", "", "", "", "", "unrecorded", "", "not_checked", "", "0.0", "read failed"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("CSV rows\n%q\nwant\n%q", rows, want)
+	}
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// VisibleWatermarkStyle controls how visible watermark text is drawn. The
+// zero value (or a nil style) keeps the original look: small white Hershey
+// Simplex text added at half strength. Any other style is alpha-blended,
+// so dark colours work on bright photos.
+type VisibleWatermarkStyle struct {
+	// Font is a VISIBLE_FONTS name or a TrueType font of the font library,
+	// "simplex" by default. Text Hershey cannot draw falls back to the
+	// library's default font.
+	Font   string `json:"font,omitempty"`
+	Italic bool   `json:"italic,omitempty"` // slanted variant of a Hershey Font
+	// Size is the text height as a fraction of the shorter image side, so a
+	// style looks the same on thumbnails and 50 MP originals; 0 keeps FONT_SCALE
+	Size    float64 `json:"size,omitempty"`
+	Color   string  `json:"color,omitempty"`   // "#RRGGBB" or "#RRGGBBAA", white by default
+	Opacity float64 `json:"opacity,omitempty"` // 0-1, multiplied by the colour's alpha; 0 means ALPHA
+	// Outline draws a stroke of that many pixels around each glyph
+	Outline      int    `json:"outline,omitempty"`
+	OutlineColor string `json:"outlineColor,omitempty"` // black by default
+	// Shadow draws a drop shadow offset by that many pixels right and down
+	Shadow      int    `json:"shadow,omitempty"`
+	ShadowColor string `json:"shadowColor,omitempty"` // black by default
+	Padding     int    `json:"padding,omitempty"`     // distance from the image edge in pixels; 0 means PADDING
+	// Position is one of the VISIBLE_POSITIONS names, "bottom-right" by
+	// default. "tiled" repeats the text across the whole image, rotated by
+	// Angle degrees counter-clockwise (TILED_DEFAULT_ANGLE when nil) with
+	// Spacing between neighbours as a fraction of the shorter image side.
+	Position string   `json:"position,omitempty"`
+	Angle    *float64 `json:"angle,omitempty"`
+	Spacing  float64  `json:"spacing,omitempty"`
+}
+
+// Limits of VisibleWatermarkStyle values
+const (
+	MAX_VISIBLE_TEXT_SIZE = 0.5
+	MAX_VISIBLE_STROKE    = 200 // outline and shadow, in pixels
+	MAX_VISIBLE_PADDING   = 2000
+)
+
+// VISIBLE_FONTS maps style font names to OpenCV Hershey fonts
+var VISIBLE_FONTS = map[string]gocv.HersheyFont{
+	"simplex":        gocv.FontHersheySimplex,
+	"plain":          gocv.FontHersheyPlain,
+	"duplex":         gocv.FontHersheyDuplex,
+	"complex":        gocv.FontHersheyComplex,
+	"triplex":        gocv.FontHersheyTriplex,
+	"complex-small":  gocv.FontHersheyComplexSmall,
+	"script-simplex": gocv.FontHersheyScriptSimplex,
+	"script-complex": gocv.FontHersheyScriptComplex,
+}
+
+// VISIBLE_POSITIONS maps style position names to text positions
+var VISIBLE_POSITIONS = map[string]TextPosition{
+	"top-left":     TopLeft,
+	"top-right":    TopRight,
+	"center":       Center,
+	"bottom-left":  BottomLeft,
+	"bottom-right": BottomRight,
+	"tiled":        Tiled,
+}
+
+var BLACK_COLOR = color.RGBA{A: 255}
+
+// isDefault reports whether s draws the original additive white text
+func (s *VisibleWatermarkStyle) isDefault() bool {
+	return s == nil || *s == VisibleWatermarkStyle{}
+}
+
+// Validate checks names, colours and ranges; a nil style is valid
+func (s *VisibleWatermarkStyle) Validate() error {
+	if s == nil {
+		return nil
+	}
+	if _, ok := VISIBLE_FONTS[s.fontName()]; !ok && GetFontLibrary().Lookup(s.fontName()) == nil {
+		return fmt.Errorf("unknown visible watermark font %q", s.Font)
+	}
+	if s.Size < 0 || s.Size > MAX_VISIBLE_TEXT_SIZE {
+		return fmt.Errorf("visible watermark size must be between 0 and %g", MAX_VISIBLE_TEXT_SIZE)
+	}
+	if s.Opacity < 0 || s.Opacity > 1 {
+		return fmt.Errorf("visible watermark opacity must be between 0 and 1")
+	}
+	if s.Outline < 0 || s.Outline > MAX_VISIBLE_STROKE || s.Shadow < 0 || s.Shadow > MAX_VISIBLE_STROKE {
+		return fmt.Errorf("visible watermark outline and shadow must be between 0 and %d pixels", MAX_VISIBLE_STROKE)
+	}
+	if s.Padding < 0 || s.Padding > MAX_VISIBLE_PADDING {
+		return fmt.Errorf("visible watermark padding must be between 0 and %d pixels", MAX_VISIBLE_PADDING)
+	}
+	if _, ok := VISIBLE_POSITIONS[s.positionName()]; !ok {
+		return fmt.Errorf("unknown visible watermark position %q", s.Position)
+	}
+	if s.Angle != nil && (*s.Angle < -360 || *s.Angle > 360) {
+		return fmt.Errorf("visible watermark angle must be between -360 and 360 degrees")
+	}
+	if s.Spacing < 0 || s.Spacing > MAX_TILED_SPACING {
+		return fmt.Errorf("visible watermark spacing must be between 0 and %g", MAX_TILED_SPACING)
+	}
+	for _, c := range []string{s.Color, s.OutlineColor, s.ShadowColor} {
+		if _, err := parseStyleColor(c, WHITE_COLOR); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *VisibleWatermarkStyle) positionName() string {
+	if s == nil || s.Position == "" {
+		return "bottom-right"
+	}
+	return strings.ToLower(s.Position)
+}
+
+// TextPosition returns where the text goes; a nil style keeps BottomRight
+func (s *VisibleWatermarkStyle) TextPosition() TextPosition {
+	if position, ok := VISIBLE_POSITIONS[s.positionName()]; ok {
+		return position
+	}
+	return BottomRight
+}
+
+// textSize is the relative text height at position, 0 for FONT_SCALE
+func (s *VisibleWatermarkStyle) textSize(position TextPosition) float64 {
+	if s != nil && s.Size > 0 {
+		return s.Size
+	}
+	if position == Tiled {
+		return TILED_DEFAULT_SIZE
+	}
+	return 0
+}
+
+func (s *VisibleWatermarkStyle) fontName() string {
+	if s == nil || s.Font == "" {
+		return "simplex"
+	}
+	return strings.ToLower(s.Font)
+}
+
+// font returns the OpenCV font including the italic flag
+func (s *VisibleWatermarkStyle) font() gocv.HersheyFont {
+	font, ok := VISIBLE_FONTS[s.fontName()]
+	if !ok {
+		font = FONT_FACE
+	}
+	if s != nil && s.Italic {
+		font |= gocv.FontItalic
+	}
+	return font
+}
+
+// trueTypeFont returns the TrueType font to draw text with, or nil for
+// Hershey. Characters missing from the chosen font switch to the library's
+// default font when that one has them.
+func (s *VisibleWatermarkStyle) trueTypeFont(text string) *TrueTypeFont {
+	library := GetFontLibrary()
+	var chosen *TrueTypeFont
+	if _, hershey := VISIBLE_FONTS[s.fontName()]; !hershey {
+		chosen = library.Lookup(s.fontName())
+	} else if !needsTrueType(text) {
+		return nil
+	}
+	if chosen == nil || !chosen.covers(text) {
+		if fallback := library.Default(); fallback != nil && (chosen == nil || fallback.covers(text)) {
+			chosen = fallback
+		}
+	}
+	return chosen
+}
+
+// opacity is the blend weight of the text, including the colour's alpha
+func (s *VisibleWatermarkStyle) opacity() float64 {
+	opacity := s.Opacity
+	if opacity == 0 {
+		opacity = ALPHA
+	}
+	c, _ := parseStyleColor(s.Color, WHITE_COLOR)
+	return opacity * float64(c.A) / 255
+}
+
+// parseStyleColor parses "#RRGGBB" or "#RRGGBBAA"; empty returns fallback
+func parseStyleColor(value string, fallback color.RGBA) (color.RGBA, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q, expected #RRGGBB or #RRGGBBAA", value)
+	}
+	return color.RGBA{R: uint8(n >> 24), G: uint8(n >> 16), B: uint8(n >> 8), A: uint8(n)}, nil
+}
+
+// visibleTextLayout is how a text is placed on one image
+type visibleTextLayout struct {
+	font      gocv.HersheyFont
+	scale     float64
+	thickness int
+	trueType  *TrueTypeFont // set instead of font for TrueType text
+	pixelSize float64       // em size of TrueType text
+	padding   int
+	size      image.Point
+	origin    image.Point
+}
+
+// layoutVisibleText sizes and positions text for a width×height image. A
+// relative size is shrunk when the text would not fit the image width.
+func layoutVisibleText(style *VisibleWatermarkStyle, text string, width int, height int, position TextPosition) visibleTextLayout {
+	layout := visibleTextLayout{font: style.font(), scale: FONT_SCALE, thickness: THICKNESS, padding: PADDING}
+	if style != nil && style.Padding > 0 {
+		layout.padding = style.Padding
+	}
+	if layout.trueType = style.trueTypeFont(text); layout.trueType != nil {
+		return layoutTrueTypeText(layout, style, text, width, height, position)
+	}
+
+	if relative := style.textSize(position); relative > 0 {
+		unit := gocv.GetTextSize(text, layout.font, 1, 1)
+		if unit.X > 0 && unit.Y > 0 {
+			short := math.Min(float64(width), float64(height))
+			layout.scale = relative * short / float64(unit.Y)
+			if room := float64(width - 2*layout.padding - 2*style.Outline - style.Shadow); room > 0 && layout.scale*float64(unit.X) > room {
+				layout.scale = room / float64(unit.X)
+			}
+			// Hershey strokes look right at about 1.5 pixels per unit of scale
+			layout.thickness = int(math.Max(THICKNESS, math.Round(layout.scale*1.5)))
+		}
+	}
+
+	layout.size = gocv.GetTextSize(text, layout.font, layout.scale, layout.thickness)
+	layout.origin = textOrigin(width, height, layout.size, layout.padding, position)
+	return layout
+}
+
+// layoutTrueTypeText sizes TrueType text like layoutVisibleText sizes Hershey
+// text; the size is the cap height, as for Hershey fonts
+func layoutTrueTypeText(layout visibleTextLayout, style *VisibleWatermarkStyle, text string, width int, height int, position TextPosition) visibleTextLayout {
+	layout.pixelSize = TRUETYPE_DEFAULT_SIZE
+	if relative := style.textSize(position); relative > 0 {
+		advance, capHeight, err := layout.trueType.measure(text, trueTypeReferenceSize)
+		if err == nil && advance > 0 && capHeight > 0 {
+			short := math.Min(float64(width), float64(height))
+			layout.pixelSize = trueTypeReferenceSize * relative * short / capHeight
+			if room := float64(width - 2*layout.padding - 2*style.Outline - style.Shadow); room > 0 && advance*layout.pixelSize/trueTypeReferenceSize > room {
+				layout.pixelSize = trueTypeReferenceSize * room / advance
+			}
+		}
+	}
+
+	advance, capHeight, _ := layout.trueType.measure(text, layout.pixelSize)
+	layout.size = image.Point{X: int(math.Ceil(advance)), Y: int(math.Ceil(capHeight))}
+	layout.origin = textOrigin(width, height, layout.size, layout.padding, position)
+	return layout
+}
+
+// drawStyledText alpha-blends text drawn with style onto img
+func drawStyledText(img *gocv.Mat, text string, layout visibleTextLayout, style *VisibleWatermarkStyle) {
+	fill, _ := parseStyleColor(style.Color, WHITE_COLOR)
+	fill.A = 255
+
+	// Draw on a copy of the image so untouched pixels blend to themselves
+	overlay := img.Clone()
+	defer overlay.Close()
+	if style.Shadow > 0 {
+		shadow, _ := parseStyleColor(style.ShadowColor, BLACK_COLOR)
+		shadow.A = 255
+		offset := image.Point{X: style.Shadow, Y: style.Shadow}
+		gocv.PutText(&overlay, text, layout.origin.Add(offset), layout.font, layout.scale, shadow, layout.thickness+2*style.Outline)
+	}
+	if style.Outline > 0 {
+		outline, _ := parseStyleColor(style.OutlineColor, BLACK_COLOR)
+		outline.A = 255
+		gocv.PutText(&overlay, text, layout.origin, layout.font, layout.scale, outline, layout.thickness+2*style.Outline)
+	}
+	gocv.PutText(&overlay, text, layout.origin, layout.font, layout.scale, fill, layout.thickness)
+
+	opacity := style.opacity()
+	gocv.AddWeighted(overlay, opacity, *img, 1-opacity, 0.0, img)
+}
+
+// expectsDarkText reports whether style draws text darker than mid-grey,
+// which lowers rather than raises the brightness of text pixels
+func (s *VisibleWatermarkStyle) expectsDarkText() bool {
+	if s.isDefault() {
+		return false
+	}
+	c, _ := parseStyleColor(s.Color, WHITE_COLOR)
+	return 0.299*float64(c.R)+0.587*float64(c.G)+0.114*float64(c.B) < 128
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseStyleColor(t *testing.T) {
+	fallback := color.RGBA{R: 1, G: 2, B: 3, A: 4}
+	tests := []struct {
+		value   string
+		want    color.RGBA
+		wantErr bool
+	}{
+		{"", fallback, false},
+		{"#FF8000", color.RGBA{R: 255, G: 128, A: 255}, false},
+		{"ff8000", color.RGBA{R: 255, G: 128, A: 255}, false},
+		{"#00000080", color.RGBA{A: 128}, false},
+		{"#abcdef00", color.RGBA{R: 0xab, G: 0xcd, B: 0xef}, false},
+		{"#fff", color.RGBA{}, true},
+		{"#ff800", color.RGBA{}, true},
+		{"#ff80000", color.RGBA{}, true},
+		{"#ff8000ff0", color.RGBA{}, true},
+		{"#gg8000", color.RGBA{}, true},
+		{"#-f8000", color.RGBA{}, true},
+		{"white", color.RGBA{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseStyleColor(tt.value, fallback)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("colour %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVisibleWatermarkStyleValidate(t *testing.T) {
+	angle := func(degrees float64) *float64 { return &degrees }
+	tests := []struct {
+		name    string
+		style   *VisibleWatermarkStyle
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"zero", &VisibleWatermarkStyle{}, false},
+		{"Hershey font any case", &VisibleWatermarkStyle{Font: "Script-Complex", Italic: true}, false},
+		{"unknown font", &VisibleWatermarkStyle{Font: "comic"}, true},
+		{"largest size", &VisibleWatermarkStyle{Size: MAX_VISIBLE_TEXT_SIZE}, false},
+		{"size too large", &VisibleWatermarkStyle{Size: MAX_VISIBLE_TEXT_SIZE + 0.01}, true},
+		{"negative size", &VisibleWatermarkStyle{Size: -0.01}, true},
+		{"full opacity", &VisibleWatermarkStyle{Opacity: 1}, false},
+		{"opacity too high", &VisibleWatermarkStyle{Opacity: 1.01}, true},
+		{"negative opacity", &VisibleWatermarkStyle{Opacity: -0.1}, true},
+		{"widest outline and shadow", &VisibleWatermarkStyle{Outline: MAX_VISIBLE_STROKE, Shadow: MAX_VISIBLE_STROKE}, false},
+		{"outline too wide", &VisibleWatermarkStyle{Outline: MAX_VISIBLE_STROKE + 1}, true},
+		{"negative outline", &VisibleWatermarkStyle{Outline: -1}, true},
+		{"shadow too wide", &VisibleWatermarkStyle{Shadow: MAX_VISIBLE_STROKE + 1}, true},
+		{"negative shadow", &VisibleWatermarkStyle{Shadow: -1}, true},
+		{"largest padding", &VisibleWatermarkStyle{Padding: MAX_VISIBLE_PADDING}, false},
+		{"padding too large", &VisibleWatermarkStyle{Padding: MAX_VISIBLE_PADDING + 1}, true},
+		{"negative padding", &VisibleWatermarkStyle{Padding: -1}, true},
+		{"position any case", &VisibleWatermarkStyle{Position: "Top-Left"}, false},
+		{"tiled", &VisibleWatermarkStyle{Position: "tiled"}, false},
+		{"unknown position", &VisibleWatermarkStyle{Position: "middle"}, true},
+		{"angle at limits", &VisibleWatermarkStyle{Position: "tiled", Angle: angle(-360)}, false},
+		{"angle too large", &VisibleWatermarkStyle{Position: "tiled", Angle: angle(360.5)}, true},
+		{"angle too small", &VisibleWatermarkStyle{Position: "tiled", Angle: angle(-361)}, true},
+		{"widest spacing", &VisibleWatermarkStyle{Position: "tiled", Spacing: MAX_TILED_SPACING}, false},
+		{"spacing too wide", &VisibleWatermarkStyle{Position: "tiled", Spacing: MAX_TILED_SPACING + 0.1}, true},
+		{"negative spacing", &VisibleWatermarkStyle{Spacing: -0.1}, true},
+		{"colours", &VisibleWatermarkStyle{Color: "#000000", OutlineColor: "#ffffff80", ShadowColor: "#333333"}, false},
+		{"invalid colour", &VisibleWatermarkStyle{Color: "black"}, true},
+		{"invalid outline colour", &VisibleWatermarkStyle{OutlineColor: "#12345"}, true},
+		{"invalid shadow colour", &VisibleWatermarkStyle{ShadowColor: "#1234567"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.style.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
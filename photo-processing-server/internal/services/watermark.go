@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 const (
@@ -25,103 +26,79 @@ type WatermarkInfo struct {
 
 // RemoveWatermarks removes invisible watermarks from all files in directory (exact port from Kotlin)
 func RemoveWatermarks(directory string, progress func(float32)) error {
-	logger := GetGlobalLogger()
-	
-	// Get all supported media files
-	var files []string
-	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Continue on errors
-		}
-		
-		if !info.IsDir() && (IsImageFile(path) || IsVideoFile(path)) {
-			files = append(files, path)
-		}
-		return nil
-	})
-	
-	if err != nil {
-		logger.Error(fmt.Sprintf("Error during watermark removal process: %v", err))
-		return err
-	}
-	
-	processedFiles := 0.0
-	totalFiles := float32(len(files))
-	
-	for _, file := range files {
-		removed, err := removeWatermarkFromFile(file)
-		if err != nil {
-			logger.Error(fmt.Sprintf("Error removing watermark from %s: %v", filepath.Base(file), err))
-		} else if removed {
-			logger.Log(fmt.Sprintf("Watermark removed from %s", filepath.Base(file)))
-		} else {
-			logger.Log(fmt.Sprintf("No watermark found in %s", filepath.Base(file)))
-		}
-		
-		processedFiles++
-		if progress != nil {
-			progress(float32(processedFiles) / totalFiles)
-		}
-	}
-	
-	logger.Log("Watermark removal completed")
-	return nil
+	return RemoveSelectedWatermarks(directory, WatermarkSelector{}, progress)
 }
 
-// ExtractWatermarkText extracts encoded text from watermark (exact port from Kotlin)
+// RemoveSelectedWatermarks removes the marks picked by selector from every
+// media and document file in directory, leaving the rest of each file's chain in place
+func RemoveSelectedWatermarks(directory string, selector WatermarkSelector, progress func(float32)) error {
+	_, err := CleanWatermarks(directory, selector, RemovalOptions{}, progress)
+	return err
+}
+
+// ExtractWatermarkText extracts encoded text of the newest watermark.
+// Container-embedded marks take precedence over legacy trailer marks.
 func ExtractWatermarkText(filePath string) (string, error) {
-	tailData, _, err := readWatermarkData(filePath)
+	marks, err := ExtractWatermarks(filePath)
 	if err != nil {
 		return "", err
 	}
 	
-	if tailData == nil {
-		return "", nil
-	}
-	
-	watermarkInfo := findWatermark(tailData, true)
-	if watermarkInfo == nil {
+	if len(marks) == 0 {
 		return "", nil
 	}
 	
-	if watermarkInfo.Content != nil {
-		result := string(watermarkInfo.Content)
-		logger := GetGlobalLogger()
-		logger.Log(fmt.Sprintf("Found watermark in %s: %s", filepath.Base(filePath), result))
-		return result, nil
-	}
-	
-	return "", nil
+	result := marks[len(marks)-1].Payload
+	_, status := DecodePayload(result)
+	logger := GetGlobalLogger()
+	logger.Log(fmt.Sprintf("Found watermark in %s: %s (%s)", filepath.Base(filePath), result, status))
+	return result, nil
 }
 
-// HasWatermark checks if file has a watermark (exact port from Kotlin)
+// HasWatermark checks if file has a watermark in its container or trailer
 func HasWatermark(filePath string) (bool, error) {
-	tailData, _, err := readWatermarkData(filePath)
+	marks, err := ExtractWatermarks(filePath)
 	if err != nil {
 		return false, err
 	}
-	
-	if tailData == nil {
-		return false, nil
-	}
-	
-	watermarkInfo := findWatermark(tailData, false)
-	return watermarkInfo != nil, nil
+	return len(marks) > 0, nil
 }
 
-// AddBinaryWatermark adds encoded binary watermark to file (exact port from Kotlin)
+// AddBinaryWatermark adds encoded binary watermark to file (exact port from Kotlin).
+// Existing marks are kept; the new mark is appended to the chain.
 func AddBinaryWatermark(filePath string, encodedText string) error {
+	return addWatermarkToChain(filePath, "", encodedText)
+}
+
+// addWatermarkToChain appends a mark unless the same owner already holds the same payload
+func addWatermarkToChain(filePath string, owner string, encodedText string) error {
 	logger := GetGlobalLogger()
 	
 	// Check if watermark already exists
-	hasWM, err := HasWatermark(filePath)
+	marks, err := ExtractWatermarks(filePath)
 	if err != nil {
 		return err
 	}
 	
-    if hasWM {
-		logger.Log(fmt.Sprintf("%s: Already has watermark", filepath.Base(filePath)))
-		return nil
+	for _, mark := range marks {
+		if mark.Owner == owner && mark.Payload == encodedText {
+			logger.Log(fmt.Sprintf("%s: Already has watermark", filepath.Base(filePath)))
+			return nil
+		}
+	}
+	
+	// Create watermark: WATERMARK_START + [owner + separator] + encodedText + WATERMARK_END
+	content := ownedPayload(owner, encodedText)
+	watermark := buildWatermark(content)
+	
+	// Prefer embedding inside the container structure when the format is known
+	if container := containerFormatFor(filePath); container != nil {
+		err = container.embed(filePath, watermark)
+		if err == nil {
+			logger.Log(fmt.Sprintf("%s: Watermark added successfully (%s, %d in chain)", filepath.Base(filePath), container.name(), len(marks)+1))
+			return nil
+		}
+		logger.Error(fmt.Sprintf("%s: %s embedding failed, appending trailer instead: %v", filepath.Base(filePath), container.name(), err))
 	}
 	
 	// Open file for appending
@@ -132,11 +109,8 @@ func AddBinaryWatermark(filePath string, encodedText string) error {
 	}
 	defer file.Close()
 	
-	// Create watermark: WATERMARK_START + encodedText + WATERMARK_END
-    watermark := append(WATERMARK_START, []byte(encodedText)...)
-    watermark = append(watermark, WATERMARK_END...)
-	
-	_, err = file.Write(watermark)
+	// Length-prefixed record, so size and charset of the payload are unrestricted
+	_, err = file.Write(buildTrailerRecord(content))
 	if err != nil {
 		logger.Error(fmt.Sprintf("Error adding watermark to %s: %v", filepath.Base(filePath), err))
 		return err
@@ -146,77 +120,6 @@ func AddBinaryWatermark(filePath string, encodedText string) error {
 	return nil
 }
 
-// removeWatermarkFromFile removes watermark from specific file (exact port from Kotlin)
-func removeWatermarkFromFile(filePath string) (bool, error) {
-	tailData, fileSize, err := readWatermarkData(filePath)
-	if err != nil {
-		return false, err
-	}
-	
-	if tailData == nil {
-		return false, nil
-	}
-	
-	watermarkInfo := findWatermark(tailData, false)
-	if watermarkInfo == nil {
-		return false, nil
-	}
-	
-	// Calculate watermark position in file
-	watermarkPosition := fileSize - int64(len(tailData)-watermarkInfo.StartPosition)
-	
-	// Truncate file at watermark position
-	err = os.Truncate(filePath, watermarkPosition)
-	if err != nil {
-		logger := GetGlobalLogger()
-		logger.Error(fmt.Sprintf("Error removing watermark from %s: %v", filepath.Base(filePath), err))
-		return false, err
-	}
-	
-	return true, nil
-}
-
-// readWatermarkData reads last MAX_WATERMARK_LENGTH bytes from file (exact port from Kotlin)
-func readWatermarkData(filePath string) ([]byte, int64, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		logger := GetGlobalLogger()
-		logger.Error(fmt.Sprintf("Error reading watermark data from %s: %v", filepath.Base(filePath), err))
-		return nil, 0, err
-	}
-	defer file.Close()
-	
-	// Get file size
-	info, err := file.Stat()
-	if err != nil {
-		return nil, 0, err
-	}
-	
-	fileSize := info.Size()
-	if fileSize < MAX_WATERMARK_LENGTH {
-		return nil, fileSize, nil
-	}
-	
-	// Read last MAX_WATERMARK_LENGTH bytes
-	readLength := int64(MAX_WATERMARK_LENGTH)
-	if readLength > fileSize {
-		readLength = fileSize
-	}
-	
-	_, err = file.Seek(fileSize-readLength, 0)
-	if err != nil {
-		return nil, fileSize, err
-	}
-	
-	tailData := make([]byte, readLength)
-	_, err = file.Read(tailData)
-	if err != nil {
-		return nil, fileSize, err
-	}
-	
-	return tailData, fileSize, nil
-}
-
 // findWatermark looks for watermark signatures in byte array (exact port from Kotlin)
 func findWatermark(data []byte, includeContent bool) *WatermarkInfo {
 	// Find start position (search from end to beginning)
@@ -290,7 +193,7 @@ func TestWatermarkOperations(testFilePath string) {
 	logger.Log("Testing watermark operations...")
 	
 	// Test adding watermark
-    encodedText := EncodeText("Test Watermark 001")
+    encodedText := EncodePayload("Test Watermark 001")
     err := AddBinaryWatermark(testFilePath, encodedText)
 	if err != nil {
 		logger.Error(fmt.Sprintf("Failed to add watermark: %v", err))
@@ -322,4 +225,38 @@ func TestWatermarkOperations(testFilePath string) {
 	} else {
 		logger.Error(fmt.Sprintf("✗ Watermark extraction failed: got '%s', expected '%s'", extractedText, encodedText))
 	}
+	
+	// Test a payload longer than MAX_WATERMARK_LENGTH with UTF-8 text
+	longText := EncodePayload(strings.Repeat("Zoë Müller Studio ", 10) + "003")
+	if err := AddOwnedWatermark(testFilePath, "long", longText); err != nil {
+		logger.Error(fmt.Sprintf("Failed to add long watermark: %v", err))
+		return
+	}
+	if newest, err := ExtractWatermarkText(testFilePath); err == nil && newest == longText {
+		logger.Log("✓ Long UTF-8 watermark test passed")
+	} else {
+		logger.Error(fmt.Sprintf("✗ Long UTF-8 watermark test failed: got '%s' (%v)", newest, err))
+	}
+	RemoveWatermarksByOwner(testFilePath, "long")
+	
+	// Test chaining a second, owned mark and stripping it again
+	ownerText := EncodePayload("Reseller 002")
+	if err := AddOwnedWatermark(testFilePath, "reseller", ownerText); err != nil {
+		logger.Error(fmt.Sprintf("Failed to add second watermark: %v", err))
+		return
+	}
+	marks, err := ExtractWatermarks(testFilePath)
+	if err == nil && len(marks) == 2 && marks[0].Payload == encodedText && marks[1].Owner == "reseller" {
+		logger.Log("✓ Watermark chain test passed")
+	} else {
+		logger.Error(fmt.Sprintf("✗ Watermark chain test failed: %+v (%v)", marks, err))
+	}
+	
+	removed, err := RemoveWatermarksByOwner(testFilePath, "reseller")
+	extractedText, _ = ExtractWatermarkText(testFilePath)
+	if err == nil && removed == 1 && extractedText == encodedText {
+		logger.Log("✓ Watermark removal by owner test passed")
+	} else {
+		logger.Error(fmt.Sprintf("✗ Watermark removal by owner failed: removed %d, newest '%s' (%v)", removed, extractedText, err))
+	}
 }
\ No newline at end of file
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A file can carry a chain of marks (e.g. studio, reseller, customer), each
+// optionally labelled with its owner: <<==owner\x1fpayload==>>. Unlabelled
+// marks are byte-identical to the single-mark format.
+const (
+	WATERMARK_OWNER_SEPARATOR = "\x1f"
+	// MAX_WATERMARK_CHAIN bounds how many trailer marks are read back
+	MAX_WATERMARK_CHAIN = 64
+)
+
+// WatermarkMark is one mark of a file's watermark chain
+type WatermarkMark struct {
+	Index    int    `json:"index"`    // position in the chain, oldest first
+	Location string `json:"location"` // ExtractorTrailer, ExtractorContainer or ExtractorText
+	Format   string `json:"format"`   // e.g. "JPEG APP15", "trailer record", "plain trailer"
+	Owner    string `json:"owner,omitempty"`
+	Payload  string `json:"payload"`
+}
+
+// WatermarkSelector picks marks out of a file's chain. The zero value
+// selects every mark; a negative Index counts back from the newest mark.
+// Text filters match the decoded flat text ("<baseText> <orderNumber>", also
+// for structured marks), so marks that fail to decode never match them.
+type WatermarkSelector struct {
+	Index       *int           `json:"index,omitempty"`
+	Owner       string         `json:"owner,omitempty"`
+	Text        string         `json:"text,omitempty"`       // exact decoded text
+	TextPrefix  string         `json:"textPrefix,omitempty"` // decoded text prefix, e.g. a base text
+	TextPattern *regexp.Regexp `json:"-"`                    // regular expression on the decoded text
+	KeyID       string         `json:"keyId,omitempty"`      // key ID of keyed payloads
+}
+
+// chainEntry is a mark plus where it lives in the file
+type chainEntry struct {
+	mark       WatermarkMark
+	start, end int64      // byte range for trailer and text marks
+	ranges     [][2]int64 // every frame of a zero-width mark
+	slot       int        // index among the container's own marks
+}
+
+// Matches reports whether mark is selected; chainLength resolves negative indexes
+func (s WatermarkSelector) Matches(mark WatermarkMark, chainLength int) bool {
+	if s.Index != nil {
+		index := *s.Index
+		if index < 0 {
+			index += chainLength
+		}
+		if mark.Index != index {
+			return false
+		}
+	}
+	if s.Owner != "" && !strings.EqualFold(s.Owner, mark.Owner) {
+		return false
+	}
+	if s.KeyID != "" && PayloadKeyID(mark.Payload) != s.KeyID {
+		return false
+	}
+	if s.Text != "" || s.TextPrefix != "" || s.TextPattern != nil {
+		text, ok := decodedMarkText(mark.Payload)
+		if !ok {
+			return false
+		}
+		if s.Text != "" && text != s.Text {
+			return false
+		}
+		if s.TextPrefix != "" && !strings.HasPrefix(text, s.TextPrefix) {
+			return false
+		}
+		if s.TextPattern != nil && !s.TextPattern.MatchString(text) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetTextPattern compiles expr into TextPattern; an empty expr clears it
+func (s *WatermarkSelector) SetTextPattern(expr string) error {
+	if expr == "" {
+		s.TextPattern = nil
+		return nil
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	s.TextPattern = pattern
+	return nil
+}
+
+// decodedMarkText decodes a mark's payload to its flat text
+func decodedMarkText(payload string) (string, bool) {
+	fields, text, status := DecodeStructuredPayload(payload)
+	if status != WatermarkValid && status != WatermarkLegacy {
+		return "", false
+	}
+	if fields != nil {
+		return fields.Text(), true
+	}
+	return text, true
+}
+
+// String describes the selector for log messages
+func (s WatermarkSelector) String() string {
+	var parts []string
+	if s.Index != nil {
+		parts = append(parts, fmt.Sprintf("index %d", *s.Index))
+	}
+	if s.Owner != "" {
+		parts = append(parts, fmt.Sprintf("owner %q", s.Owner))
+	}
+	if s.Text != "" {
+		parts = append(parts, fmt.Sprintf("text %q", s.Text))
+	}
+	if s.TextPrefix != "" {
+		parts = append(parts, fmt.Sprintf("text prefix %q", s.TextPrefix))
+	}
+	if s.TextPattern != nil {
+		parts = append(parts, fmt.Sprintf("text matching /%s/", s.TextPattern))
+	}
+	if s.KeyID != "" {
+		parts = append(parts, fmt.Sprintf("key %s", s.KeyID))
+	}
+	if len(parts) == 0 {
+		return "all marks"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ownedPayload prefixes payload with its owner label, if any
+func ownedPayload(owner string, payload string) string {
+	if owner == "" {
+		return payload
+	}
+	return owner + WATERMARK_OWNER_SEPARATOR + payload
+}
+
+// splitOwner separates the owner label from a mark's content
+func splitOwner(content string) (string, string) {
+	if i := strings.Index(content, WATERMARK_OWNER_SEPARATOR); i >= 0 {
+		return content[:i], content[i+len(WATERMARK_OWNER_SEPARATOR):]
+	}
+	return "", content
+}
+
+// ExtractWatermarks returns every mark in the file, oldest first. Trailer
+// marks predate container embedding, so they are listed before container marks.
+func ExtractWatermarks(filePath string) ([]WatermarkMark, error) {
+	entries, err := readWatermarkChain(filePath)
+	if err != nil {
+		return nil, err
+	}
+	marks := make([]WatermarkMark, len(entries))
+	for i, entry := range entries {
+		marks[i] = entry.mark
+	}
+	return marks, nil
+}
+
+// readWatermarkChain locates every mark of the file's chain
+func readWatermarkChain(filePath string) ([]chainEntry, error) {
+	var entries []chainEntry
+	add := func(location string, format string, content []byte, start, end int64, slot int) {
+		owner, payload := splitOwner(string(content))
+		entries = append(entries, chainEntry{
+			mark:  WatermarkMark{Index: len(entries), Location: location, Format: format, Owner: owner, Payload: payload},
+			start: start,
+			end:   end,
+			slot:  slot,
+		})
+	}
+
+	// Text marks may be followed by later edits, so scan the whole content
+	if IsTextFile(filePath) {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		for pos := 0; ; {
+			start := findBytes(data, WATERMARK_START, pos)
+			if start == -1 {
+				break
+			}
+			end := findBytes(data, WATERMARK_END, start+len(WATERMARK_START))
+			if end == -1 {
+				break
+			}
+			pos = end + len(WATERMARK_END)
+			add(ExtractorText, "text", data[start+len(WATERMARK_START):end], int64(start), int64(pos), 0)
+		}
+
+		// Zero-width marks repeat across the body; one entry per payload
+		byPayload := map[string]int{}
+		for _, span := range findZeroWidthFrames(string(data)) {
+			i, ok := byPayload[span.payload]
+			if !ok {
+				i = len(entries)
+				byPayload[span.payload] = i
+				add(ExtractorText, "zero-width", []byte(span.payload), 0, 0, 0)
+			}
+			entries[i].ranges = append(entries[i].ranges, [2]int64{int64(span.start), int64(span.end)})
+		}
+		return entries, nil
+	}
+
+	trailer, err := readTrailerMarks(filePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, mark := range trailer {
+		format := "plain trailer"
+		if mark.footer {
+			format = "trailer record"
+		}
+		add(ExtractorTrailer, format, mark.Content, int64(mark.StartPosition), int64(mark.EndPosition), 0)
+	}
+
+	if container := containerFormatFor(filePath); container != nil {
+		marks, err := container.extract(filePath)
+		if err != nil {
+			return nil, err
+		}
+		for slot, data := range marks {
+			// Each segment holds exactly one mark, so the payload may itself contain markers
+			if bytes.HasPrefix(data, WATERMARK_START) && bytes.HasSuffix(data, WATERMARK_END) &&
+				len(data) >= len(WATERMARK_START)+len(WATERMARK_END) {
+				add(ExtractorContainer, container.name(), data[len(WATERMARK_START):len(data)-len(WATERMARK_END)], 0, 0, slot)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// removeWatermarksMatching strips the selected marks from one file and
+// reports how many were removed
+func removeWatermarksMatching(filePath string, selector WatermarkSelector) (int, error) {
+	entries, err := readWatermarkChain(filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	var ranges [][2]int64
+	rangeMarks := 0
+	dropSlots := map[int]bool{}
+	for _, entry := range entries {
+		if !selector.Matches(entry.mark, len(entries)) {
+			continue
+		}
+		switch {
+		case entry.mark.Location == ExtractorContainer:
+			dropSlots[entry.slot] = true
+			continue
+		case entry.ranges != nil:
+			ranges = append(ranges, entry.ranges...)
+		default:
+			ranges = append(ranges, [2]int64{entry.start, entry.end})
+		}
+		rangeMarks++
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	// Byte ranges first: container rewrites keep trailing bytes but may move them
+	removed := 0
+	if len(ranges) > 0 {
+		if err := cutByteRanges(filePath, ranges); err != nil {
+			return 0, err
+		}
+		removed += rangeMarks
+	}
+	if len(dropSlots) > 0 {
+		n, err := containerFormatFor(filePath).remove(filePath, func(index int) bool { return dropSlots[index] })
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+// cutByteRanges deletes ascending, non-overlapping byte ranges from a file.
+// The cleaned content replaces the file atomically, so a failed write leaves
+// the original intact.
+func cutByteRanges(filePath string, ranges [][2]int64) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	kept := make([]byte, 0, len(data))
+	pos := int64(0)
+	for _, r := range ranges {
+		if r[0] < pos || r[1] < r[0] || r[1] > int64(len(data)) {
+			return fmt.Errorf("invalid watermark range %d-%d in %s", r[0], r[1], filepath.Base(filePath))
+		}
+		kept = append(kept, data[pos:r[0]]...)
+		pos = r[1]
+	}
+	kept = append(kept, data[pos:]...)
+	return WriteFileAtomic(filePath, kept)
+}
+
+// AddOwnedWatermark appends a mark labelled with owner to the file's chain
+func AddOwnedWatermark(filePath string, owner string, encodedText string) error {
+	if strings.Contains(owner, WATERMARK_OWNER_SEPARATOR) {
+		return fmt.Errorf("watermark owner must not contain the separator character")
+	}
+	return addWatermarkToChain(filePath, owner, encodedText)
+}
+
+// RemoveWatermarkAt strips the mark at index (negative counts from the newest)
+func RemoveWatermarkAt(filePath string, index int) error {
+	removed, err := removeWatermarksMatching(filePath, WatermarkSelector{Index: &index})
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return fmt.Errorf("%s has no watermark at index %d", filepath.Base(filePath), index)
+	}
+	return nil
+}
+
+// RemoveWatermarksByOwner strips every mark labelled with owner
+func RemoveWatermarksByOwner(filePath string, owner string) (int, error) {
+	if owner == "" {
+		return 0, fmt.Errorf("owner is empty")
+	}
+	return removeWatermarksMatching(filePath, WatermarkSelector{Owner: owner})
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// mixedChain returns owner/payload pairs for a Caesar mark, a keyed mark, a
+// structured mark, a mark sealed by an unknown secret and a mark of key k2
+func mixedChain(t *testing.T) [][2]string {
+	t.Helper()
+	useWatermarkSecret(t, "test-secret")
+	useKeyFile(t)
+	structured, err := EncodeStructuredPayload(WatermarkPayload{OrderID: "042", CopyIndex: 2, BaseText: "Project Alpha"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := [][2]string{
+		{"studio", "Alza 890"},
+		{"studio", EncodePayload("Project Alpha 041")},
+		{"reseller", structured},
+		{"", sealedWith(t, "other-secret", "Project Alpha 043")},
+	}
+	if _, err := GetWatermarkKeyring().Add("k2", "second-secret"); err != nil {
+		t.Fatal(err)
+	}
+	return append(chain, [2]string{"customer", EncodePayload("Project Beta 044")})
+}
+
+func TestWatermarkSelectorMixedChain(t *testing.T) {
+	chain := mixedChain(t)
+	index := func(i int) *int { return &i }
+	pattern := regexp.MustCompile
+
+	tests := []struct {
+		name     string
+		selector WatermarkSelector
+		want     []int
+	}{
+		{"all", WatermarkSelector{}, []int{0, 1, 2, 3, 4}},
+		{"Caesar text", WatermarkSelector{Text: "Test 123"}, []int{0}},
+		{"structured flat text", WatermarkSelector{Text: "Project Alpha 042"}, []int{2}},
+		{"undecodable text", WatermarkSelector{Text: "Project Alpha 043"}, []int{}},
+		{"text is exact", WatermarkSelector{Text: "Project Alpha"}, []int{}},
+		{"prefix", WatermarkSelector{TextPrefix: "Project Alpha"}, []int{1, 2}},
+		{"prefix across keys", WatermarkSelector{TextPrefix: "Project"}, []int{1, 2, 4}},
+		{"regex", WatermarkSelector{TextPattern: pattern(`^Project \w+ 04[24]$`)}, []int{2, 4}},
+		{"regex skips undecodable", WatermarkSelector{TextPattern: pattern(`.*`)}, []int{0, 1, 2, 4}},
+		{"key ID", WatermarkSelector{KeyID: "k2"}, []int{4}},
+		{"default key ID", WatermarkSelector{KeyID: DEFAULT_KEY_ID}, []int{1, 2, 3}},
+		{"key ID and prefix", WatermarkSelector{KeyID: DEFAULT_KEY_ID, TextPrefix: "Project"}, []int{1, 2}},
+		{"owner and regex", WatermarkSelector{Owner: "Studio", TextPattern: pattern(`\d$`)}, []int{0, 1}},
+		{"newest with prefix", WatermarkSelector{Index: index(-1), TextPrefix: "Project Beta"}, []int{4}},
+		{"index and other prefix", WatermarkSelector{Index: index(0), TextPrefix: "Project"}, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, "clip.avi", testTrailerMedia)
+			for _, mark := range chain {
+				if err := addWatermarkToChain(path, mark[0], mark[1]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			marks, err := ExtractWatermarks(path)
+			if err != nil || len(marks) != len(chain) {
+				t.Fatalf("extracted %d marks, %v", len(marks), err)
+			}
+			selected := []int{}
+			for _, mark := range marks {
+				if tt.selector.Matches(mark, len(marks)) {
+					selected = append(selected, mark.Index)
+				}
+			}
+			if !reflect.DeepEqual(selected, tt.want) {
+				t.Fatalf("%s selects %v, want %v", tt.selector, selected, tt.want)
+			}
+
+			removed, err := removeWatermarksMatching(path, tt.selector)
+			if err != nil || removed != len(tt.want) {
+				t.Fatalf("removed %d, %v; want %d", removed, err, len(tt.want))
+			}
+			kept := []string{}
+			for i, mark := range chain {
+				if !containsIndex(tt.want, i) {
+					kept = append(kept, mark[1])
+				}
+			}
+			left, _ := ExtractWatermarks(path)
+			payloads := []string{}
+			for _, mark := range left {
+				payloads = append(payloads, mark.Payload)
+			}
+			if !reflect.DeepEqual(payloads, kept) {
+				t.Errorf("kept %q, want %q", payloads, kept)
+			}
+		})
+	}
+}
+
+func containsIndex(indexes []int, i int) bool {
+	for _, index := range indexes {
+		if index == i {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWatermarkSelectorSetTextPattern(t *testing.T) {
+	var selector WatermarkSelector
+	if err := selector.SetTextPattern(`^Project (Alpha`); err == nil || selector.TextPattern != nil {
+		t.Errorf("invalid regex set pattern %v, error %v", selector.TextPattern, err)
+	}
+	if err := selector.SetTextPattern(`^Project`); err != nil || !selector.Matches(WatermarkMark{Payload: EncodeText("Project 042")}, 1) {
+		t.Errorf("valid regex: pattern %v, error %v", selector.TextPattern, err)
+	}
+	if err := selector.SetTextPattern(""); err != nil || selector.TextPattern != nil {
+		t.Errorf("empty regex left pattern %v, error %v", selector.TextPattern, err)
+	}
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RemovalOptions selects where cleaned files go. With an empty Output the
+// source files are cleaned in place; otherwise the source tree is copied to
+// Output (a folder, or a ZIP archive when it ends in ".zip") and only the copy
+// is cleaned. DryRun reports what would change without writing anything.
+type RemovalOptions struct {
+	Output string
+	DryRun bool
+}
+
+// RemovalResult is the outcome for one file that carried selected marks
+type RemovalResult struct {
+	Path         string `json:"path"`
+	Marks        int    `json:"marks"`
+	OriginalSize int64  `json:"originalSize"`
+	CleanedSize  int64  `json:"cleanedSize"`
+	BytesRemoved int64  `json:"bytesRemoved"`
+	Error        string `json:"error,omitempty"`
+}
+
+// RemovalReport summarizes a removal run
+type RemovalReport struct {
+	Source        string          `json:"source"`
+	Output        string          `json:"output,omitempty"` // empty when cleaned in place or dry run
+	DryRun        bool            `json:"dryRun"`
+	Selector      string          `json:"selector"`
+	Scanned       int             `json:"scanned"`
+	Modified      int             `json:"modified"`
+	BytesRemoved  int64           `json:"bytesRemoved"`
+	Files         []RemovalResult `json:"files"`
+	DownloadToken string          `json:"downloadToken,omitempty"` // set by the web layer
+}
+
+// removableFiles lists the media, document and text files of directory;
+// text files carry appended and zero-width marks
+func removableFiles(directory string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Continue on errors
+		}
+		if !info.IsDir() && (IsImageFile(path) || IsVideoFile(path) || IsDocumentFile(path) || IsTextFile(path)) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// CleanWatermarks removes the marks picked by selector according to options
+// and reports every file that had (or, on a dry run, would have) marks removed
+func CleanWatermarks(directory string, selector WatermarkSelector, options RemovalOptions, progress func(float32)) (*RemovalReport, error) {
+	logger := GetGlobalLogger()
+	report := &RemovalReport{Source: directory, DryRun: options.DryRun, Selector: selector.String()}
+
+	zipOutput := strings.EqualFold(filepath.Ext(options.Output), ".zip")
+	workRoot := directory
+	switch {
+	case options.DryRun:
+		// Each file is cleaned as a scratch copy below
+	case options.Output != "":
+		if err := checkRemovalOutput(directory, options.Output); err != nil {
+			return nil, err
+		}
+		workRoot = options.Output
+		if zipOutput {
+			staging, err := os.MkdirTemp(filepath.Dir(options.Output), ".clean_")
+			if err != nil {
+				return nil, err
+			}
+			defer os.RemoveAll(staging)
+			workRoot = staging
+		}
+		if err := CopyDirectory(directory, workRoot); err != nil {
+			return nil, err
+		}
+		report.Output = options.Output
+	}
+
+	files, err := removableFiles(directory)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error during watermark removal process: %v", err))
+		return nil, err
+	}
+	report.Scanned = len(files)
+	report.Files = []RemovalResult{}
+
+	for i, file := range files {
+		rel, _ := filepath.Rel(directory, file)
+		result := cleanFile(file, filepath.Join(workRoot, rel), selector, options.DryRun)
+		result.Path = filepath.ToSlash(rel)
+
+		switch {
+		case result.Error != "":
+			logger.Error(fmt.Sprintf("Error removing watermark from %s: %s", result.Path, result.Error))
+		case result.Marks > 0 && options.DryRun:
+			logger.Log(fmt.Sprintf("[DRY RUN] %s: would remove %d mark(s), %d bytes", result.Path, result.Marks, result.BytesRemoved))
+		case result.Marks > 0:
+			logger.Log(fmt.Sprintf("Watermark removed from %s (%d mark(s), %d bytes, %s)", result.Path, result.Marks, result.BytesRemoved, selector))
+		}
+		if result.Marks > 0 || result.Error != "" {
+			report.Files = append(report.Files, result)
+		}
+		if result.Marks > 0 {
+			report.Modified++
+			report.BytesRemoved += result.BytesRemoved
+		}
+
+		if progress != nil {
+			progress(float32(i+1) / float32(len(files)))
+		}
+	}
+
+	if zipOutput && !options.DryRun {
+		if err := writeFolderZip(workRoot, options.Output); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.DryRun {
+		logger.Log(fmt.Sprintf("[DRY RUN] %d of %d files would be modified, %d bytes removed", report.Modified, report.Scanned, report.BytesRemoved))
+	} else {
+		logger.Log(fmt.Sprintf("Watermark removal completed: %d of %d files modified, %d bytes removed", report.Modified, report.Scanned, report.BytesRemoved))
+	}
+	return report, nil
+}
+
+// cleanFile removes marks from target, which is source itself or its copy in
+// the output tree. A dry run cleans a scratch copy in the temp directory instead.
+func cleanFile(source string, target string, selector WatermarkSelector, dryRun bool) RemovalResult {
+	var result RemovalResult
+	info, err := os.Stat(source)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.OriginalSize = info.Size()
+
+	if dryRun {
+		scratch, err := os.CreateTemp(os.TempDir(), "dryrun_*"+filepath.Ext(source))
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		target = scratch.Name()
+		scratch.Close()
+		defer os.Remove(target)
+		if err := copyFile(source, target, 0600); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+
+	removed, err := removeWatermarksMatching(target, selector)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Marks = removed
+	if cleaned, err := os.Stat(target); err == nil {
+		result.CleanedSize = cleaned.Size()
+		result.BytesRemoved = result.OriginalSize - result.CleanedSize
+	}
+	return result
+}
+
+// checkRemovalOutput refuses outputs that would overwrite or sit inside the source
+func checkRemovalOutput(directory string, output string) error {
+	source, err := filepath.Abs(directory)
+	if err != nil {
+		return err
+	}
+	target, err := filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+	if target == source || strings.HasPrefix(target, source+string(filepath.Separator)) ||
+		strings.HasPrefix(source, target+string(filepath.Separator)) {
+		return fmt.Errorf("output %s must be outside the source folder", output)
+	}
+	if _, err := os.Stat(target); err == nil {
+		return fmt.Errorf("output %s already exists", output)
+	}
+	return nil
+}
+
+// writeFolderZip stores folder as an uncompressed ZIP at zipPath
+func writeFolderZip(folder string, zipPath string) error {
+	file, err := os.Create(zipPath)
+	if err != nil {
+		return err
+	}
+	if err := StreamNoCompressionZip(file, folder); err != nil {
+		file.Close()
+		os.Remove(zipPath)
+		return err
+	}
+	return file.Close()
+}
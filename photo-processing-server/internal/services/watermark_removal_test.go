@@ -0,0 +1,99 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCleanWatermarksTextFiles(t *testing.T) {
+	body := strings.Repeat("lorem ipsum dolor sit amet ", 20)
+	source := t.TempDir()
+	appended := filepath.Join(source, "appended.txt")
+	hidden := filepath.Join(source, "hidden.txt")
+	for _, path := range []string{appended, hidden} {
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ProcessFile(appended, string(buildWatermark(ownedPayload("", "appended-payload")))); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddZeroWidthWatermark(hidden, "studio", "hidden-payload"); err != nil {
+		t.Fatal(err)
+	}
+	marked := map[string][]byte{}
+	for _, path := range []string{appended, hidden} {
+		data, _ := os.ReadFile(path)
+		if string(data) == body {
+			t.Fatalf("%s was not marked", filepath.Base(path))
+		}
+		marked[path] = data
+	}
+
+	tests := []struct {
+		name    string
+		options RemovalOptions
+	}{
+		{"dry run", RemovalOptions{DryRun: true}},
+		{"to folder", RemovalOptions{Output: filepath.Join(t.TempDir(), "clean")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := CleanWatermarks(source, WatermarkSelector{}, tt.options, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Scanned != 2 || report.Modified != 2 {
+				t.Fatalf("scanned %d, modified %d, want 2 and 2: %+v", report.Scanned, report.Modified, report.Files)
+			}
+			for path, data := range marked {
+				if current, _ := os.ReadFile(path); string(current) != string(data) {
+					t.Errorf("source %s was changed", filepath.Base(path))
+				}
+				if tt.options.Output == "" {
+					continue
+				}
+				cleaned, err := os.ReadFile(filepath.Join(tt.options.Output, filepath.Base(path)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(cleaned) != body {
+					t.Errorf("%s not restored to the original text", filepath.Base(path))
+				}
+			}
+		})
+	}
+}
+
+func TestCutByteRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		ranges  [][2]int64
+		want    string
+		wantErr bool
+	}{
+		{"single", [][2]int64{{2, 4}}, "01456789", false},
+		{"several", [][2]int64{{0, 1}, {5, 7}, {9, 10}}, "123478", false},
+		{"whole file", [][2]int64{{0, 10}}, "", false},
+		{"past end", [][2]int64{{8, 12}}, "0123456789", true},
+		{"overlapping", [][2]int64{{2, 5}, {4, 6}}, "0123456789", true},
+		{"reversed", [][2]int64{{5, 3}}, "0123456789", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.bin")
+			if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := cutByteRanges(path, tt.ranges)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, wantErr %v", err, tt.wantErr)
+			}
+			if got, _ := os.ReadFile(path); string(got) != tt.want {
+				t.Errorf("content %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
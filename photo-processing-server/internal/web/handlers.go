@@ -1,6 +1,7 @@
 package web
 
 import (
+    "encoding/json"
     "fmt"
     "io"
     "net/http"
@@ -25,6 +26,25 @@ import (
 type ProcessingRequest struct {
 	SelectedPath string `json:"selectedPath"`
 	NameToInject string `json:"nameToInject,omitempty"`
+	// Watermark chain: owner label for encrypt, owner/index filter for removal
+	Owner     string `json:"owner,omitempty"`
+	MarkIndex *int   `json:"markIndex,omitempty"`
+	// Encrypt: "visible" (default) or "zero-width" text watermarks
+	TextMode string `json:"textMode,omitempty"`
+	// Removal: "folder" or "zip" writes cleaned copies next to the source
+	// instead of cleaning in place; dryRun only reports what would change
+	Output string `json:"output,omitempty"`
+	DryRun bool   `json:"dryRun,omitempty"`
+	// Removal: only strip marks whose payload matches
+	Filter *MarkFilter `json:"filter,omitempty"`
+}
+
+// MarkFilter narrows watermark removal by decoded payload; set fields must all match
+type MarkFilter struct {
+	Text   string `json:"text,omitempty"`   // exact decoded text, e.g. "ORDER 007"
+	Prefix string `json:"prefix,omitempty"` // decoded text prefix, e.g. a reseller's base text
+	Regex  string `json:"regex,omitempty"`  // regular expression on the decoded text
+	KeyID  string `json:"keyId,omitempty"`  // key ID of keyed payloads
 }
 
 type BatchCopyRequest struct {
@@ -35,8 +55,9 @@ type BatchCopyRequest struct {
 type AddTextRequest struct {
 	SelectedPath string `json:"selectedPath"`
 	Settings     struct {
-		Text        string `json:"text"`
-		PhotoNumber int    `json:"photoNumber"`
+		Text        string                          `json:"text"`
+		PhotoNumber int                             `json:"photoNumber"`
+		Style       *services.VisibleWatermarkStyle `json:"style,omitempty"`
 	} `json:"settings"`
 }
 
@@ -145,9 +166,14 @@ func (h *WebHandler) SetupRoutes(router *gin.Engine) {
 	{
 		api.POST("/encrypt", h.handleEncrypt)
 		api.POST("/decrypt", h.handleDecrypt)
+		api.GET("/decrypt/:id/report", h.handleDecryptReport)
+		api.POST("/verify", h.handleVerify)
+		api.GET("/verify/:id/report", h.handleVerifyReport)
 		api.POST("/batch-copy", h.handleBatchCopy)
 		api.POST("/add-text", h.handleAddText)
+		api.GET("/fonts", h.handleFonts)
 		api.POST("/remove-watermarks", h.handleRemoveWatermarks)
+		api.POST("/swap-decode", h.handleSwapDecode)
 		api.POST("/upload", h.handleUpload)
 		api.GET("/processing/:id", h.handleProcessingStatus)
 		api.GET("/download/:token", h.handleDownload)
@@ -255,12 +281,15 @@ func (h *WebHandler) handleEncrypt(c *gin.Context) {
     h.logger.Log("=== Starting Encryption Process ===")
     h.logger.Log(fmt.Sprintf("Selected Path: %s", req.SelectedPath))
     h.logger.Log(fmt.Sprintf("Name to Inject: %s", req.NameToInject))
+    if req.Owner != "" {
+        h.logger.Log(fmt.Sprintf("Watermark Owner: %s", req.Owner))
+    }
 
     jobID := h.startJob(userID, func(id string) error {
         activeMutex.Lock()
         activeOps[key] = id
         activeMutex.Unlock()
-        err := h.processor.EncryptFiles(req.SelectedPath, req.NameToInject, func(progress float64) {
+        err := h.processor.EncryptFiles(req.SelectedPath, req.NameToInject, req.Owner, req.TextMode, func(progress float64) {
             UpdateJobProgress(id, progress)
             BroadcastProgress(id, progress)
         })
@@ -330,12 +359,14 @@ func (h *WebHandler) handleDecrypt(c *gin.Context) {
         activeMutex.Lock()
         activeOps[key] = id
         activeMutex.Unlock()
-        err := h.processor.DecryptFiles(req.SelectedPath, func(progress float64) {
+        report, err := h.processor.DecryptFiles(req.SelectedPath, func(progress float64) {
             UpdateJobProgress(id, progress)
             BroadcastProgress(id, progress)
         })
         if err != nil {
             h.logger.Error(fmt.Sprintf("Decrypt error: %v", err))
+        } else {
+            SetJobResult(id, report)
         }
         activeMutex.Lock()
         delete(activeOps, key)
@@ -352,6 +383,140 @@ func (h *WebHandler) handleDecrypt(c *gin.Context) {
     h.logger.Processing(fmt.Sprintf("JOB %s: Decryption started for %s", jobID, req.SelectedPath))
 }
 
+// Verify handler
+func (h *WebHandler) handleVerify(c *gin.Context) {
+    cfg := config.Load()
+    if cfg.APIToken != "" {
+        auth := c.GetHeader("Authorization")
+        if len(auth) < 8 || auth[:7] != "Bearer " || auth[7:] != cfg.APIToken {
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+            return
+        }
+    }
+    userID := getCurrentUserID(c)
+    if userID == "" {
+        c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Login required"})
+        return
+    }
+    var req ProcessingRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, ApiResponse{
+            Success: false,
+            Error:   fmt.Sprintf("Invalid request: %v", err),
+        })
+        return
+    }
+
+    key := opKey("verify", req.SelectedPath)
+    activeMutex.Lock()
+    if existing, ok := activeOps[key]; ok {
+        activeMutex.Unlock()
+        c.JSON(http.StatusOK, ApiResponse{Success: true, JobID: existing, Message: "Verification already in progress"})
+        return
+    }
+    activeOps[key] = "pending"
+    activeMutex.Unlock()
+
+    h.logger.Log("=== Starting Verification Process ===")
+    h.logger.Log(fmt.Sprintf("Selected Path: %s", req.SelectedPath))
+
+    jobID := h.startJob(userID, func(id string) error {
+        activeMutex.Lock()
+        activeOps[key] = id
+        activeMutex.Unlock()
+        report, err := h.processor.VerifyFiles(req.SelectedPath, func(progress float64) {
+            UpdateJobProgress(id, progress)
+            BroadcastProgress(id, progress)
+        })
+        if err != nil {
+            h.logger.Error(fmt.Sprintf("Verify error: %v", err))
+        } else {
+            SetJobResult(id, report)
+        }
+        activeMutex.Lock()
+        delete(activeOps, key)
+        activeMutex.Unlock()
+        return err
+    })
+
+    c.JSON(http.StatusOK, ApiResponse{
+        Success: true,
+        JobID:   jobID,
+        Message: "Verification started",
+    })
+
+    h.logger.Processing(fmt.Sprintf("JOB %s: Verification started for %s", jobID, req.SelectedPath))
+}
+
+// handleDecryptReport downloads the results of a finished decrypt job (?format=json|csv, default json)
+func (h *WebHandler) handleDecryptReport(c *gin.Context) {
+    var report services.DecryptReport
+    h.serveJobReport(c, "decrypt", &report, func() bool { return report.Results != nil })
+}
+
+// handleVerifyReport downloads a finished verification report (?format=json|csv, default json)
+func (h *WebHandler) handleVerifyReport(c *gin.Context) {
+    var report services.VerificationReport
+    h.serveJobReport(c, "verification", &report, func() bool { return report.Files != nil })
+}
+
+// csvReport is a job result that can also be exported as CSV
+type csvReport interface {
+    WriteCSV(w io.Writer) error
+}
+
+// serveJobReport decodes the result of the caller's job :id into report and
+// serves it as a JSON or CSV attachment. ok tells whether the job's result
+// was actually a report of that kind.
+func (h *WebHandler) serveJobReport(c *gin.Context, kind string, report csvReport, ok func() bool) {
+    userID := getCurrentUserID(c)
+    if userID == "" {
+        c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Login required"})
+        return
+    }
+    job, exists := GetJob(c.Param("id"))
+    if !exists {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+        return
+    }
+    if job.UserID != userID {
+        c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+        return
+    }
+    if err := decodeJobResult(job.Result, report); err != nil || !ok() {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Report not available for this job"})
+        return
+    }
+
+    name := fmt.Sprintf("%s_%s", kind, job.ID)
+    switch c.DefaultQuery("format", "json") {
+    case "csv":
+        c.Header("Content-Type", "text/csv; charset=utf-8")
+        c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", name))
+        if err := report.WriteCSV(c.Writer); err != nil {
+            h.logger.Error(fmt.Sprintf("%s report CSV error: %v", kind, err))
+        }
+    case "json":
+        c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", name))
+        c.JSON(http.StatusOK, report)
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+    }
+}
+
+// decodeJobResult converts a stored job result into out. Results read back
+// from Redis are generic maps, so go through JSON either way.
+func decodeJobResult(result interface{}, out interface{}) error {
+    if result == nil {
+        return fmt.Errorf("job has no result")
+    }
+    data, err := json.Marshal(result)
+    if err != nil {
+        return err
+    }
+    return json.Unmarshal(data, out)
+}
+
 // Batch copy handler
 func (h *WebHandler) handleBatchCopy(c *gin.Context) {
     cfg := config.Load()
@@ -375,6 +540,18 @@ func (h *WebHandler) handleBatchCopy(c *gin.Context) {
         })
         return
     }
+    if err := req.Settings.VisibleWatermarkStyle.Validate(); err != nil {
+        c.JSON(http.StatusBadRequest, ApiResponse{ Success: false, Error: err.Error() })
+        return
+    }
+    if err := req.Settings.LogoWatermark.Validate(); err != nil {
+        c.JSON(http.StatusBadRequest, ApiResponse{ Success: false, Error: err.Error() })
+        return
+    }
+    if _, err := services.NewSwapPlan(req.Settings.SwapStrategy, req.Settings.SwapPairs, req.Settings.SwapCount); err != nil {
+        c.JSON(http.StatusBadRequest, ApiResponse{ Success: false, Error: err.Error() })
+        return
+    }
 
     key := opKey("batch", req.SelectedPath)
     activeMutex.Lock()
@@ -396,7 +573,10 @@ func (h *WebHandler) handleBatchCopy(c *gin.Context) {
         activeMutex.Lock()
         activeOps[key] = id
         activeMutex.Unlock()
-        err := h.processor.PerformBatchCopy(req.SelectedPath, req.Settings, func(progress float64) {
+        settings := req.Settings
+        settings.JobID = id
+        settings.UserID = userID
+        result, err := h.processor.PerformBatchCopy(req.SelectedPath, settings, func(progress float64) {
             UpdateJobProgress(id, progress)
             BroadcastProgress(id, progress)
         })
@@ -420,7 +600,9 @@ func (h *WebHandler) handleBatchCopy(c *gin.Context) {
                 for _, order := range orderDirs {
                     // Determine target photo number for this order
                     targetNum := 0
-                    if req.Settings.UseOrderNumberAsPhotoNumber || req.Settings.PhotoNumber == nil {
+                    if len(req.Settings.WatermarkPositions) > 0 {
+                        targetNum = req.Settings.WatermarkPositions[0]
+                    } else if req.Settings.UseOrderNumberAsPhotoNumber || req.Settings.PhotoNumber == nil {
                         if n, errAtoi := strconv.Atoi(order); errAtoi == nil { targetNum = n }
                     } else {
                         targetNum = *req.Settings.PhotoNumber
@@ -476,7 +658,14 @@ func (h *WebHandler) handleBatchCopy(c *gin.Context) {
                     if len(sample) > 0 { break }
                 }
             }
-            SetJobResult(id, map[string]interface{}{"path": resultPath, "watermarkSample": sample})
+            SetJobResult(id, map[string]interface{}{
+                "path":            resultPath,
+                "watermarkSample": sample,
+                // Recorded for leak tracing
+                "baseText":       req.Settings.BaseText,
+                "numberOfCopies": req.Settings.NumberOfCopies,
+                "swaps":          result.Swaps,
+            })
         }
         activeMutex.Lock()
         delete(activeOps, key)
@@ -516,6 +705,10 @@ func (h *WebHandler) handleAddText(c *gin.Context) {
         })
         return
     }
+    if err := req.Settings.Style.Validate(); err != nil {
+        c.JSON(http.StatusBadRequest, ApiResponse{ Success: false, Error: err.Error() })
+        return
+    }
 
     key := opKey("addtext", req.SelectedPath)
     activeMutex.Lock()
@@ -537,7 +730,7 @@ func (h *WebHandler) handleAddText(c *gin.Context) {
         activeMutex.Lock()
         activeOps[key] = id
         activeMutex.Unlock()
-        err := h.processor.AddTextToPhoto(req.SelectedPath, req.Settings.Text, req.Settings.PhotoNumber)
+        err := h.processor.AddTextToPhoto(req.SelectedPath, req.Settings.Text, req.Settings.PhotoNumber, req.Settings.Style)
         if err != nil {
             h.logger.Error(fmt.Sprintf("Add text error: %v", err))
             BroadcastError(id, err.Error())
@@ -559,6 +752,26 @@ func (h *WebHandler) handleAddText(c *gin.Context) {
     h.logger.Processing(fmt.Sprintf("JOB %s: Add text started for %s", jobID, req.SelectedPath))
 }
 
+// Fonts handler: names accepted as visible watermark style fonts
+func (h *WebHandler) handleFonts(c *gin.Context) {
+    if getCurrentUserID(c) == "" {
+        c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Login required"})
+        return
+    }
+    hershey := make([]string, 0, len(services.VISIBLE_FONTS))
+    for name := range services.VISIBLE_FONTS {
+        hershey = append(hershey, name)
+    }
+    sort.Strings(hershey)
+
+    library := services.GetFontLibrary()
+    response := gin.H{"hershey": hershey, "trueType": library.Fonts()}
+    if fallback := library.Default(); fallback != nil {
+        response["default"] = fallback.Name
+    }
+    c.JSON(http.StatusOK, response)
+}
+
 // Remove watermarks handler
 func (h *WebHandler) handleRemoveWatermarks(c *gin.Context) {
     cfg := config.Load()
@@ -580,6 +793,28 @@ func (h *WebHandler) handleRemoveWatermarks(c *gin.Context) {
         return
     }
 
+    selector := services.WatermarkSelector{Index: req.MarkIndex, Owner: req.Owner}
+    if f := req.Filter; f != nil {
+        selector.Text, selector.TextPrefix, selector.KeyID = f.Text, f.Prefix, f.KeyID
+        if err := selector.SetTextPattern(f.Regex); err != nil {
+            c.JSON(http.StatusBadRequest, ApiResponse{ Success: false, Error: fmt.Sprintf("Invalid filter regex: %v", err) })
+            return
+        }
+    }
+    options := services.RemovalOptions{DryRun: req.DryRun}
+    // Cleaned copies get a fresh sibling name, so the source and earlier outputs stay untouched
+    cleanedPath := filepath.Join(filepath.Dir(req.SelectedPath), fmt.Sprintf("%s-cleaned_%s", filepath.Base(req.SelectedPath), generateUUID()[:8]))
+    switch req.Output {
+    case "":
+    case "folder":
+        options.Output = cleanedPath
+    case "zip":
+        options.Output = cleanedPath + ".zip"
+    default:
+        c.JSON(http.StatusBadRequest, ApiResponse{ Success: false, Error: "output must be \"folder\" or \"zip\"" })
+        return
+    }
+
     key := opKey("remove", req.SelectedPath)
     activeMutex.Lock()
     if existing, ok := activeOps[key]; ok {
@@ -592,17 +827,29 @@ func (h *WebHandler) handleRemoveWatermarks(c *gin.Context) {
 
     h.logger.Log("=== Removing Invisible Watermarks ===")
     h.logger.Log(fmt.Sprintf("Selected Path: %s", req.SelectedPath))
+    h.logger.Log(fmt.Sprintf("Marks: %s", selector))
+    if options.DryRun {
+        h.logger.Log("Dry run: no files will be modified")
+    } else if options.Output != "" {
+        h.logger.Log(fmt.Sprintf("Output: %s", options.Output))
+    }
 
     jobID := h.startJob(userID, func(id string) error {
         activeMutex.Lock()
         activeOps[key] = id
         activeMutex.Unlock()
-        err := h.processor.RemoveWatermarks(req.SelectedPath, func(p float64) {
+        report, err := h.processor.RemoveWatermarks(req.SelectedPath, selector, options, func(p float64) {
             UpdateJobProgress(id, p)
             BroadcastProgress(id, p)
         })
         if err != nil {
             h.logger.Error(fmt.Sprintf("Remove watermarks error: %v", err))
+        } else {
+            if report.Output != "" {
+                report.DownloadToken = uuid.New().String()
+                SaveDownloadToken(report.DownloadToken, report.Output)
+            }
+            SetJobResult(id, report)
         }
         activeMutex.Lock()
         delete(activeOps, key)
@@ -614,6 +861,69 @@ func (h *WebHandler) handleRemoveWatermarks(c *gin.Context) {
     h.logger.Processing(fmt.Sprintf("JOB %s: Remove watermarks started for %s", jobID, req.SelectedPath))
 }
 
+// Swap decode handler: multipart form with the batch's "sourcePath" and the
+// suspect copy, either a ZIP in "file" or a folder uploaded earlier in "suspectPath"
+func (h *WebHandler) handleSwapDecode(c *gin.Context) {
+    cfg := config.Load()
+    if cfg.APIToken != "" {
+        auth := c.GetHeader("Authorization")
+        if len(auth) < 8 || auth[:7] != "Bearer " || auth[7:] != cfg.APIToken {
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+            return
+        }
+    }
+    userID := getCurrentUserID(c)
+    if userID == "" {
+        c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Login required"})
+        return
+    }
+    sourcePath := c.PostForm("sourcePath")
+    if info, err := os.Stat(sourcePath); sourcePath == "" || err != nil || !info.IsDir() {
+        c.JSON(http.StatusBadRequest, ApiResponse{ Success: false, Error: "sourcePath must be the batch's source folder" })
+        return
+    }
+
+    suspectPath := c.PostForm("suspectPath")
+    cleanup := func() {}
+    if suspectPath == "" {
+        tempPath, remove, err := saveSingleUpload(c)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, ApiResponse{ Success: false, Error: err.Error() })
+            return
+        }
+        if !strings.EqualFold(filepath.Ext(tempPath), ".zip") {
+            remove()
+            c.JSON(http.StatusBadRequest, ApiResponse{ Success: false, Error: "suspect upload must be a ZIP archive" })
+            return
+        }
+        suspectPath, cleanup = tempPath, remove
+    } else if _, err := os.Stat(suspectPath); err != nil {
+        c.JSON(http.StatusBadRequest, ApiResponse{ Success: false, Error: fmt.Sprintf("suspectPath does not exist: %s", suspectPath) })
+        return
+    }
+
+    h.logger.Log("=== Decoding Swap Fingerprint ===")
+    h.logger.Log(fmt.Sprintf("Source: %s", sourcePath))
+    h.logger.Log(fmt.Sprintf("Suspect: %s", filepath.Base(suspectPath)))
+
+    jobID := h.startJob(userID, func(id string) error {
+        defer cleanup()
+        report, err := h.processor.DecodeSwaps(sourcePath, suspectPath, func(progress float64) {
+            UpdateJobProgress(id, progress)
+            BroadcastProgress(id, progress)
+        })
+        if err != nil {
+            h.logger.Error(fmt.Sprintf("Swap decode error: %v", err))
+            return err
+        }
+        SetJobResult(id, report)
+        return nil
+    })
+
+    c.JSON(http.StatusOK, ApiResponse{ Success: true, JobID: jobID, Message: "Swap decode started" })
+    h.logger.Processing(fmt.Sprintf("JOB %s: Swap decode started for %s", jobID, sourcePath))
+}
+
 // Upload handler
 func (h *WebHandler) handleUpload(c *gin.Context) {
     // optional API token auth
@@ -1127,7 +1437,7 @@ func (h *WebHandler) handleJobStats(c *gin.Context) {
         if p, ok := m["path"].(string); ok { basePath = p }
     }
     if basePath == "" { c.JSON(http.StatusOK, gin.H{"stats": gin.H{}}); return }
-    var images, videos, texts, zips int
+    var images, videos, texts, documents, zips int
     var total int64
     filepath.Walk(basePath, func(path string, info os.FileInfo, err error) error {
         if err != nil || info.IsDir() { return nil }
@@ -1135,6 +1445,7 @@ func (h *WebHandler) handleJobStats(c *gin.Context) {
         if ext == ".jpg" || ext == ".jpeg" || ext == ".png" { images++ }
         if ext == ".mp4" || ext == ".avi" || ext == ".mov" || ext == ".mkv" { videos++ }
         if ext == ".txt" { texts++ }
+        if services.IsDocumentFile(path) { documents++ }
         if ext == ".zip" { zips++ }
         total += info.Size()
         return nil
@@ -1143,6 +1454,7 @@ func (h *WebHandler) handleJobStats(c *gin.Context) {
         "images": images,
         "videos": videos,
         "texts": texts,
+        "documents": documents,
         "zips": zips,
         "totalBytes": total,
     }})
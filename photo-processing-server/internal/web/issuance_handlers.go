@@ -0,0 +1,108 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"photo-processing-server/internal/services"
+)
+
+type IssuanceHandler struct {
+	registry *services.IssuanceRegistry
+	logger   *services.Logger
+}
+
+func NewIssuanceHandler(logger *services.Logger) *IssuanceHandler {
+	return &IssuanceHandler{
+		registry: services.GetIssuanceRegistry(),
+		logger:   logger,
+	}
+}
+
+// SetupRoutes configures issuance registry routes (admin only)
+func (h *IssuanceHandler) SetupRoutes(router *gin.Engine) {
+	admin := router.Group("/api/admin/issuance")
+	admin.Use(requireAdminAuth())
+	{
+		admin.GET("", h.handleListIssuance)
+		admin.GET("/duplicates", h.handleListDuplicates)
+		admin.POST("/similar", h.handleFindSimilar)
+		admin.GET("/:id", h.handleGetIssuance)
+	}
+}
+
+// handleListIssuance lists issued watermarks, newest first.
+// Query filters: order, job, user, recipient, text, sha256.
+func (h *IssuanceHandler) handleListIssuance(c *gin.Context) {
+	records, err := h.registry.List(services.IssuanceFilter{
+		OrderNumber: c.Query("order"),
+		JobID:       c.Query("job"),
+		UserID:      c.Query("user"),
+		Recipient:   c.Query("recipient"),
+		Text:        c.Query("text"),
+		SHA256:      c.Query("sha256"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"records": records, "total": len(records)})
+}
+
+// handleListDuplicates lists watermarks that were issued more than once
+func (h *IssuanceHandler) handleListDuplicates(c *gin.Context) {
+	records, err := h.registry.Duplicates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"records": records, "total": len(records)})
+}
+
+// handleGetIssuance returns a single issuance record
+func (h *IssuanceHandler) handleGetIssuance(c *gin.Context) {
+	record, ok := h.registry.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Issuance record not found"})
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// handleFindSimilar returns the delivered images nearest to an uploaded one
+// by perceptual hash ("file" form field, optional ?limit=, default 10)
+func (h *IssuanceHandler) handleFindSimilar(c *gin.Context) {
+	limit := 10
+	if v := c.Query("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	tempPath, cleanup, err := saveSingleUpload(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer cleanup()
+
+	hash, err := services.ComputePerceptualHash(tempPath)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to hash image: %v", err)})
+		return
+	}
+
+	results, err := h.registry.FindSimilar(hash, filepath.Base(tempPath), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"phash":   services.FormatHash(hash.PHash),
+		"dhash":   services.FormatHash(hash.DHash),
+		"results": results,
+	})
+}
@@ -0,0 +1,127 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"photo-processing-server/internal/config"
+	"photo-processing-server/internal/services"
+)
+
+type LeakTraceHandler struct {
+	logger  *services.Logger
+	sources []services.IssuanceSource
+}
+
+func NewLeakTraceHandler(logger *services.Logger, sources ...services.IssuanceSource) *LeakTraceHandler {
+	return &LeakTraceHandler{
+		logger:  logger,
+		sources: sources,
+	}
+}
+
+// SetupRoutes configures leak tracing routes (admin only)
+func (h *LeakTraceHandler) SetupRoutes(router *gin.Engine) {
+	admin := router.Group("/api/admin/trace")
+	admin.Use(requireAdminAuth())
+	{
+		admin.POST("", h.handleTrace)
+	}
+}
+
+// handleTrace accepts a single leaked file ("file" form field) and reports
+// every watermark found plus the deliveries it matches
+func (h *LeakTraceHandler) handleTrace(c *gin.Context) {
+	tempPath, cleanup, err := saveSingleUpload(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer cleanup()
+
+	report, err := services.TraceLeak(tempPath, h.sources...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Log(fmt.Sprintf("Leak trace for %s: %d evidence item(s), %d match(es)",
+		report.File, len(report.Evidence), len(report.Matches)))
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "report": report})
+}
+
+// saveSingleUpload stores the "file" form field in a fresh temp directory,
+// keeping the original name so extractors and swap-aware matching can use it
+func saveSingleUpload(c *gin.Context) (string, func(), error) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return "", nil, fmt.Errorf("no file uploaded")
+	}
+
+	cfg := config.Load()
+	tempDir := filepath.Join(cfg.TempPath, "upload_"+generateUUID())
+	if err := services.EnsureDirectoryExists(tempDir); err != nil {
+		return "", nil, fmt.Errorf("failed to prepare temp directory: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(tempDir) }
+
+	tempPath := filepath.Join(tempDir, filepath.Base(fileHeader.Filename))
+	if err := c.SaveUploadedFile(fileHeader, tempPath); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to save file: %v", err)
+	}
+	return tempPath, cleanup, nil
+}
+
+// batchJobIssuance matches evidence against batch-copy jobs in the job store
+type batchJobIssuance struct{}
+
+// NewBatchJobIssuanceSource returns an issuance source backed by batch jobs
+func NewBatchJobIssuanceSource() services.IssuanceSource {
+	return batchJobIssuance{}
+}
+
+func (batchJobIssuance) FindIssuance(evidence services.LeakEvidence) []services.IssuanceMatch {
+	var matches []services.IssuanceMatch
+	for _, summary := range ListJobs() {
+		job, ok := GetJob(summary.ID)
+		if !ok {
+			continue
+		}
+		result, ok := job.Result.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		baseText, _ := result["baseText"].(string)
+		numCopies := 0
+		// In-memory results hold ints, Redis round-trips them as float64
+		switch n := result["numberOfCopies"].(type) {
+		case int:
+			numCopies = n
+		case float64:
+			numCopies = int(n)
+		}
+		if baseText == "" || numCopies == 0 {
+			continue
+		}
+
+		orderNumber, copyNumber, ok := services.MatchBatchCopy(baseText, numCopies, evidence)
+		if !ok {
+			continue
+		}
+		matches = append(matches, services.IssuanceMatch{
+			Source:      "batch_job",
+			JobID:       job.ID,
+			UserID:      job.UserID,
+			OrderNumber: orderNumber,
+			CopyNumber:  copyNumber,
+			IssuedAt:    job.StartTime,
+			Extractor:   evidence.Extractor,
+		})
+	}
+	return matches
+}
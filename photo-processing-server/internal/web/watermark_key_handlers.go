@@ -0,0 +1,87 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"photo-processing-server/internal/services"
+)
+
+type WatermarkKeyHandler struct {
+	keyring *services.WatermarkKeyring
+	logger  *services.Logger
+}
+
+func NewWatermarkKeyHandler(logger *services.Logger) *WatermarkKeyHandler {
+	return &WatermarkKeyHandler{
+		keyring: services.GetWatermarkKeyring(),
+		logger:  logger,
+	}
+}
+
+// SetupRoutes configures watermark key management routes (admin only)
+func (h *WatermarkKeyHandler) SetupRoutes(router *gin.Engine) {
+	admin := router.Group("/api/admin/watermark-keys")
+	admin.Use(requireAdminAuth())
+	{
+		admin.GET("", h.handleListKeys)
+		admin.POST("", h.handleAddKey)
+		admin.POST("/:id/retire", h.handleRetireKey)
+	}
+}
+
+// handleListKeys lists all watermark keys without their secrets
+func (h *WatermarkKeyHandler) handleListKeys(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"keys": h.keyring.List()})
+}
+
+// handleAddKey registers a new key and makes it the active one.
+// The secret is returned only once so it can be backed up.
+func (h *WatermarkKeyHandler) handleAddKey(c *gin.Context) {
+	var req struct {
+		ID     string `json:"id"`
+		Secret string `json:"secret"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	key, err := h.keyring.Add(req.ID, req.Secret)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Log(fmt.Sprintf("Watermark key %s added and activated", key.ID))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"id":         key.ID,
+		"secret":     key.Secret,
+		"created_at": key.CreatedAt,
+	})
+}
+
+// handleRetireKey stops a key from sealing new payloads
+func (h *WatermarkKeyHandler) handleRetireKey(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.keyring.Retire(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Log(fmt.Sprintf("Watermark key %s retired", id))
+
+	active := ""
+	if key := h.keyring.Active(); key != nil {
+		active = key.ID
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"message":    "Key retired",
+		"active_key": active,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,6 +18,19 @@ type WooCommerceHandler struct {
 	wpService        *services.WordPressService
 	notificationService *services.NotificationService
 	downloadLinks    map[string]*models.DownloadLink
+	issuedOrders     []wooIssuance
+	issuedMutex      sync.Mutex
+}
+
+// wooIssuance records which copies were produced for a WooCommerce order
+type wooIssuance struct {
+	jobID         string
+	orderID       string
+	customerEmail string
+	baseText      string
+	numCopies     int
+	downloadToken string
+	issuedAt      time.Time
 }
 
 // WooCommerce order processing request
@@ -33,9 +47,15 @@ type WooCommerceProcessRequest struct {
 		BaseText             string                 `json:"base_text"`
 		AddSwap              bool                   `json:"add_swap"`
 		SwapPairs            []map[string]string    `json:"swap_pairs"`
+		SwapStrategy         string                 `json:"swap_strategy"`
+		SwapCount            int                    `json:"swap_count"`
 		AddWatermark         bool                   `json:"add_watermark"`
-		WatermarkPositions   []int                  `json:"watermark_positions"`
+		WatermarkPositions   services.PhotoNumbers  `json:"watermark_positions"`
+		WatermarkTexts       map[int]string         `json:"watermark_texts"`
 		AddVisibleWatermark  bool                   `json:"add_visible_watermark"`
+		AddRobustWatermark   bool                   `json:"add_robust_watermark"`
+		StructuredPayload    bool                   `json:"structured_payload"`
+		TextWatermarkMode    string                 `json:"text_watermark_mode"`
 		VisibleWatermarkText string                 `json:"visible_watermark_text"`
 		CreateZip            bool                   `json:"create_zip"`
 		ZipName              string                 `json:"zip_name"`
@@ -123,16 +143,24 @@ func (h *WooCommerceHandler) processOrderAsync(jobID string, req WooCommerceProc
 		BaseText:            req.Settings.BaseText,
 		AddSwapEncoding:     req.Settings.AddSwap,
 		SwapPairs:           req.Settings.SwapPairs,
+		SwapStrategy:        req.Settings.SwapStrategy,
+		SwapCount:           req.Settings.SwapCount,
 		AddVisibleWatermark: req.Settings.WatermarkText != "",
 		WatermarkPositions:  req.Settings.WatermarkPositions,
+		WatermarkTexts:      req.Settings.WatermarkTexts,
+		AddRobustWatermark:  req.Settings.AddRobustWatermark,
+		StructuredPayload:   req.Settings.StructuredPayload,
+		TextWatermarkMode:   req.Settings.TextWatermarkMode,
 		CreateZip:           req.Settings.CreateZip,
 		WatermarkText:       req.Settings.WatermarkText,
+		Recipient:           req.CustomerEmail,
+		JobID:               jobID,
 	}
 
 	// For demo purposes, simulate processing time
 	time.Sleep(2 * time.Second)
 
-	err := h.processor.PerformBatchCopy(req.Settings.SourceFolder, settings, func(progress float64) {
+	result, err := h.processor.PerformBatchCopy(req.Settings.SourceFolder, settings, func(progress float64) {
 		h.logger.Log(fmt.Sprintf("Job %s progress: %.1f%%", jobID, progress*100))
 	})
 
@@ -142,6 +170,9 @@ func (h *WooCommerceHandler) processOrderAsync(jobID string, req WooCommerceProc
 		h.notificationService.SendProcessingStatus(req.OrderID, req.CustomerEmail, "failed")
 		return
 	}
+	for orderNumber, swaps := range result.Swaps {
+		h.logger.Log(fmt.Sprintf("Job %s copy %s: %d file swaps", jobID, orderNumber, len(swaps)))
+	}
 
 	// Send notification to admin that processing is complete and awaiting approval
 	h.notificationService.SendAdminAlert(req.OrderID, jobID)
@@ -173,6 +204,19 @@ func (h *WooCommerceHandler) processOrderAsync(jobID string, req WooCommerceProc
 	// Store download link (in production, use database)
 	h.downloadLinks[downloadLink.Token] = downloadLink
 
+	// Record issued copies for leak tracing
+	h.issuedMutex.Lock()
+	h.issuedOrders = append(h.issuedOrders, wooIssuance{
+		jobID:         jobID,
+		orderID:       req.OrderID,
+		customerEmail: req.CustomerEmail,
+		baseText:      req.Settings.BaseText,
+		numCopies:     req.Settings.NumCopies,
+		downloadToken: downloadLink.Token,
+		issuedAt:      downloadLink.CreatedAt,
+	})
+	h.issuedMutex.Unlock()
+
 	h.logger.Log(fmt.Sprintf("Job %s completed. Awaiting admin approval. Download link: %s (expires: %s)",
 		jobID, downloadLink.Token, downloadLink.ExpiresAt.Format("2006-01-02 15:04:05")))
 }
@@ -372,3 +416,29 @@ func (h *WooCommerceHandler) handleRevokeLink(c *gin.Context) {
 		"message": "Download link revoked",
 	})
 }
+
+// FindIssuance matches leak evidence against processed WooCommerce orders
+func (h *WooCommerceHandler) FindIssuance(evidence services.LeakEvidence) []services.IssuanceMatch {
+	h.issuedMutex.Lock()
+	defer h.issuedMutex.Unlock()
+
+	var matches []services.IssuanceMatch
+	for _, issued := range h.issuedOrders {
+		orderNumber, copyNumber, ok := services.MatchBatchCopy(issued.baseText, issued.numCopies, evidence)
+		if !ok {
+			continue
+		}
+		matches = append(matches, services.IssuanceMatch{
+			Source:        "woocommerce",
+			JobID:         issued.jobID,
+			OrderID:       issued.orderID,
+			CustomerEmail: issued.customerEmail,
+			OrderNumber:   orderNumber,
+			CopyNumber:    copyNumber,
+			IssuedAt:      issued.issuedAt,
+			DownloadToken: issued.downloadToken,
+			Extractor:     evidence.Extractor,
+		})
+	}
+	return matches
+}
@@ -5,6 +5,7 @@ interface JobStats {
   images: number;
   videos: number;
   texts: number;
+  documents?: number;
   zips: number;
   totalBytes: number;
 }
@@ -85,7 +85,7 @@ const FileSelector: React.FC = () => {
         type="file"
         multiple
         {...({ webkitdirectory: "", directory: "" } as any)}
-        accept=".jpg,.jpeg,.png,.mp4,.avi,.mov,.mkv,.txt"
+        accept=".jpg,.jpeg,.png,.mp4,.avi,.mov,.mkv,.txt,.pdf,.docx,.svg,.html,.htm,.csv"
         onChange={handleFileInputChange}
         className="hidden"
         disabled={isProcessing}
@@ -1,6 +1,7 @@
 import React, { useState } from 'react';
 import { useApp } from '../../contexts/AppContext';
-import { AddTextSettings } from '../../types';
+import { AddTextSettings, VisibleWatermarkStyle } from '../../types';
+import VisibleStyleFields, { styleOrDefault } from './VisibleStyleFields';
 
 const AddTextDialog: React.FC = () => {
   const { toggleDialog, addTextToPhoto } = useApp();
@@ -8,6 +9,7 @@ const AddTextDialog: React.FC = () => {
   // State matching Kotlin AddTextDialog
   const [textToAdd, setTextToAdd] = useState('');
   const [photoNumber, setPhotoNumber] = useState('');
+  const [style, setStyle] = useState<VisibleWatermarkStyle>({});
   const [showError, setShowError] = useState(false);
 
   const handleConfirm = async () => {
@@ -19,7 +21,8 @@ const AddTextDialog: React.FC = () => {
 
     const settings: AddTextSettings = {
       text: textToAdd.trim(),
-      photoNumber: number
+      photoNumber: number,
+      style: styleOrDefault(style)
     };
 
     await addTextToPhoto(settings);
@@ -74,6 +77,9 @@ const AddTextDialog: React.FC = () => {
             </p>
           </div>
 
+          {/* Text Style */}
+          <VisibleStyleFields style={style} onChange={setStyle} />
+
           {/* Error Message */}
           {showError && (
             <div className="bg-red-50 dark:bg-red-900/20 border border-red-200 dark:border-red-800 rounded p-3">
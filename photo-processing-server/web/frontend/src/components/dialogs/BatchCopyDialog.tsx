@@ -1,6 +1,7 @@
 import React, { useState } from 'react';
 import { useApp } from '../../contexts/AppContext';
-import { BatchCopySettings } from '../../types';
+import { BatchCopySettings, LogoWatermark, SwapStrategy, VisibleWatermarkStyle } from '../../types';
+import VisibleStyleFields, { styleOrDefault } from './VisibleStyleFields';
 
 const BatchCopyDialog: React.FC = () => {
   const { toggleDialog, performBatchCopy } = useApp();
@@ -9,11 +10,21 @@ const BatchCopyDialog: React.FC = () => {
   const [numberOfCopies, setNumberOfCopies] = useState('');
   const [baseText, setBaseText] = useState('ORDER');
   const [addSwapEncoding, setAddSwapEncoding] = useState(false);
+  const [swapStrategy, setSwapStrategy] = useState<SwapStrategy>('offset');
+  const [swapPairs, setSwapPairs] = useState('');
+  const [swapCount, setSwapCount] = useState('');
   const [addVisibleWatermark, setAddVisibleWatermark] = useState(false);
+  const [addRobustWatermark, setAddRobustWatermark] = useState(false);
+  const [structuredPayload, setStructuredPayload] = useState(false);
+  const [zeroWidthText, setZeroWidthText] = useState(false);
   const [createZip, setCreateZip] = useState(false);
   const [watermarkText, setWatermarkText] = useState('');
   const [useOrderNumber, setUseOrderNumber] = useState(true);
   const [photoNumber, setPhotoNumber] = useState('');
+  const [photoPositions, setPhotoPositions] = useState('');
+  const [visibleStyle, setVisibleStyle] = useState<VisibleWatermarkStyle>({});
+  const [addLogo, setAddLogo] = useState(false);
+  const [logo, setLogo] = useState<LogoWatermark>({});
   const [showError, setShowError] = useState(false);
 
   const handleConfirm = async () => {
@@ -23,15 +34,33 @@ const BatchCopyDialog: React.FC = () => {
       return;
     }
 
+    // "3:7, 12:15" -> [{a: "3", b: "7"}, {a: "12", b: "15"}]
+    const pairs = swapPairs.split(',').map((pair) => pair.split(':').map((n) => n.trim()))
+      .filter((pair) => pair.length === 2 && pair[0] && pair[1])
+      .map(([a, b]) => ({ a, b }));
+    if (addSwapEncoding && swapStrategy === 'pairs' && pairs.length === 0) {
+      setShowError(true);
+      return;
+    }
+
     const settings: BatchCopySettings = {
       numberOfCopies: copies,
       baseText: baseText.trim(),
       addSwapEncoding,
+      swapStrategy: addSwapEncoding ? swapStrategy : undefined,
+      swapPairs: addSwapEncoding && swapStrategy === 'pairs' ? pairs : undefined,
+      swapCount: addSwapEncoding && (swapStrategy === 'random' || swapStrategy === 'rotate') ? parseInt(swapCount) || undefined : undefined,
       addVisibleWatermark,
+      addRobustWatermark,
+      structuredPayload,
+      textWatermarkMode: zeroWidthText ? 'zero-width' : undefined,
       createZip,
       watermarkText: addVisibleWatermark ? watermarkText : undefined,
+      visibleWatermarkStyle: addVisibleWatermark ? styleOrDefault(visibleStyle) : undefined,
+      logoWatermark: addLogo ? logo : undefined,
       photoNumber: addVisibleWatermark && !useOrderNumber ? parseInt(photoNumber) || undefined : undefined,
-      useOrderNumberAsPhotoNumber: addVisibleWatermark ? useOrderNumber : undefined
+      useOrderNumberAsPhotoNumber: addVisibleWatermark ? useOrderNumber : undefined,
+      watermarkPositions: addVisibleWatermark && photoPositions.trim() ? photoPositions.trim() : undefined
     };
 
     await performBatchCopy(settings);
@@ -107,6 +136,58 @@ const BatchCopyDialog: React.FC = () => {
               Additional Swap File Encoding (e.g., swap 003 with 103)
             </label>
 
+            {addSwapEncoding && (
+              <div className="ml-6 grid grid-cols-2 gap-3">
+                <div>
+                  <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Swap strategy</label>
+                  <select
+                    value={swapStrategy}
+                    onChange={(e) => setSwapStrategy(e.target.value as SwapStrategy)}
+                    className="w-full h-8 px-2 border border-gray-300 dark:border-gray-700 rounded text-sm
+                             bg-white dark:bg-gray-900 text-gray-900 dark:text-gray-100
+                             focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent"
+                  >
+                    <option value="offset">Order number with +10</option>
+                    <option value="random">Random (seeded by order number)</option>
+                    <option value="rotate">Rotate order number, +10, +20...</option>
+                    <option value="pairs">Explicit pairs</option>
+                  </select>
+                </div>
+
+                {swapStrategy === 'pairs' && (
+                  <div>
+                    <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Pairs</label>
+                    <input
+                      type="text"
+                      value={swapPairs}
+                      onChange={(e) => setSwapPairs(e.target.value.replace(/[^\d,:\s]/g, ''))}
+                      className="w-full h-8 px-2 border border-gray-300 dark:border-gray-700 rounded text-sm
+                               bg-white dark:bg-gray-900 text-gray-900 dark:text-gray-100
+                               focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent"
+                      placeholder="3:7, 12:15"
+                    />
+                  </div>
+                )}
+
+                {(swapStrategy === 'random' || swapStrategy === 'rotate') && (
+                  <div>
+                    <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Photos per copy</label>
+                    <input
+                      type="number"
+                      min={2}
+                      max={100}
+                      value={swapCount}
+                      onChange={(e) => setSwapCount(e.target.value)}
+                      className="w-full h-8 px-2 border border-gray-300 dark:border-gray-700 rounded text-sm
+                               bg-white dark:bg-gray-900 text-gray-900 dark:text-gray-100
+                               focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent"
+                      placeholder="3"
+                    />
+                  </div>
+                )}
+              </div>
+            )}
+
             <label className="flex items-center text-sm text-gray-700 dark:text-gray-300">
               <input
                 type="checkbox"
@@ -117,6 +198,46 @@ const BatchCopyDialog: React.FC = () => {
               Add visible watermark to photos
             </label>
 
+            <label className="flex items-center text-sm text-gray-700 dark:text-gray-300">
+              <input
+                type="checkbox"
+                checked={addLogo}
+                onChange={(e) => setAddLogo(e.target.checked)}
+                className="mr-2 h-4 w-4 text-blue-600 focus:ring-blue-500 border-gray-300 dark:border-gray-600 rounded"
+              />
+              Stamp studio logo on photos
+            </label>
+
+            <label className="flex items-center text-sm text-gray-700 dark:text-gray-300">
+              <input
+                type="checkbox"
+                checked={addRobustWatermark}
+                onChange={(e) => setAddRobustWatermark(e.target.checked)}
+                className="mr-2 h-4 w-4 text-blue-600 focus:ring-blue-500 border-gray-300 dark:border-gray-600 rounded"
+              />
+              Add robust pixel watermark (survives re-save, resize and crop)
+            </label>
+
+            <label className="flex items-center text-sm text-gray-700 dark:text-gray-300">
+              <input
+                type="checkbox"
+                checked={structuredPayload}
+                onChange={(e) => setStructuredPayload(e.target.checked)}
+                className="mr-2 h-4 w-4 text-blue-600 focus:ring-blue-500 border-gray-300 dark:border-gray-600 rounded"
+              />
+              Structured watermark (order, copy, recipient, issue time, issuer)
+            </label>
+
+            <label className="flex items-center text-sm text-gray-700 dark:text-gray-300">
+              <input
+                type="checkbox"
+                checked={zeroWidthText}
+                onChange={(e) => setZeroWidthText(e.target.checked)}
+                className="mr-2 h-4 w-4 text-blue-600 focus:ring-blue-500 border-gray-300 dark:border-gray-600 rounded"
+              />
+              Hide text file watermarks as zero-width characters
+            </label>
+
             <label className="flex items-center text-sm text-gray-700 dark:text-gray-300">
               <input
                 type="checkbox"
@@ -149,17 +270,35 @@ const BatchCopyDialog: React.FC = () => {
                 </p>
               </div>
 
-              <label className="flex items-center text-sm text-gray-700 dark:text-gray-300">
+              <div>
+                <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Photos to mark</label>
                 <input
-                  type="checkbox"
-                  checked={useOrderNumber}
-                  onChange={(e) => setUseOrderNumber(e.target.checked)}
-                  className="mr-2 h-4 w-4 text-blue-600 focus:ring-blue-500 border-gray-300 dark:border-gray-600 rounded"
+                  type="text"
+                  value={photoPositions}
+                  onChange={(e) => setPhotoPositions(e.target.value.replace(/[^\d,\s-]/g, ''))}
+                  className="w-full h-8 px-2 border border-gray-300 dark:border-gray-700 rounded text-sm
+                           bg-white dark:bg-gray-900 text-gray-900 dark:text-gray-100
+                           focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent"
+                  placeholder="1-5,12"
                 />
-                Use order number as photo number
-              </label>
+                <p className="text-xs text-gray-500 dark:text-gray-400 mt-1">
+                  Photo numbers and ranges to stamp in every copy; leave empty to mark a single photo
+                </p>
+              </div>
+
+              {!photoPositions.trim() && (
+                <label className="flex items-center text-sm text-gray-700 dark:text-gray-300">
+                  <input
+                    type="checkbox"
+                    checked={useOrderNumber}
+                    onChange={(e) => setUseOrderNumber(e.target.checked)}
+                    className="mr-2 h-4 w-4 text-blue-600 focus:ring-blue-500 border-gray-300 dark:border-gray-600 rounded"
+                  />
+                  Use order number as photo number
+                </label>
+              )}
 
-              {!useOrderNumber && (
+              {!photoPositions.trim() && !useOrderNumber && (
                 <div>
                   <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Photo number</label>
                   <input
@@ -179,6 +318,81 @@ const BatchCopyDialog: React.FC = () => {
                   </p>
                 </div>
               )}
+
+              <VisibleStyleFields style={visibleStyle} onChange={setVisibleStyle} />
+            </div>
+          )}
+
+          {/* Logo Settings Card - Show only if the logo is enabled */}
+          {addLogo && (
+            <div className="bg-blue-50 dark:bg-blue-900/20 rounded-lg p-4 space-y-3">
+              <h3 className="text-sm font-medium text-gray-900 dark:text-gray-100">Logo Settings</h3>
+
+              <div className="grid grid-cols-2 gap-3">
+                <div>
+                  <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Position</label>
+                  <select
+                    value={logo.position ?? 'bottom-right'}
+                    onChange={(e) => setLogo({ ...logo, position: e.target.value as LogoWatermark['position'] })}
+                    className="w-full h-8 px-2 border border-gray-300 dark:border-gray-700 rounded text-sm
+                             bg-white dark:bg-gray-900 text-gray-900 dark:text-gray-100
+                             focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent"
+                  >
+                    <option value="bottom-right">Bottom right</option>
+                    <option value="bottom-left">Bottom left</option>
+                    <option value="top-right">Top right</option>
+                    <option value="top-left">Top left</option>
+                    <option value="center">Center</option>
+                  </select>
+                </div>
+
+                <div>
+                  <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Size (% of shorter side)</label>
+                  <input
+                    type="number"
+                    min={1}
+                    max={100}
+                    value={logo.scale ? logo.scale * 100 : ''}
+                    onChange={(e) => setLogo({ ...logo, scale: parseFloat(e.target.value) / 100 || undefined })}
+                    className="w-full h-8 px-2 border border-gray-300 dark:border-gray-700 rounded text-sm
+                             bg-white dark:bg-gray-900 text-gray-900 dark:text-gray-100
+                             focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent"
+                    placeholder="15"
+                  />
+                </div>
+
+                <div>
+                  <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Offset X / Y (px)</label>
+                  <div className="flex gap-2">
+                    {(['offsetX', 'offsetY'] as const).map((field) => (
+                      <input
+                        key={field}
+                        type="number"
+                        value={logo[field] ?? ''}
+                        onChange={(e) => setLogo({ ...logo, [field]: parseInt(e.target.value) || undefined })}
+                        className="w-full h-8 px-2 border border-gray-300 dark:border-gray-700 rounded text-sm
+                                 bg-white dark:bg-gray-900 text-gray-900 dark:text-gray-100
+                                 focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent"
+                        placeholder="0"
+                      />
+                    ))}
+                  </div>
+                </div>
+
+                <div>
+                  <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">
+                    Opacity ({Math.round((logo.opacity ?? 1) * 100)}%)
+                  </label>
+                  <input
+                    type="range"
+                    min={5}
+                    max={100}
+                    value={Math.round((logo.opacity ?? 1) * 100)}
+                    onChange={(e) => setLogo({ ...logo, opacity: parseInt(e.target.value) / 100 })}
+                    className="w-full h-8"
+                  />
+                </div>
+              </div>
             </div>
           )}
 
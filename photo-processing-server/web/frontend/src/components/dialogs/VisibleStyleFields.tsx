@@ -0,0 +1,193 @@
+import React, { useEffect, useState } from 'react';
+import { FontList, VisibleWatermarkStyle } from '../../types';
+import { getFonts } from '../../services/api';
+
+const HERSHEY_FONTS = [
+  'complex', 'complex-small', 'duplex', 'plain', 'script-complex', 'script-simplex', 'simplex', 'triplex',
+];
+
+const POSITIONS: { value: NonNullable<VisibleWatermarkStyle['position']>; label: string }[] = [
+  { value: 'bottom-right', label: 'Bottom right' },
+  { value: 'bottom-left', label: 'Bottom left' },
+  { value: 'top-right', label: 'Top right' },
+  { value: 'top-left', label: 'Top left' },
+  { value: 'center', label: 'Center' },
+  { value: 'tiled', label: 'Tiled (diagonal, whole photo)' },
+];
+
+interface VisibleStyleFieldsProps {
+  style: VisibleWatermarkStyle;
+  onChange: (style: VisibleWatermarkStyle) => void;
+}
+
+const inputClass = `w-full h-8 px-2 border border-gray-300 dark:border-gray-700 rounded text-sm
+                    bg-white dark:bg-gray-900 text-gray-900 dark:text-gray-100
+                    focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent`;
+
+// Size is edited in percent of the shorter image side; 0 keeps the original size
+const VisibleStyleFields: React.FC<VisibleStyleFieldsProps> = ({ style, onChange }) => {
+  const [fonts, setFonts] = useState<FontList>({ hershey: HERSHEY_FONTS, trueType: [] });
+  const update = (changes: Partial<VisibleWatermarkStyle>) => onChange({ ...style, ...changes });
+
+  useEffect(() => {
+    getFonts().then(setFonts).catch(() => { /* keep the built-in fonts */ });
+  }, []);
+  const pixels = (value: string) => parseInt(value.replace(/\D/g, '')) || undefined;
+
+  return (
+    <div className="grid grid-cols-2 gap-3">
+      <div>
+        <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Font</label>
+        <select
+          value={style.font ?? 'simplex'}
+          onChange={(e) => update({ font: e.target.value })}
+          className={inputClass}
+        >
+          <optgroup label="Built-in (Latin only)">
+            {fonts.hershey.map((font) => <option key={font} value={font}>{font}</option>)}
+          </optgroup>
+          {fonts.trueType.length > 0 && (
+            <optgroup label="TrueType">
+              {fonts.trueType.map((font) => <option key={font.name} value={font.name}>{font.fullName || font.name}</option>)}
+            </optgroup>
+          )}
+        </select>
+      </div>
+
+      <div>
+        <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Size (% of shorter side)</label>
+        <input
+          type="number"
+          min={0}
+          max={50}
+          step={0.5}
+          value={style.size ? style.size * 100 : ''}
+          onChange={(e) => update({ size: parseFloat(e.target.value) / 100 || undefined })}
+          className={inputClass}
+          placeholder="original"
+        />
+      </div>
+
+      <div>
+        <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Position</label>
+        <select
+          value={style.position ?? 'bottom-right'}
+          onChange={(e) => {
+            const position = e.target.value as VisibleWatermarkStyle['position'];
+            update(position === 'tiled'
+              ? { position }
+              : { position: position === 'bottom-right' ? undefined : position, angle: undefined, spacing: undefined });
+          }}
+          className={inputClass}
+        >
+          {POSITIONS.map((position) => <option key={position.value} value={position.value}>{position.label}</option>)}
+        </select>
+      </div>
+
+      {style.position === 'tiled' ? (
+        <div className="grid grid-cols-2 gap-2">
+          <div>
+            <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Angle (°)</label>
+            <input
+              type="number"
+              min={-90}
+              max={90}
+              value={style.angle ?? ''}
+              onChange={(e) => {
+                const angle = parseFloat(e.target.value);
+                update({ angle: isNaN(angle) ? undefined : angle });
+              }}
+              className={inputClass}
+              placeholder="30"
+            />
+          </div>
+          <div>
+            <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Spacing (%)</label>
+            <input
+              type="number"
+              min={0}
+              max={100}
+              value={style.spacing ? style.spacing * 100 : ''}
+              onChange={(e) => update({ spacing: parseFloat(e.target.value) / 100 || undefined })}
+              className={inputClass}
+              placeholder="10"
+            />
+          </div>
+        </div>
+      ) : <div />}
+
+      <div>
+        <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Colour</label>
+        <input
+          type="color"
+          value={style.color ?? '#ffffff'}
+          onChange={(e) => update({ color: e.target.value })}
+          className="w-full h-8 border border-gray-300 dark:border-gray-700 rounded"
+        />
+      </div>
+
+      <div>
+        <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">
+          Opacity ({Math.round((style.opacity ?? 0.5) * 100)}%)
+        </label>
+        <input
+          type="range"
+          min={5}
+          max={100}
+          value={Math.round((style.opacity ?? 0.5) * 100)}
+          onChange={(e) => update({ opacity: parseInt(e.target.value) / 100 })}
+          className="w-full h-8"
+        />
+      </div>
+
+      <div>
+        <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Outline (px)</label>
+        <input
+          type="text"
+          value={style.outline ?? ''}
+          onChange={(e) => update({ outline: pixels(e.target.value) })}
+          className={inputClass}
+          placeholder="0"
+        />
+      </div>
+
+      <div>
+        <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Shadow (px)</label>
+        <input
+          type="text"
+          value={style.shadow ?? ''}
+          onChange={(e) => update({ shadow: pixels(e.target.value) })}
+          className={inputClass}
+          placeholder="0"
+        />
+      </div>
+
+      <div>
+        <label className="block text-sm text-gray-700 dark:text-gray-300 mb-1">Padding (px)</label>
+        <input
+          type="text"
+          value={style.padding ?? ''}
+          onChange={(e) => update({ padding: pixels(e.target.value) })}
+          className={inputClass}
+          placeholder="5"
+        />
+      </div>
+
+      <label className="flex items-center text-sm text-gray-700 dark:text-gray-300 mt-6">
+        <input
+          type="checkbox"
+          checked={style.italic ?? false}
+          onChange={(e) => update({ italic: e.target.checked || undefined })}
+          className="mr-2 h-4 w-4 text-blue-600 focus:ring-blue-500 border-gray-300 dark:border-gray-600 rounded"
+        />
+        Italic
+      </label>
+    </div>
+  );
+};
+
+// styleOrDefault drops a style the user left untouched
+export const styleOrDefault = (style: VisibleWatermarkStyle): VisibleWatermarkStyle | undefined =>
+  Object.values(style).some((value) => value !== undefined) ? style : undefined;
+
+export default VisibleStyleFields;
@@ -1,9 +1,11 @@
 import { 
   EncryptRequest, 
   DecryptRequest, 
+  VerifyRequest,
   BatchCopyRequest, 
   AddTextRequest, 
   RemoveWatermarksRequest, 
+  FontList,
   ProcessingJob,
   User,
   UserStats,
@@ -76,6 +78,40 @@ export async function decrypt(request: DecryptRequest): Promise<ApiResponse> {
   });
 }
 
+// Per-mark results of a finished decrypt job, as a download URL
+export function decryptReportUrl(jobId: string, format: 'json' | 'csv' = 'json'): string {
+  return `${API_BASE}/decrypt/${encodeURIComponent(jobId)}/report?format=${format}`;
+}
+
+export async function verify(request: VerifyRequest): Promise<ApiResponse> {
+  return fetchApi<ApiResponse>('/verify', {
+    method: 'POST',
+    body: JSON.stringify(request),
+  });
+}
+
+// Report of a finished verify job, as a download URL
+export function verifyReportUrl(jobId: string, format: 'json' | 'csv' = 'json'): string {
+  return `${API_BASE}/verify/${encodeURIComponent(jobId)}/report?format=${format}`;
+}
+
+// Compares a suspect ZIP (or a folder on the server) with the source folder
+// of a batch to recover the order number from the swapped photos
+export async function decodeSwaps(sourcePath: string, suspect: File | string): Promise<ApiResponse> {
+  const formData = new FormData();
+  formData.append('sourcePath', sourcePath);
+  if (typeof suspect === 'string') {
+    formData.append('suspectPath', suspect);
+  } else {
+    formData.append('file', suspect);
+  }
+
+  return fetchApi<ApiResponse>('/swap-decode', {
+    method: 'POST',
+    body: formData,
+  });
+}
+
 export async function batchCopy(request: BatchCopyRequest): Promise<ApiResponse> {
   return fetchApi<ApiResponse>('/batch-copy', {
     method: 'POST',
@@ -90,6 +126,10 @@ export async function addText(request: AddTextRequest): Promise<ApiResponse> {
   });
 }
 
+export async function getFonts(): Promise<FontList> {
+  return fetchApi<FontList>('/fonts');
+}
+
 export async function removeWatermarks(request: RemoveWatermarksRequest): Promise<ApiResponse> {
   return fetchApi<ApiResponse>('/remove-watermarks', {
     method: 'POST',
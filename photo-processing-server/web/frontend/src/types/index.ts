@@ -26,34 +26,187 @@ export interface ProcessingState {
   progress: number; // 0.0 to 1.0
 }
 
+// How batch copies swap photos: N with N+10, explicit pairs, a seeded random cycle or an N, N+10, N+20... rotation
+export type SwapStrategy = 'offset' | 'pairs' | 'random' | 'rotate';
+
 // Batch copy settings (matches BatchCopyDialog.kt parameters)
 export interface BatchCopySettings {
   numberOfCopies: number;
   baseText: string;
   addSwapEncoding: boolean;
+  swapStrategy?: SwapStrategy;
+  swapPairs?: { a: string; b: string; order?: string }[];  // photo numbers; order limits a pair to one copy
+  swapCount?: number;                                       // photos in random and rotate swaps (default 3)
   addVisibleWatermark: boolean;
+  addRobustWatermark?: boolean;
+  structuredPayload?: boolean;
+  watermarkOwner?: string;
+  textWatermarkMode?: TextWatermarkMode;
+  visibleWatermarkStyle?: VisibleWatermarkStyle;
+  logoWatermark?: LogoWatermark;  // stamps the server's WATERMARK_LOGO onto every photo
   createZip: boolean;
   watermarkText?: string;
   photoNumber?: number;
   useOrderNumberAsPhotoNumber?: boolean;
+  watermarkPositions?: string | (number | string)[];  // photos to stamp, e.g. "1-5,12"; overrides photoNumber
+  watermarkTexts?: Record<number, string>;            // visible text per photo number
 }
 
 // Add text settings (matches AddTextDialog.kt)
 export interface AddTextSettings {
   text: string;
   photoNumber: number;
+  style?: VisibleWatermarkStyle;
+}
+
+// Fonts accepted by VisibleWatermarkStyle.font (GET /api/fonts)
+export interface FontList {
+  hershey: string[];                                // OpenCV built-in, ASCII only
+  trueType: { name: string; fullName?: string }[];  // TTF/OTF fonts of the server's FONTS_DIR
+  default?: string;                                 // TrueType fallback for non-ASCII text
+}
+
+// Look of the visible watermark; omitted fields keep the original small white text
+export interface VisibleWatermarkStyle {
+  font?: string;          // a Hershey or TrueType name from FontList
+  italic?: boolean;       // Hershey fonts only
+  size?: number;          // text height as a fraction of the shorter image side (0-0.5)
+  color?: string;         // "#RRGGBB" or "#RRGGBBAA"
+  opacity?: number;       // 0-1
+  outline?: number;       // stroke width in pixels
+  outlineColor?: string;
+  shadow?: number;        // drop shadow offset in pixels
+  shadowColor?: string;
+  padding?: number;       // distance from the image edge in pixels
+  position?: 'top-left' | 'top-right' | 'center' | 'bottom-left' | 'bottom-right' | 'tiled';
+  angle?: number;         // tiled only: rotation in degrees counter-clockwise (default 30)
+  spacing?: number;       // tiled only: gap between repeats as a fraction of the shorter side (0-1)
+}
+
+// Placement of the logo overlay; omitted fields keep a 15% logo in the bottom-right corner
+export interface LogoWatermark {
+  scale?: number;         // longer logo side as a fraction of the shorter image side (0-1)
+  position?: 'top-left' | 'top-right' | 'center' | 'bottom-left' | 'bottom-right';
+  offsetX?: number;       // pixels, positive moves right
+  offsetY?: number;       // pixels, positive moves down
+  opacity?: number;       // 0-1, multiplied by the logo's alpha
 }
 
 // API request/response types
 export interface EncryptRequest {
   selectedPath: string;
   nameToInject: string;
+  owner?: string;        // labels the mark in the file's watermark chain
+  textMode?: TextWatermarkMode;
 }
 
+// How .txt files are marked: appended <<==...==>> or zero-width characters in the body
+export type TextWatermarkMode = 'visible' | 'zero-width';
+
 export interface DecryptRequest {
   selectedPath: string;
 }
 
+export interface WatermarkPayloadFields {
+  orderId: string;
+  copyIndex?: number;
+  recipientId?: string;
+  issuedAt: string;
+  issuer?: string;
+  keyId?: string;
+  baseText?: string;
+}
+
+// One mark of a file (or the file itself, without payload, when it has none)
+export interface DecryptResult {
+  path: string;
+  index: number;
+  owner?: string;
+  format?: string;
+  payload?: string;
+  text?: string;
+  status?: string;
+  keyId?: string;
+  fields?: WatermarkPayloadFields;
+  error?: string;
+}
+
+export interface DecryptReport {
+  folder: string;
+  scanned: number;
+  found: number;
+  results: DecryptResult[];
+}
+
+export interface VerifyRequest {
+  selectedPath: string;
+}
+
+export interface FileVerification {
+  path: string;
+  watermarked: boolean;
+  marks: number;
+  format?: string;
+  version?: 'v2' | 'caesar';
+  structured: boolean;
+  status?: string;
+  macValid: boolean | null;
+  keyId?: string;
+  text?: string;
+  integrity: 'match' | 'modified' | 'unrecorded';
+  recordId?: string;
+  visibleWatermark: 'present' | 'absent' | 'not_checked';
+  visibleText?: string;
+  visibleContrast?: number;
+  error?: string;
+}
+
+export interface VerificationReport {
+  folder: string;
+  generatedAt: string;
+  summary: {
+    total: number;
+    watermarked: number;
+    validMac: number;
+    invalidMac: number;
+    matching: number;
+    modified: number;
+    visible: number;
+    errors: number;
+  };
+  files: FileVerification[];
+}
+
+export interface SwapMove {
+  path: string;
+  number: number;
+  contentFrom: number;
+  distance: number;
+}
+
+export interface SwapCandidate {
+  orderNumber: string;
+  source: 'registry' | 'search';
+  strategy?: SwapStrategy;
+  recordId?: string;
+  jobId?: string;
+  recipient?: string;
+  matched: number;
+  exact: boolean;
+}
+
+export interface SwapDecodeReport {
+  sourceFolder: string;
+  suspect: string;
+  generatedAt: string;
+  compared: number;
+  unmatched?: string[];
+  moves: SwapMove[];
+  swaps: { file_a: string; file_b: string; number_a: number; number_b: number }[];
+  candidates: SwapCandidate[];
+  warnings?: string[];
+}
+
 export interface BatchCopyRequest {
   selectedPath: string;
   settings: BatchCopySettings;
@@ -66,6 +219,19 @@ export interface AddTextRequest {
 
 export interface RemoveWatermarksRequest {
   selectedPath: string;
+  owner?: string;        // only remove marks with this owner label
+  markIndex?: number;    // only remove this chain position (negative counts from newest)
+  output?: 'folder' | 'zip'; // write cleaned copies next to the source instead of cleaning in place
+  dryRun?: boolean;      // only report which files would change and by how many bytes
+  filter?: MarkFilter;   // only remove marks whose decoded payload matches
+}
+
+// Every set field must match
+export interface MarkFilter {
+  text?: string;         // exact decoded text, e.g. "ORDER 007"
+  prefix?: string;       // decoded text prefix, e.g. a reseller's base text
+  regex?: string;        // regular expression on the decoded text
+  keyId?: string;        // key ID of keyed payloads
 }
 
 // WebSocket message types